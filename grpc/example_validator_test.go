@@ -0,0 +1,45 @@
+package grpc_test
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/mapleque/kelp/grpc"
+	"github.com/mapleque/kelp/grpc/example"
+	"github.com/mapleque/kelp/validator"
+)
+
+// This example shows how to valid request messages with rules registered on generated message
+func Example_validator() {
+	validator.RegisterRules(&example.HelloRequest{}, map[string]*validator.FieldRule{
+		"name": &validator.FieldRule{Valid: "rune[1,10],message=invalid name"},
+	})
+	// use it as grpc.New(grpc.Validator) in server
+	server := &example.Server{}
+	handler := func(c context.Context, req interface{}) (interface{}, error) {
+		return server.SayHello(c, req.(*example.HelloRequest))
+	}
+	info := &gogrpc.UnaryServerInfo{FullMethod: "/example.Greeter/SayHello"}
+
+	resp, err := grpc.Validator(context.Background(), &example.HelloRequest{Name: "kelp"}, info, handler)
+	fmt.Println(resp.(*example.HelloReply).Message, err)
+
+	_, err = grpc.Validator(context.Background(), &example.HelloRequest{}, info, handler)
+	st := status.Convert(err)
+	fmt.Println(st.Code())
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.FieldViolations {
+				fmt.Println(violation.Field, violation.Description)
+			}
+		}
+	}
+	// Output:
+	// Hello kelp <nil>
+	// InvalidArgument
+	// name invalid name
+}
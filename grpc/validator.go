@@ -0,0 +1,76 @@
+package grpc
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mapleque/kelp/validator"
+)
+
+// Validator is an interceptor to valid request message before handler.
+//
+// It uses the same rules as http, which come from the valid tags of message,
+// or from validator.RegisterRules for generated messages whose tags can not be changed.
+// The message is converted to json before valid, since the fields of generated message
+// are omitempty, a field with zero value is treated as not exist,
+// so that it fails on required rules.
+//
+// All invalid fields are returned in one error with code InvalidArgument,
+// and a BadRequest detail with a field violation for each field.
+func Validator(c context.Context, param interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if err := validMessage(param); err != nil {
+		return nil, err
+	}
+	return handler(c, param)
+}
+
+func validMessage(param interface{}) error {
+	data, err := json.Marshal(param)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal request failed: %v", err)
+	}
+	err = validator.ValidAll(param, data)
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(validator.ValidErrors)
+	if !ok {
+		return status.Errorf(codes.Internal, "valid request failed: %v", err)
+	}
+	badRequest := &errdetails.BadRequest{}
+	for _, validErr := range errs {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldPath(validErr.Path),
+			Description: validErr.Message,
+		})
+	}
+	st := status.New(codes.InvalidArgument, errs.Error())
+	if withDetails, err := st.WithDetails(badRequest); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// fieldPath convert json pointer to field path of BadRequest, such as /list/0/name to list[0].name
+func fieldPath(pointer string) string {
+	ret := ""
+	for _, key := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		key = strings.Replace(key, "~1", "/", -1)
+		key = strings.Replace(key, "~0", "~", -1)
+		if _, err := strconv.Atoi(key); err == nil && ret != "" {
+			ret += "[" + key + "]"
+		} else if ret == "" {
+			ret = key
+		} else {
+			ret += "." + key
+		}
+	}
+	return ret
+}
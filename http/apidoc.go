@@ -1,16 +1,20 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
 	"strings"
+
+	"github.com/mapleque/kelp/validator"
 )
 
 type docBuilder struct {
 	subscribe string
 	apiDocs   []*apiDoc
+	locale    string
 }
 
 type apiDoc struct {
@@ -28,8 +32,15 @@ type defaultSuccessResponse struct {
 	Data   interface{} `json:"data" comment:"默认为空字符串"`
 }
 
+// Doc 生成中文接口文档，输出到path，path为空时输出到标准输出
 func (this *Server) Doc(path string) {
-	db := &docBuilder{}
+	this.DocLocale(path, LOCALE_ZH)
+}
+
+// DocLocale 生成指定语言的接口文档
+// 文档中的标题、校验说明和comment tag都会按照locale翻译
+func (this *Server) DocLocale(path, locale string) {
+	db := &docBuilder{locale: locale}
 	db.buildRouterDoc(this.router)
 	db.subscribe = this.comment
 	db.output(path)
@@ -47,7 +58,7 @@ func (this *docBuilder) output(path string) {
 		}
 	}
 	if this.subscribe == "" {
-		fmt.Fprintln(file, "# 接口文档")
+		fmt.Fprintln(file, Translate(this.locale, "doc.title"))
 	} else {
 		fmt.Fprintln(file, this.subscribe)
 	}
@@ -59,18 +70,18 @@ func (this *docBuilder) output(path string) {
 			fmt.Fprintln(file, apiDoc.comment)
 		}
 		fmt.Fprintln(file)
-		fmt.Fprintln(file, "请求路径：`", apiDoc.path, "`")
+		fmt.Fprintln(file, Translate(this.locale, "doc.path")+"`", apiDoc.path, "`")
 		fmt.Fprintln(file)
-		fmt.Fprintln(file, outputJson("请求参数：", apiDoc.param))
-		fmt.Fprintln(file, outputJson("返回数据：", apiDoc.response))
-		fmt.Fprintln(file, outputJson("异常返回：", apiDoc.status))
+		fmt.Fprintln(file, outputJson(Translate(this.locale, "doc.param"), apiDoc.param, this.locale))
+		fmt.Fprintln(file, outputJson(Translate(this.locale, "doc.response"), apiDoc.response, this.locale))
+		fmt.Fprintln(file, outputJson(Translate(this.locale, "doc.status"), apiDoc.status, this.locale))
 	}
 }
 
-func outputJson(title string, jsonObj interface{}) string {
+func outputJson(title string, jsonObj interface{}, locale string) string {
 	ret := ""
 	if jsonObj != nil {
-		if c := json2String(generalJsonDoc(jsonObj, "", "", "")); c != "" && c != `""` {
+		if c := json2String(generalJsonDoc(jsonObj, "", "", "", locale)); c != "" && c != `""` {
 			ret += fmt.Sprintln(title)
 			ret += fmt.Sprintln("```")
 			ret += fmt.Sprintln(c)
@@ -145,20 +156,25 @@ func (this *apiDoc) buildHandlerDoc(handlerChain []HandlerFunc) {
 }
 
 func json2String(dest interface{}) string {
-	bytes, _ := json.MarshalIndent(dest, "", "  ")
-	return string(bytes)
+	// 文档中的<和>等符号不需要转义
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(dest)
+	return strings.TrimSuffix(buf.String(), "\n")
 }
 
-func generalJsonDoc(obj interface{}, kind, rule, comment string) interface{} {
+func generalJsonDoc(obj interface{}, kind, rule, comment, locale string) interface{} {
 	if obj != nil {
 		objType := reflect.TypeOf(obj)
 		switch objType.Kind() {
 		case reflect.Ptr:
 			objValue := reflect.ValueOf(obj)
 			if !objValue.IsNil() {
-				return generalJsonDoc(reflect.ValueOf(obj).Elem().Interface(), kind, rule, comment)
+				return generalJsonDoc(reflect.ValueOf(obj).Elem().Interface(), kind, rule, comment, locale)
 			} else {
-				return generalJsonDoc(reflect.New(objType.Elem()).Interface(), kind, rule, comment)
+				return generalJsonDoc(reflect.New(objType.Elem()).Interface(), kind, rule, comment, locale)
 			}
 		case reflect.Struct:
 			ret := map[string]interface{}{}
@@ -169,8 +185,9 @@ func generalJsonDoc(obj interface{}, kind, rule, comment string) interface{} {
 					ret[fieldName] = generalJsonDoc(
 						reflect.New(fieldType.Type).Interface(),
 						fieldType.Type.Kind().String(),
-						getFieldTag(fieldType, "valid"),
+						validDoc(fieldType, locale),
 						getFieldTag(fieldType, "comment"),
+						locale,
 					)
 				}
 			}
@@ -180,13 +197,13 @@ func generalJsonDoc(obj interface{}, kind, rule, comment string) interface{} {
 			objValue := reflect.ValueOf(obj)
 			for _, key := range objValue.MapKeys() {
 				if reflect.TypeOf(key).Kind() == reflect.String {
-					ret[key.String()] = generalJsonDoc(objValue.MapIndex(key).Interface(), "", "", "")
+					ret[key.String()] = generalJsonDoc(objValue.MapIndex(key).Interface(), "", "", "", locale)
 				}
 			}
 			return ret
 		case reflect.Slice:
 			return []interface{}{
-				generalJsonDoc(reflect.New(objType.Elem()).Interface(), "", "", ""),
+				generalJsonDoc(reflect.New(objType.Elem()).Interface(), "", "", "", locale),
 			}
 		default:
 			// do nothing
@@ -200,11 +217,18 @@ func generalJsonDoc(obj interface{}, kind, rule, comment string) interface{} {
 		ret += fmt.Sprintf(" |%s|", rule)
 	}
 	if comment != "" {
-		ret += fmt.Sprintf(" // %s", comment)
+		ret += fmt.Sprintf(" // %s", Translate(locale, comment))
 	}
 	return ret
 }
 
+// validDoc 将valid，valid_elem和valid_key tag转换成可读的校验说明
+func validDoc(fieldType reflect.StructField, locale string) string {
+	return validator.Describe(fieldType, func(key string, args ...string) string {
+		return Translate(locale, key, args...)
+	})
+}
+
 func getJsonName(fieldType reflect.StructField) string {
 	if tag, exist := fieldType.Tag.Lookup("json"); exist {
 		return strings.Split(tag, ",")[0]
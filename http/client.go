@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"time"
 )
@@ -13,13 +14,39 @@ import (
 type Client struct {
 	host    string
 	timeout time.Duration
+
+	transport    http.RoundTripper
+	interceptors []Interceptor
+	retry        *RetryPolicy
+	breaker      *breakerGroup
 }
 
+// defaultTransport is shared by all clients,
+// so that the connections can be reused between requests.
+var defaultTransport = newTransport(100, 10, 90*time.Second)
+
 // NewClient Create a http client with host, default timeout is 10s.
+// By default, the client do not retry and has no circuit breaker.
 func NewClient(host string) *Client {
 	return &Client{
-		host:    host,
-		timeout: 10 * time.Second,
+		host:      host,
+		timeout:   10 * time.Second,
+		transport: defaultTransport,
+	}
+}
+
+func newTransport(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
 	}
 }
 
@@ -65,17 +92,79 @@ func (this *Client) BuildRequest(path, method string, body []byte) (*http.Reques
 
 // Do Send a request by using http.Request.
 // The response body has been read out to body, while others are in resp.
+// If a retry policy is set, the request may be sent more than once,
+// see SetRetryPolicy.
+// If a circuit breaker is set and the breaker of the host is open,
+// ERROR_CIRCUIT_OPEN will be returned without sending.
 func (this *Client) Do(req *http.Request) (resp *http.Response, body []byte, err error) {
+	return this.retryDo(req, false)
+}
+
+func (this *Client) retryDo(req *http.Request, stream bool) (resp *http.Response, body []byte, err error) {
+	retryable := this.retry != nil && isRetryable(req)
+	for attempt := 0; ; attempt++ {
+		resp, body, err = this.do(req, stream)
+		if !retryable || attempt >= this.retry.MaxRetries || !this.retry.shouldRetry(resp, err) {
+			return resp, body, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			// body can not be replayed
+			return resp, body, err
+		}
+		delay := this.retry.delay(attempt, resp)
+		log.Log("WARN", "retry request", req.Method, req.URL.String(), "after", delay, "on", retryReason(resp, err))
+		if stream && resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return resp, body, err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return resp, body, err
+			}
+		}
+	}
+}
+
+// do send the request once,
+// if stream is true, the response body is not read and the timeout is not applied.
+func (this *Client) do(req *http.Request, stream bool) (resp *http.Response, body []byte, err error) {
+	var breaker *circuitBreaker
+	var generation uint64
+	if this.breaker != nil {
+		breaker = this.breaker.get(req.URL.Host)
+		var allowed bool
+		if generation, allowed = breaker.allow(); !allowed {
+			// the body is closed as if it is sent
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, nil, ERROR_CIRCUIT_OPEN
+		}
+	}
 	client := &http.Client{
-		Timeout: this.timeout,
+		Transport: this.transport,
+		Timeout:   this.timeout,
+	}
+	if stream {
+		client.Timeout = 0
+	}
+	if len(this.interceptors) > 0 {
+		client.Transport = &interceptorTransport{this.interceptors, this.transport}
 	}
 	resp, err = client.Do(req)
-	if err != nil {
-		return resp, nil, err
+	if err == nil && !stream {
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+	}
+	if breaker != nil {
+		if err != nil && req.Context().Err() != nil {
+			breaker.release(generation)
+		} else {
+			breaker.done(generation, err == nil && resp.StatusCode < 500)
+		}
 	}
-
-	defer resp.Body.Close()
-	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return resp, nil, err
 	}
@@ -87,6 +176,18 @@ func (this *Client) SetTimeout(d time.Duration) {
 	this.timeout = d
 }
 
+// SetPool Use a dedicated connection pool for the client instead of the shared one.
+// The params are same as the fields in http.Transport.
+func (this *Client) SetPool(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) {
+	this.transport = newTransport(maxIdleConns, maxIdleConnsPerHost, idleConnTimeout)
+}
+
+// SetTransport Set the http.RoundTripper used to send request,
+// which is a shared http.Transport by default.
+func (this *Client) SetTransport(transport http.RoundTripper) {
+	this.transport = transport
+}
+
 // KelpClient A http client for kelp server, extend Client.
 type KelpClient struct {
 	Client
@@ -97,11 +198,16 @@ type KelpClient struct {
 // The param token will be put into http header Authorization, which server may required.
 // If the token is empty, there will no Authorization header.
 // Default timeout is 10s.
+// The client has registered TraceInterceptor and AuthInterceptor.
 func NewKelpClient(host, token string) *KelpClient {
-	client := &KelpClient{}
-	client.host = host
-	client.token = token
-	client.timeout = 10 * time.Second
+	client := &KelpClient{
+		Client: *NewClient(host),
+		token:  token,
+	}
+	client.Use(TraceInterceptor)
+	if len(token) > 0 {
+		client.Use(AuthInterceptor(token))
+	}
 	return client
 }
 
@@ -133,16 +239,7 @@ func (this *KelpClient) RequestKelp(path string, in interface{}, out interface{}
 		return nil, err
 	}
 
-	if len(this.token) > 0 {
-		req.Header.Set("Authorization", this.token)
-	}
-
-	if lastContext != nil {
-		req.Header.Set("Kelp-Traceid", lastContext.Request.Header.Get("Kelp-Traceid"))
-		req.Header.Set("uuid", lastContext.Request.Header.Get("uuid"))
-	}
-
-	_, responseBody, err := this.Do(req)
+	_, responseBody, err := this.Do(WithContext(req, lastContext))
 	if err != nil {
 		return nil, err
 	}
@@ -170,3 +267,17 @@ func (this *KelpClient) RequestKelp(path string, in interface{}, out interface{}
 	}
 	return nil, nil
 }
+
+// Call Send a request to the kelp server with path, just like RequestKelp,
+// but the error status returned by server is returned as error.
+// The error can be asserted to *Status for the status code.
+func (this *KelpClient) Call(path string, in interface{}, out interface{}, lastContext *Context) error {
+	status, err := this.RequestKelp(path, in, out, lastContext)
+	if err != nil {
+		return err
+	}
+	if status != nil {
+		return status
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ERROR_CIRCUIT_OPEN = errors.New("kelp.http: circuit breaker is open")
+)
+
+// BreakerState State of a circuit breaker.
+type BreakerState int
+
+const (
+	// BREAKER_CLOSED requests are sent normally
+	BREAKER_CLOSED BreakerState = iota
+	// BREAKER_OPEN requests are rejected with ERROR_CIRCUIT_OPEN
+	BREAKER_OPEN
+	// BREAKER_HALF_OPEN one trial request is allowed to check whether the host recovers
+	BREAKER_HALF_OPEN
+)
+
+func (this BreakerState) String() string {
+	switch this {
+	case BREAKER_CLOSED:
+		return "closed"
+	case BREAKER_OPEN:
+		return "open"
+	case BREAKER_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerPolicy Define when a circuit breaker opens and recovers.
+//
+// The breaker of a host opens after FailureThreshold consecutive failures,
+// a failure is an error or a 5xx response,
+// requests canceled by the context of caller are not counted.
+// After OpenTimeout, one trial request is allowed,
+// the breaker closes if it succeed, or opens again.
+// OnStateChange is called when the state of a breaker changes, it can be nil.
+type BreakerPolicy struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	OnStateChange    func(host string, from, to BreakerState)
+}
+
+// SetCircuitBreaker Set a circuit breaker for every host requested by the client.
+// If policy is nil, the circuit breaker is removed.
+func (this *Client) SetCircuitBreaker(policy *BreakerPolicy) {
+	if policy == nil {
+		this.breaker = nil
+		return
+	}
+	this.breaker = &breakerGroup{
+		policy:   policy,
+		breakers: map[string]*circuitBreaker{},
+		mux:      new(sync.Mutex),
+	}
+}
+
+// BreakerState Return the circuit breaker state of the host,
+// host is the same as url.URL.Host.
+// If no circuit breaker is set, it is always BREAKER_CLOSED.
+func (this *Client) BreakerState(host string) BreakerState {
+	if this.breaker == nil {
+		return BREAKER_CLOSED
+	}
+	return this.breaker.get(host).state()
+}
+
+type breakerGroup struct {
+	policy   *BreakerPolicy
+	breakers map[string]*circuitBreaker
+	mux      *sync.Mutex
+}
+
+func (this *breakerGroup) get(host string) *circuitBreaker {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	breaker, ok := this.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{
+			host:   host,
+			policy: this.policy,
+			mux:    new(sync.Mutex),
+		}
+		this.breakers[host] = breaker
+	}
+	return breaker
+}
+
+type circuitBreaker struct {
+	host     string
+	policy   *BreakerPolicy
+	current  BreakerState
+	failures int
+	openAt   time.Time
+	trying   bool
+	// generation is increased when the state changes,
+	// results of requests allowed in an older generation are ignored
+	generation uint64
+	mux        *sync.Mutex
+}
+
+func (this *circuitBreaker) state() BreakerState {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.current == BREAKER_OPEN && time.Since(this.openAt) >= this.policy.OpenTimeout {
+		return BREAKER_HALF_OPEN
+	}
+	return this.current
+}
+
+// allow return whether a request can be sent,
+// and the generation which should be passed to done or release
+func (this *circuitBreaker) allow() (uint64, bool) {
+	this.mux.Lock()
+	from := this.current
+	allowed := true
+	switch this.current {
+	case BREAKER_OPEN:
+		if time.Since(this.openAt) < this.policy.OpenTimeout {
+			allowed = false
+		} else {
+			this.setState(BREAKER_HALF_OPEN)
+			this.trying = true
+		}
+	case BREAKER_HALF_OPEN:
+		if this.trying {
+			allowed = false
+		}
+		this.trying = true
+	}
+	to := this.current
+	generation := this.generation
+	this.mux.Unlock()
+	this.notify(from, to)
+	return generation, allowed
+}
+
+// done record the result of an allowed request
+func (this *circuitBreaker) done(generation uint64, success bool) {
+	this.mux.Lock()
+	if generation != this.generation {
+		this.mux.Unlock()
+		return
+	}
+	from := this.current
+	this.trying = false
+	if success {
+		this.failures = 0
+		this.setState(BREAKER_CLOSED)
+	} else {
+		this.failures++
+		if this.current == BREAKER_HALF_OPEN || this.failures >= this.policy.FailureThreshold {
+			this.openAt = time.Now()
+			this.setState(BREAKER_OPEN)
+		}
+	}
+	to := this.current
+	this.mux.Unlock()
+	this.notify(from, to)
+}
+
+// release is called if an allowed request is canceled by the caller,
+// which is neither a success nor a failure of the host
+func (this *circuitBreaker) release(generation uint64) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if generation == this.generation {
+		this.trying = false
+	}
+}
+
+// setState is called in lock
+func (this *circuitBreaker) setState(state BreakerState) {
+	if this.current != state {
+		this.current = state
+		this.generation++
+	}
+}
+
+// notify is called out of lock, so that OnStateChange can observe the breaker
+func (this *circuitBreaker) notify(from, to BreakerState) {
+	if from == to {
+		return
+	}
+	log.Log("WARN", "circuit breaker", this.host, from, "=>", to)
+	if this.policy.OnStateChange != nil {
+		this.policy.OnStateChange(this.host, from, to)
+	}
+}
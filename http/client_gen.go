@@ -0,0 +1,302 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type clientBuilder struct {
+	importPath string
+	pkgName    string
+	imports    map[string]string
+	methods    []*clientMethod
+	names      map[string]string
+}
+
+type clientMethod struct {
+	name  string
+	title string
+	path  string
+
+	param    reflect.Type
+	response reflect.Type
+}
+
+// GenClient Generate a go client package for the server.
+// Every router registered by Handle becomes a typed method of the client,
+// using the in and out types defined in handler.
+// The param importPath is the import path of the generated package,
+// the package name is the last element of it.
+// If path is empty, output to stdout.
+func (this *Server) GenClient(importPath, path string) {
+	cb := newClientBuilder(importPath)
+	cb.buildRouterClient(this.router)
+	cb.output(path)
+}
+
+func newClientBuilder(importPath string) *clientBuilder {
+	return &clientBuilder{
+		importPath: importPath,
+		pkgName:    path.Base(importPath),
+		imports:    map[string]string{},
+		methods:    []*clientMethod{},
+		names:      map[string]string{},
+	}
+}
+
+func (this *clientBuilder) output(path string) {
+	var file *os.File
+	var err error
+	if path == "" {
+		file = os.Stdout
+	} else {
+		file, err = os.Create(path)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+	}
+	if _, err := file.Write(this.source()); err != nil {
+		panic(err)
+	}
+}
+
+func (this *clientBuilder) buildRouterClient(router *Router) {
+	if router.endpoint && len(router.handlerChain) > 0 {
+		method := &clientMethod{
+			name:  clientMethodName(router.realPath),
+			title: router.title,
+			path:  router.realPath,
+		}
+		if exist, ok := this.names[method.name]; ok {
+			panic("generate client faild, method " + method.name + " conflict on " + exist + " and " + method.path)
+		}
+		this.names[method.name] = method.path
+		method.buildHandlerClient(router.handlerChain)
+		this.methods = append(this.methods, method)
+	}
+	for _, r := range router.children {
+		this.buildRouterClient(r)
+	}
+}
+
+// buildHandlerClient find in and out type from handler chain,
+// the later handler will cover the former, same as apidoc.
+func (this *clientMethod) buildHandlerClient(handlerChain []HandlerFunc) {
+	for _, handlerFunc := range handlerChain {
+		handlerType := reflect.TypeOf(handlerFunc)
+		if handlerType.Kind() != reflect.Func {
+			panic("handler type must be func but " + handlerType.Name())
+		}
+		switch handlerType.NumIn() {
+		case 1:
+			paramType := handlerType.In(0)
+			if paramType.Elem().Name() != "Context" {
+				this.param = paramType
+			}
+		case 2, 3:
+			if paramType := handlerType.In(0); paramType.Kind() == reflect.Ptr {
+				this.param = paramType
+			}
+			if responseType := handlerType.In(1); responseType.Kind() == reflect.Ptr {
+				this.response = responseType
+			}
+		}
+	}
+}
+
+func (this *clientBuilder) source() []byte {
+	methods := &bytes.Buffer{}
+	for _, method := range this.methods {
+		this.writeMethod(methods, method)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// Code generated by kelp http GenClient. DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, "package %s\n\n", this.pkgName)
+	fmt.Fprintln(buf, "import (")
+	for _, importPath := range this.sortedImports() {
+		name := this.imports[importPath]
+		if name == path.Base(importPath) {
+			fmt.Fprintf(buf, "\t%q\n", importPath)
+		} else {
+			fmt.Fprintf(buf, "\t%s %q\n", name, importPath)
+		}
+	}
+	fmt.Fprintln(buf, ")")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// Client is a typed client for the kelp server.")
+	fmt.Fprintln(buf, "type Client struct {")
+	fmt.Fprintf(buf, "\t*%s.KelpClient\n", this.qualifier(reflect.TypeOf(KelpClient{})))
+	fmt.Fprintln(buf, "}")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// NewClient Create a Client, the params are same as NewKelpClient.")
+	fmt.Fprintln(buf, "func NewClient(host, token string) *Client {")
+	fmt.Fprintf(buf, "\treturn &Client{%s.NewKelpClient(host, token)}\n", this.qualifier(reflect.TypeOf(KelpClient{})))
+	fmt.Fprintln(buf, "}")
+	buf.Write(methods.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		panic("generate client faild, " + err.Error() + "\n" + buf.String())
+	}
+	return src
+}
+
+func (this *clientBuilder) writeMethod(buf *bytes.Buffer, method *clientMethod) {
+	contextType := "*" + this.qualifier(reflect.TypeOf(Context{})) + ".Context"
+	params := []string{}
+	in := "nil"
+	if method.param != nil {
+		params = append(params, "in "+this.typeString(method.param))
+		in = "in"
+	}
+	params = append(params, "lastContext "+contextType)
+
+	fmt.Fprintln(buf)
+	if method.title != "" {
+		fmt.Fprintf(buf, "// %s %s\n", method.name, strings.Replace(method.title, "\n", " ", -1))
+	} else {
+		fmt.Fprintf(buf, "// %s request %s\n", method.name, method.path)
+	}
+	if method.response == nil {
+		fmt.Fprintf(buf, "func (this *Client) %s(%s) error {\n", method.name, strings.Join(params, ", "))
+		fmt.Fprintf(buf, "\treturn this.Call(%q, %s, nil, lastContext)\n", method.path, in)
+		fmt.Fprintln(buf, "}")
+		return
+	}
+	response := this.typeString(method.response.Elem())
+	fmt.Fprintf(buf, "func (this *Client) %s(%s) (*%s, error) {\n", method.name, strings.Join(params, ", "), response)
+	fmt.Fprintf(buf, "\tout := &%s{}\n", response)
+	fmt.Fprintf(buf, "\tif err := this.Call(%q, %s, out, lastContext); err != nil {\n", method.path, in)
+	fmt.Fprintln(buf, "\t\treturn nil, err")
+	fmt.Fprintln(buf, "\t}")
+	fmt.Fprintln(buf, "\treturn out, nil")
+	fmt.Fprintln(buf, "}")
+}
+
+// typeString return the go source of type,
+// the named type which can not be imported is expanded to its underlying type.
+func (this *clientBuilder) typeString(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		if t.PkgPath() == this.importPath {
+			return t.Name()
+		}
+		if isExported(t.Name()) && path.Base(t.PkgPath()) != "main" {
+			return this.qualifier(t) + "." + t.Name()
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + this.typeString(t.Elem())
+	case reflect.Slice:
+		return "[]" + this.typeString(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + this.typeString(t.Elem())
+	case reflect.Map:
+		return "map[" + this.typeString(t.Key()) + "]" + this.typeString(t.Elem())
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}"
+		}
+	case reflect.Struct:
+		fields := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			def := field.Name + " " + this.typeString(field.Type)
+			if field.Anonymous {
+				def = this.typeString(field.Type)
+			}
+			if field.Tag != "" {
+				def += " " + quoteTag(string(field.Tag))
+			}
+			fields = append(fields, def)
+		}
+		if len(fields) == 0 {
+			return "struct{}"
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+	default:
+		return t.Kind().String()
+	}
+	panic("generate client faild, unsupported type " + t.String())
+}
+
+// qualifier return the package name used in generated source,
+// and record the import.
+func (this *clientBuilder) qualifier(t reflect.Type) string {
+	if name, ok := this.imports[t.PkgPath()]; ok {
+		return name
+	}
+	name := strings.SplitN(t.String(), ".", 2)[0]
+	for i := 2; this.hasImportName(name) || name == this.pkgName; i++ {
+		name = strings.SplitN(t.String(), ".", 2)[0] + strconv.Itoa(i)
+	}
+	this.imports[t.PkgPath()] = name
+	return name
+}
+
+func (this *clientBuilder) hasImportName(name string) bool {
+	for _, n := range this.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *clientBuilder) sortedImports() []string {
+	ret := []string{}
+	for importPath := range this.imports {
+		ret = append(ret, importPath)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// clientMethodName convert path to method name, such as:
+//
+//	/todo/create => TodoCreate
+//	/user/get_info => UserGetInfo
+func clientMethodName(path string) string {
+	name := ""
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		first, size := utf8.DecodeRuneInString(word)
+		name += string(unicode.ToUpper(first)) + word[size:]
+	}
+	// the name must be exported, letters without upper case, such as CJK, are not
+	if !isExported(name) {
+		name = "Request" + name
+	}
+	return name
+}
+
+func isExported(name string) bool {
+	first, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(first)
+}
+
+func quoteTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
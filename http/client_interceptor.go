@@ -0,0 +1,214 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RoundTripFunc Send a request and return the response,
+// the response body has not been read.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor Interceptor is a client middleware, just like HandlerFunc on server.
+// It can do something before and after calling next, which sends the request
+// through the rest interceptors and the transport.
+//
+// An interceptor is called on every attempt, including retries.
+type Interceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// Use Register interceptors on the client,
+// they will be called in the order of registration.
+func (this *Client) Use(interceptors ...Interceptor) *Client {
+	this.interceptors = append(append([]Interceptor{}, this.interceptors...), interceptors...)
+	return this
+}
+
+// interceptorTransport wraps transport with the interceptor chain
+type interceptorTransport struct {
+	interceptors []Interceptor
+	transport    http.RoundTripper
+}
+
+func (this *interceptorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// interceptors may change the request, so do it on a copy
+	return this.next(0)(req.Clone(req.Context()))
+}
+
+func (this *interceptorTransport) next(index int) RoundTripFunc {
+	if index >= len(this.interceptors) {
+		return this.transport.RoundTrip
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		return this.interceptors[index](req, this.next(index+1))
+	}
+}
+
+type contextKey struct{}
+
+// WithContext Bind the server side Context to an outgoing request,
+// which can be used by interceptors, such as TraceInterceptor.
+func WithContext(req *http.Request, c *Context) *http.Request {
+	if c == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), contextKey{}, c))
+}
+
+// ContextFrom Return the Context bound by WithContext, or nil.
+func ContextFrom(req *http.Request) *Context {
+	c, _ := req.Context().Value(contextKey{}).(*Context)
+	return c
+}
+
+// AuthInterceptor Put token into http header Authorization,
+// if the request does not have one.
+func AuthInterceptor(token string) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if len(token) > 0 && req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", token)
+		}
+		return next(req)
+	}
+}
+
+// TraceInterceptor Pass the trace headers Kelp-Traceid and uuid
+// from the Context bound by WithContext to the request.
+func TraceInterceptor(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+	if c := ContextFrom(req); c != nil && c.Request != nil {
+		req.Header.Set("Kelp-Traceid", c.Request.Header.Get("Kelp-Traceid"))
+		req.Header.Set("uuid", c.Request.Header.Get("uuid"))
+	}
+	return next(req)
+}
+
+// LogInterceptor Log every request in the same format as LogHandler,
+// while the remote ip is replaced by the target host.
+// The response body of DoStream is not logged.
+func LogInterceptor(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+	start := time.Now()
+	reqBody := ""
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := ioutil.ReadAll(body)
+			body.Close()
+			reqBody = string(data)
+		}
+	}
+
+	resp, err := next(req)
+
+	end := time.Now()
+	latency := end.Sub(start)
+	respBody := ""
+	if err != nil {
+		respBody = err.Error()
+	} else if isStream(req) {
+		// do not read the stream, it is read by caller
+		respBody = "response is a stream"
+	} else {
+		data, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			return resp, readErr
+		}
+		respBody = string(data)
+	}
+	if len(respBody) > 500 {
+		respBody = fmt.Sprintf("response is too large (with %d bytes, head is %s)", len(respBody), respBody[0:100]+"...")
+	}
+
+	log.Log(
+		"REQ",
+		req.URL.Host, // target host
+		end.Format("2006/01/02 15:04:05"),
+		latency.Nanoseconds()/int64(time.Millisecond),
+		str(req.Method),
+		str(req.URL.RequestURI()),
+		str(req.Header.Get("Kelp-Traceid")), // trace id
+		str(req.Header.Get("uuid")),         // uuid
+		`"""`+str(reqBody)+`"""`,
+		`"""`+str(respBody)+`"""`,
+	)
+	return resp, err
+}
+
+// ClientMetric Collect request count, error count, status and latency
+// for every host and path, used by MetricInterceptor.
+type ClientMetric struct {
+	data map[string]*clientMetricItem
+	mux  *sync.Mutex
+}
+
+type clientMetricItem struct {
+	Requests  int64            `json:"requests"`
+	Errors    int64            `json:"errors"`
+	Status    map[string]int64 `json:"status"`
+	LatencyMs int64            `json:"latency_ms"`
+}
+
+// NewClientMetric Create a ClientMetric.
+func NewClientMetric() *ClientMetric {
+	return &ClientMetric{
+		data: map[string]*clientMetricItem{},
+		mux:  new(sync.Mutex),
+	}
+}
+
+// Metric Return a copy of the collected data keyed by host and path,
+// which can be output as json.
+func (this *ClientMetric) Metric() map[string]interface{} {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	ret := map[string]interface{}{}
+	for key, item := range this.data {
+		status := map[string]int64{}
+		for code, count := range item.Status {
+			status[code] = count
+		}
+		ret[key] = &clientMetricItem{
+			Requests:  item.Requests,
+			Errors:    item.Errors,
+			Status:    status,
+			LatencyMs: item.LatencyMs,
+		}
+	}
+	return ret
+}
+
+func (this *ClientMetric) record(key string, status int, err error, latency time.Duration) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	item, ok := this.data[key]
+	if !ok {
+		item = &clientMetricItem{Status: map[string]int64{}}
+		this.data[key] = item
+	}
+	item.Requests++
+	item.LatencyMs += latency.Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		item.Errors++
+		return
+	}
+	item.Status[strconv.Itoa(status)]++
+}
+
+// MetricInterceptor Record every request into metric.
+func MetricInterceptor(metric *ClientMetric) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		metric.record(req.URL.Host+req.URL.Path, status, err, time.Since(start))
+		return resp, err
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy Define when and how a failed request will be sent again.
+//
+// Only idempotent requests (GET, HEAD, OPTIONS, TRACE, PUT, DELETE)
+// and requests marked by Retryable will be retried.
+//
+// A request is failed when it returns an error,
+// or the response status code is in RetryOn.
+// The delay before next attempt grows exponentially from BaseDelay up to MaxDelay,
+// and a random part of it (Jitter, from 0 to 1) is reduced,
+// so that clients do not retry at the same time.
+// If the response has a Retry-After header, it is used as the delay,
+// which is also limited by MaxDelay.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Jitter     float64
+	RetryOn    []int
+}
+
+// DefaultRetryPolicy retries 3 times from 100ms to 2s,
+// on 429 and 5xx except 501.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   2 * time.Second,
+		Jitter:     0.5,
+		RetryOn: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// SetRetryPolicy Set the retry policy of the client.
+// If policy is nil, the client will not retry.
+func (this *Client) SetRetryPolicy(policy *RetryPolicy) {
+	this.retry = policy
+}
+
+type retryableKey struct{}
+
+// Retryable Mark a request as retryable, though the method is not idempotent,
+// such as a POST request with an idempotency key.
+func Retryable(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), retryableKey{}, true))
+}
+
+func isRetryable(req *http.Request) bool {
+	if marked, ok := req.Context().Value(retryableKey{}).(bool); ok && marked {
+		return true
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (this *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if err == ERROR_CIRCUIT_OPEN {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	for _, code := range this.RetryOn {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			// do not let the server park the caller for a long time
+			if this.MaxDelay > 0 && delay > this.MaxDelay {
+				delay = this.MaxDelay
+			}
+			return delay
+		}
+	}
+	delay := this.BaseDelay
+	for i := 0; i < attempt && (this.MaxDelay <= 0 || delay < this.MaxDelay); i++ {
+		delay *= 2
+	}
+	if this.MaxDelay > 0 && delay > this.MaxDelay {
+		delay = this.MaxDelay
+	}
+	if this.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * this.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// parseRetryAfter parse Retry-After header,
+// which may be delay seconds or a http date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		delay := at.Sub(time.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func retryReason(resp *http.Response, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return resp.Status
+}
+
+func sleepContext(c context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
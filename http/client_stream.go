@@ -0,0 +1,263 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BuildStreamRequest return a http.Request with a streaming body,
+// the body is read while sending, so that it need not be loaded into memory.
+// The request can not be retried unless body is a *bytes.Reader,
+// *bytes.Buffer or *strings.Reader.
+func (this *Client) BuildStreamRequest(path, method string, body io.Reader) (*http.Request, error) {
+	return http.NewRequest(method, this.host+path, body)
+}
+
+// MultipartFile A file in multipart form,
+// Reader is read while sending.
+type MultipartFile struct {
+	Field    string
+	Filename string
+	Reader   io.Reader
+}
+
+// BuildMultipartRequest return a POST http.Request with a multipart/form-data body,
+// which is written while sending.
+// The request can not be retried.
+// If the request is not sent, close req.Body to release the files.
+func (this *Client) BuildMultipartRequest(path string, fields map[string]string, files ...*MultipartFile) (*http.Request, error) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	body := &multipartBody{
+		reader: reader,
+		write: func() {
+			writer.CloseWithError(writeMultipart(form, fields, files))
+		},
+	}
+	req, err := http.NewRequest("POST", this.host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req, nil
+}
+
+// multipartBody starts writing the form on the first Read,
+// so that no goroutine is left if the request is never sent
+type multipartBody struct {
+	reader *io.PipeReader
+	write  func()
+	start  sync.Once
+}
+
+func (this *multipartBody) Read(p []byte) (int, error) {
+	this.start.Do(func() {
+		go this.write()
+	})
+	return this.reader.Read(p)
+}
+
+func (this *multipartBody) Close() error {
+	return this.reader.Close()
+}
+
+func writeMultipart(form *multipart.Writer, fields map[string]string, files []*MultipartFile) error {
+	for key, value := range fields {
+		if err := form.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile(file.Field, file.Filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+type streamKey struct{}
+
+func isStream(req *http.Request) bool {
+	stream, _ := req.Context().Value(streamKey{}).(bool)
+	return stream
+}
+
+// DoStream Send a request like Do, but the response body is not read,
+// the caller must close resp.Body after reading.
+// The timeout is not applied, use the context of request to cancel it.
+func (this *Client) DoStream(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(context.WithValue(req.Context(), streamKey{}, true))
+	resp, _, err := this.retryDo(req, true)
+	return resp, err
+}
+
+// Download Download the resource on path into file.
+// If the file exists, only the rest part is requested by Range header,
+// and appended to the file.
+// If the server does not support Range, the file is rewritten.
+func (this *Client) Download(path, filepath string) error {
+	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+
+	req, err := this.BuildRequest(path, "GET", nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := this.DoStream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the whole file is returned
+		offset = 0
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	case http.StatusPartialContent:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+			return fmt.Errorf("kelp.http: download %s with wrong range %s", path, resp.Header.Get("Content-Range"))
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the file has been downloaded
+		return nil
+	default:
+		return fmt.Errorf("kelp.http: download %s failed with %s", path, resp.Status)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
+
+// contentRangeStart return start of Content-Range like "bytes 100-199/200"
+func contentRangeStart(contentRange string) int64 {
+	contentRange = strings.TrimPrefix(contentRange, "bytes ")
+	if i := strings.Index(contentRange, "-"); i > 0 {
+		if start, err := strconv.ParseInt(contentRange[:i], 10, 64); err == nil {
+			return start
+		}
+	}
+	return -1
+}
+
+// Event An event in text/event-stream.
+type Event struct {
+	Id    string
+	Event string
+	Data  string
+	Retry int
+}
+
+// EventStream Read events from a text/event-stream response.
+type EventStream struct {
+	resp   *http.Response
+	reader *bufio.Reader
+	lastId string
+}
+
+// Events Send the request and return an EventStream to read server-sent events.
+// The caller must close the stream after reading.
+func (this *Client) Events(req *http.Request) (*EventStream, error) {
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := this.DoStream(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("kelp.http: event stream failed with %s", resp.Status)
+	}
+	return &EventStream{
+		resp:   resp,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// Response Return the response of the stream.
+func (this *EventStream) Response() *http.Response {
+	return this.resp
+}
+
+// Next Block until an event is received.
+// It returns io.EOF when the stream ends, an event not ended by a blank line is discarded.
+func (this *EventStream) Next() (*Event, error) {
+	event := &Event{Id: this.lastId}
+	data := []string{}
+	hasData := false
+	for {
+		line, err := this.reader.ReadString('\n')
+		if err != nil {
+			// the partial event without blank line is discarded at EOF
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if hasData {
+				break
+			}
+			// nothing to dispatch, reset the event
+			event = &Event{Id: this.lastId}
+			continue
+		}
+		if line[0] == ':' {
+			// comment
+			continue
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			event.Id = value
+			this.lastId = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "retry":
+			if retry, err := strconv.Atoi(value); err == nil {
+				event.Retry = retry
+			}
+		}
+	}
+	event.Data = strings.Join(data, "\n")
+	if event.Event == "" {
+		event.Event = "message"
+	}
+	return event, nil
+}
+
+// Close Close the stream.
+func (this *EventStream) Close() error {
+	return this.resp.Body.Close()
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientStreamRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write(body)
+	}))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	req, err := client.BuildStreamRequest("/", "POST", io.LimitReader(strings.NewReader(strings.Repeat("a", 10000)), 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.DoStream(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if len(body) != 4096 {
+		t.Error("wrong stream response length", len(body))
+	}
+}
+
+func TestClientMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		file, header, err := req.FormFile("file")
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		w.Write([]byte(req.FormValue("name") + "," + header.Filename + "," + string(content)))
+	}))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	req, err := client.BuildMultipartRequest(
+		"/",
+		map[string]string{"name": "kelp"},
+		&MultipartFile{"file", "a.txt", strings.NewReader("hello")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "kelp,a.txt,hello" {
+		t.Error("wrong multipart upload", string(body))
+	}
+}
+
+func TestClientMultipartNotSent(t *testing.T) {
+	ts, _ := failingServer(1, 500, nil)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	client.SetCircuitBreaker(&BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Minute})
+	client.Request("/", "GET", nil)
+
+	before := runtime.NumGoroutine()
+	req, err := client.BuildMultipartRequest("/", nil, &MultipartFile{"file", "a.txt", strings.NewReader("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Do(req); err != ERROR_CIRCUIT_OPEN {
+		t.Fatal("request should be rejected but", err)
+	}
+	if _, err := req.Body.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Error("body should be closed but", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Error("writer of rejected request should not be left", before, after)
+	}
+}
+
+func TestClientDownload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	ranges := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		http.ServeContent(w, req, "data", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "kelp_download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data")
+	client := NewClient(ts.URL)
+
+	// download a new file
+	if err := client.Download("/", file); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Error("wrong download content", len(data))
+	}
+
+	// resume a partial file
+	ioutil.WriteFile(file, content[:300], 0666)
+	if err := client.Download("/", file); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Error("wrong resumed content", len(data))
+	}
+
+	// file is complete
+	if err := client.Download("/", file); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Error("wrong completed content", len(data))
+	}
+
+	if len(ranges) != 3 || ranges[0] != "" || ranges[1] != "bytes=300-" || ranges[2] != "bytes=1000-" {
+		t.Error("wrong range headers", ranges)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	server := New("")
+	server.Handle("events", "/events", func(c *Context) {
+		c.SendEvent("", "hello")
+		c.SendEvent("update", "line1\nline2")
+	})
+	ts := server.RunTest()
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	req, _ := client.BuildRequest("/events", "GET", nil)
+	stream, err := client.Events(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if event, err := stream.Next(); err != nil || event.Event != "message" || event.Data != "hello" {
+		t.Error("wrong first event", event, err)
+	}
+	if event, err := stream.Next(); err != nil || event.Event != "update" || event.Data != "line1\nline2" {
+		t.Error("wrong second event", event, err)
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Error("stream should end but", err)
+	}
+}
+
+func TestEventStreamParse(t *testing.T) {
+	stream := &EventStream{
+		reader: bufio.NewReader(strings.NewReader(": comment\r\nid: 1\r\nevent: a\r\ndata: x\r\nretry: 100\r\n\r\n" +
+			"event: b\n\ndata: z\n\nevent: c\ndata: y\n")),
+	}
+	if event, err := stream.Next(); err != nil || *event != (Event{"1", "a", "x", 100}) {
+		t.Error("wrong event", event, err)
+	}
+	if event, err := stream.Next(); err != nil || *event != (Event{"1", "message", "z", 0}) {
+		t.Error("event type should be reset by blank line without data", event, err)
+	}
+	if event, err := stream.Next(); err != io.EOF {
+		t.Error("event without blank line should be discarded at EOF", event, err)
+	}
+}
+
+func TestContextStream(t *testing.T) {
+	server := New("")
+	server.Handle("stream", "/stream", func(c *Context) {
+		c.Stream("text/csv", func(w io.Writer) error {
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "%d\n", i)
+			}
+			return nil
+		})
+	})
+	ts := server.RunTest()
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "text/csv" || string(body) != "0\n1\n2\n" {
+		t.Error("wrong stream response", resp.Header.Get("Content-Type"), string(body))
+	}
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer fails the first n requests with status
+func failingServer(n int32, status int, header map[string]string) (*httptest.Server, *int32) {
+	count := new(int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(count, 1) <= n {
+			for k, v := range header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return ts, count
+}
+
+func fastRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = 5 * time.Millisecond
+	return policy
+}
+
+func TestClientRetry(t *testing.T) {
+	ts, count := failingServer(2, 503, nil)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	client.SetRetryPolicy(fastRetryPolicy())
+	resp, body, err := client.Request("/", "GET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || string(body) != "ok" || atomic.LoadInt32(count) != 3 {
+		t.Error("should success after 2 retries but", resp.StatusCode, string(body), *count)
+	}
+}
+
+func TestClientRetryGiveUp(t *testing.T) {
+	ts, count := failingServer(10, 500, nil)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	client.SetRetryPolicy(fastRetryPolicy())
+	resp, _, err := client.Request("/", "GET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 500 || atomic.LoadInt32(count) != 4 {
+		t.Error("should give up after 3 retries but", resp.StatusCode, *count)
+	}
+}
+
+func TestClientRetryNotIdempotent(t *testing.T) {
+	ts, count := failingServer(1, 503, nil)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	client.SetRetryPolicy(fastRetryPolicy())
+	resp, _, err := client.Request("/", "POST", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 || atomic.LoadInt32(count) != 1 {
+		t.Error("post should not retry but", resp.StatusCode, *count)
+	}
+
+	req, _ := client.BuildRequest("/", "POST", []byte("data"))
+	resp, body, err := client.Do(Retryable(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || string(body) != "ok" || atomic.LoadInt32(count) != 2 {
+		t.Error("marked post should retry but", resp.StatusCode, *count)
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	ts, _ := failingServer(1, 429, map[string]string{"Retry-After": "1"})
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	policy := fastRetryPolicy()
+	policy.MaxDelay = 2 * time.Second
+	client.SetRetryPolicy(policy)
+	start := time.Now()
+	resp, _, err := client.Request("/", "GET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || time.Since(start) < time.Second {
+		t.Error("should retry after 1s but", resp.StatusCode, time.Since(start))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt, expect := range []time.Duration{10, 20, 40, 50, 50} {
+		if delay := policy.delay(attempt, nil); delay != expect*time.Millisecond {
+			t.Error("attempt", attempt, "delay should be", expect*time.Millisecond, "but", delay)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"86400"}}}
+	if delay := policy.delay(0, resp); delay != 50*time.Millisecond {
+		t.Error("Retry-After should be limited by MaxDelay but", delay)
+	}
+	resp.Header.Set("Retry-After", "0")
+	if delay := policy.delay(3, resp); delay != 0 {
+		t.Error("Retry-After should be used as delay but", delay)
+	}
+	policy.Jitter = 0.5
+	for attempt := 0; attempt < 5; attempt++ {
+		if delay := policy.delay(attempt, nil); delay < 5*time.Millisecond || delay > 50*time.Millisecond {
+			t.Error("attempt", attempt, "jitter delay out of range", delay)
+		}
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	ts, count := failingServer(2, 500, nil)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	changes := []string{}
+	client := NewClient(ts.URL)
+	client.SetCircuitBreaker(&BreakerPolicy{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange: func(host string, from, to BreakerState) {
+			changes = append(changes, to.String())
+		},
+	})
+
+	client.Request("/", "GET", nil)
+	if state := client.BreakerState(u.Host); state != BREAKER_CLOSED {
+		t.Error("breaker should be closed but", state)
+	}
+	client.Request("/", "GET", nil)
+	if state := client.BreakerState(u.Host); state != BREAKER_OPEN {
+		t.Error("breaker should be open but", state)
+	}
+	if _, _, err := client.Request("/", "GET", nil); err != ERROR_CIRCUIT_OPEN {
+		t.Error("request should be rejected but", err)
+	}
+	if atomic.LoadInt32(count) != 2 {
+		t.Error("rejected request should not be sent", *count)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if state := client.BreakerState(u.Host); state != BREAKER_HALF_OPEN {
+		t.Error("breaker should be half-open but", state)
+	}
+	if _, body, err := client.Request("/", "GET", nil); err != nil || string(body) != "ok" {
+		t.Error("trial request should success but", err)
+	}
+	if state := client.BreakerState(u.Host); state != BREAKER_CLOSED {
+		t.Error("breaker should be closed but", state)
+	}
+	if len(changes) != 3 || changes[0] != "open" || changes[1] != "half-open" || changes[2] != "closed" {
+		t.Error("wrong state changes", changes)
+	}
+}
+
+func TestCircuitBreakerGeneration(t *testing.T) {
+	breaker := &circuitBreaker{host: "kelp", policy: &BreakerPolicy{FailureThreshold: 1}, mux: new(sync.Mutex)}
+	slow, _ := breaker.allow()
+	failed, _ := breaker.allow()
+	breaker.done(failed, false)
+	if breaker.state() != BREAKER_HALF_OPEN {
+		t.Fatal("breaker should be half-open but", breaker.state())
+	}
+	trial, allowed := breaker.allow()
+	if !allowed {
+		t.Fatal("trial request should be allowed")
+	}
+	// the slow request allowed while closed finishes after the breaker opens
+	breaker.done(slow, true)
+	if _, allowed := breaker.allow(); allowed || breaker.current != BREAKER_HALF_OPEN {
+		t.Error("result of older generation should be ignored", breaker.current)
+	}
+	breaker.release(trial)
+	if trial, allowed = breaker.allow(); !allowed {
+		t.Error("released trial should allow another one")
+	}
+	breaker.done(trial, true)
+	if breaker.state() != BREAKER_CLOSED {
+		t.Error("breaker should be closed by trial but", breaker.state())
+	}
+}
+
+func TestClientCircuitBreakerCanceled(t *testing.T) {
+	ts, count := failingServer(0, 500, nil)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	client := NewClient(ts.URL)
+	client.SetCircuitBreaker(&BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	if _, _, err := client.Do(req); err == nil {
+		t.Fatal("canceled request should fail")
+	}
+	if state := client.BreakerState(u.Host); state != BREAKER_CLOSED || atomic.LoadInt32(count) != 0 {
+		t.Error("canceled request should not open the breaker", state)
+	}
+}
+
+func TestClientInterceptor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("X-Order")))
+	}))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	order := func(name string) Interceptor {
+		return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			req.Header.Set("X-Order", req.Header.Get("X-Order")+name)
+			return next(req)
+		}
+	}
+	client.Use(order("a"), order("b")).Use(order("c"))
+	_, body, err := client.Request("/", "GET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "abc" {
+		t.Error("interceptors should be called in order but", string(body))
+	}
+}
+
+type logRecorder struct {
+	logs [][]interface{}
+}
+
+func (this *logRecorder) Log(tag string, msg ...interface{}) {
+	this.logs = append(this.logs, append([]interface{}{tag}, msg...))
+}
+
+func TestKelpClientInterceptor(t *testing.T) {
+	server := New("")
+	server.Handle("echo", "/echo", func(in *in, out *out, c *Context) {
+		out.Result = in.Name + "," +
+			c.Request.Header.Get("Authorization") + "," +
+			c.Request.Header.Get("Kelp-Traceid")
+	})
+	ts := server.RunTest()
+	defer ts.Close()
+
+	lastRequest, _ := http.NewRequest("POST", "/", nil)
+	lastRequest.Header.Set("Kelp-Traceid", "trace")
+	lastContext := newContext(nil, lastRequest)
+
+	metric := NewClientMetric()
+	recorder := &logRecorder{}
+	SetLogger(recorder)
+	defer SetLogger(&logger{})
+
+	client := NewKelpClient(ts.URL, "token")
+	client.Use(LogInterceptor, MetricInterceptor(metric))
+	ret := &out{}
+	if err := client.Call("/echo", &in{"kelp"}, ret, lastContext); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Result != "kelp,token,trace" {
+		t.Error("wrong result", ret.Result)
+	}
+
+	if len(recorder.logs) != 1 || len(recorder.logs[0]) != 10 || recorder.logs[0][0] != "REQ" ||
+		recorder.logs[0][4] != "POST" || recorder.logs[0][5] != "/echo" || recorder.logs[0][6] != "trace" ||
+		recorder.logs[0][8] != `"""{"name":"kelp"}"""` {
+		t.Error("wrong request log", recorder.logs)
+	}
+
+	u, _ := url.Parse(ts.URL)
+	item, ok := metric.Metric()[u.Host+"/echo"].(*clientMetricItem)
+	if !ok || item.Requests != 1 || item.Errors != 0 || item.Status["200"] != 1 {
+		t.Error("wrong metric", metric.Metric())
+	}
+}
+
+func TestClientMethodName(t *testing.T) {
+	for path, expect := range map[string]string{
+		"/todo/create":   "TodoCreate",
+		"/user/get_info": "UserGetInfo",
+		"/ärger/öffnen":  "ÄrgerÖffnen",
+		"/用户/info":       "Request用户Info",
+		"/1/list":        "Request1List",
+		"/":              "Request",
+	} {
+		if name := clientMethodName(path); name != expect {
+			t.Error("wrong method name of", path, name)
+		}
+	}
+}
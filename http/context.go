@@ -3,8 +3,10 @@ package http
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"sync"
 )
 
@@ -27,6 +29,13 @@ type Context struct {
 
 	body        []byte
 	hasReadBody bool
+
+	hasSentEvent bool
+
+	validAll bool
+
+	locale    string
+	hasLocale bool
 }
 
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
@@ -106,6 +115,9 @@ func (this *Context) Json(data interface{}) {
 	this.HasResponse = true
 	this.HttpStatus = 200
 	this.ContentType = "text/json;charset=UTF-8"
+	if status, ok := data.(*Status); ok {
+		data = status.Localize(this.Locale())
+	}
 	out, _ := json.Marshal(data)
 	this.Response = out
 }
@@ -141,3 +153,43 @@ func (this *Context) response() {
 		this.ResponseWriter.WriteHeader(this.HttpStatus)
 	}
 }
+
+// SendEvent Send a server-sent event with text/event-stream,
+// it can be called many times in a handler and every event is flushed at once.
+// The event is optional, if empty, client will receive a "message" event.
+func (this *Context) SendEvent(event, data string) error {
+	this.ManuResponse = true
+	if !this.hasSentEvent {
+		this.hasSentEvent = true
+		this.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+		this.ResponseWriter.Header().Set("Cache-Control", "no-cache")
+		this.ResponseWriter.WriteHeader(200)
+	}
+	msg := ""
+	if event != "" {
+		msg += "event: " + event + "\n"
+	}
+	for _, line := range strings.Split(data, "\n") {
+		msg += "data: " + line + "\n"
+	}
+	if _, err := this.ResponseWriter.Write([]byte(msg + "\n")); err != nil {
+		return err
+	}
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Stream 流式返回大量数据，write写入的数据直接发送给客户端，不在内存中缓存整个响应，
+// 如果write在写入数据后出错，响应已经发送，只能返回错误。
+func (this *Context) Stream(contentType string, write func(w io.Writer) error) error {
+	this.ManuResponse = true
+	this.ResponseWriter.Header().Set("Content-Type", contentType)
+	this.ResponseWriter.WriteHeader(200)
+	err := write(this.ResponseWriter)
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return err
+}
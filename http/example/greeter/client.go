@@ -0,0 +1,36 @@
+// Code generated by kelp http GenClient. DO NOT EDIT.
+
+package greeter
+
+import (
+	"github.com/mapleque/kelp/http"
+)
+
+// Client is a typed client for the kelp server.
+type Client struct {
+	*http.KelpClient
+}
+
+// NewClient Create a Client, the params are same as NewKelpClient.
+func NewClient(host, token string) *Client {
+	return &Client{http.NewKelpClient(host, token)}
+}
+
+// GreeterHello say hello
+func (this *Client) GreeterHello(in *HelloParam, lastContext *http.Context) (*HelloResponse, error) {
+	out := &HelloResponse{}
+	if err := this.Call("/greeter/hello", in, out, lastContext); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GreeterBye say bye
+func (this *Client) GreeterBye(in *HelloParam, lastContext *http.Context) error {
+	return this.Call("/greeter/bye", in, nil, lastContext)
+}
+
+// GreeterPing ping
+func (this *Client) GreeterPing(lastContext *http.Context) error {
+	return this.Call("/greeter/ping", nil, nil, lastContext)
+}
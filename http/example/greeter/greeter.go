@@ -0,0 +1,47 @@
+// Package greeter is an example showing how to generate a typed client
+// for a kelp http server by Server.GenClient.
+//
+// The client.go is generated by:
+//
+//	server := http.New(host)
+//	greeter.Register(server.Group("/greeter"))
+//	server.GenClient("github.com/mapleque/kelp/http/example/greeter", "client.go")
+package greeter
+
+import (
+	"github.com/mapleque/kelp/http"
+)
+
+var STATUS_EMPTY_NAME = &http.Status{Status: 100, Message: "name is empty"}
+
+type HelloParam struct {
+	Name string `json:"name" valid:"message=name is required"`
+}
+
+type HelloResponse struct {
+	Message string `json:"message"`
+}
+
+// Register register greeter handlers on router
+func Register(router *http.Router) {
+	router.Handle("say hello", "/hello", Hello)
+	router.Handle("say bye", "/bye", Bye)
+	router.Handle("ping", "/ping", Ping)
+}
+
+func Hello(in *HelloParam, out *HelloResponse) *http.Status {
+	if in.Name == "" {
+		return STATUS_EMPTY_NAME
+	}
+	out.Message = "hello " + in.Name
+	return nil
+}
+
+func Bye(in *HelloParam) *http.Status {
+	if in.Name == "" {
+		return STATUS_EMPTY_NAME
+	}
+	return nil
+}
+
+func Ping() {}
@@ -0,0 +1,64 @@
+package greeter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mapleque/kelp/http"
+	"github.com/mapleque/kelp/http/example/greeter"
+)
+
+func newServer() *http.Server {
+	server := http.New("")
+	greeter.Register(server.Group("/greeter"))
+	return server
+}
+
+func TestGenClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp_gen_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "client.go")
+	newServer().GenClient("github.com/mapleque/kelp/http/example/greeter", file)
+	generated, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, err := ioutil.ReadFile("client.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(generated) != string(expect) {
+		t.Error("client.go is out of date, generated:\n" + string(generated))
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	ts := newServer().RunTest()
+	defer ts.Close()
+	client := greeter.NewClient(ts.URL, "")
+
+	out, err := client.GreeterHello(&greeter.HelloParam{Name: "kelp"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Message != "hello kelp" {
+		t.Error("wrong response", out.Message)
+	}
+
+	_, err = client.GreeterHello(&greeter.HelloParam{}, nil)
+	if status, ok := err.(*http.Status); !ok || status.Status != greeter.STATUS_EMPTY_NAME.Status {
+		t.Error("should return empty name status but", err)
+	}
+
+	if err := client.GreeterBye(&greeter.HelloParam{Name: "kelp"}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := client.GreeterPing(nil); err != nil {
+		t.Error(err)
+	}
+}
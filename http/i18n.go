@@ -0,0 +1,337 @@
+package http
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 内置的语言
+const (
+	LOCALE_ZH = "zh"
+	LOCALE_EN = "en"
+)
+
+var (
+	// messages 消息目录，key是语言，value是消息id到翻译的映射
+	messages    = map[string]map[string]string{}
+	messagesMux = new(sync.RWMutex)
+)
+
+func init() {
+	RegisterMessages(LOCALE_ZH, zhMessages)
+	RegisterMessages(LOCALE_EN, enMessages)
+}
+
+// RegisterMessages 注册一个语言的消息目录
+// key是消息id，value是翻译后的消息，可以覆盖已经注册的消息
+//
+// 消息id可以是：
+//   - valid.<rule> 校验规则的默认提示，例如valid.required，{0}是字段名，{1}是规则参数
+//   - valid tag中message=定义的message
+//   - Status的message，例如"not found"
+//   - 文档中用到的文本，以及comment tag
+func RegisterMessages(locale string, msgs map[string]string) {
+	locale = normalizeLocale(locale)
+	messagesMux.Lock()
+	defer messagesMux.Unlock()
+	catalog, exist := messages[locale]
+	if !exist {
+		catalog = map[string]string{}
+		messages[locale] = catalog
+	}
+	for key, msg := range msgs {
+		catalog[key] = msg
+	}
+}
+
+// Translate 翻译消息，并用args替换消息中的{0}，{1}...
+// 如果找不到locale，例如zh-cn，会再查找zh
+// 如果找不到翻译，返回key
+func Translate(locale, key string, args ...string) string {
+	msg, _ := translate(locale, key, args...)
+	return msg
+}
+
+// translate 翻译消息，返回是否找到了翻译
+func translate(locale, key string, args ...string) (string, bool) {
+	msg, ok := lookupMessage(locale, key)
+	if !ok {
+		msg = key
+	}
+	for i, arg := range args {
+		msg = strings.Replace(msg, "{"+strconv.Itoa(i)+"}", arg, -1)
+	}
+	return msg, ok
+}
+
+func lookupMessage(locale, key string) (string, bool) {
+	messagesMux.RLock()
+	defer messagesMux.RUnlock()
+	for _, l := range localeChain(locale) {
+		if msg, exist := messages[l][key]; exist {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// hasLocale 返回是否注册了这个语言的消息目录
+func hasLocale(locale string) bool {
+	messagesMux.RLock()
+	defer messagesMux.RUnlock()
+	for _, l := range localeChain(locale) {
+		if _, exist := messages[l]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// localeChain 返回查找消息时依次使用的语言，例如zh-cn，zh
+func localeChain(locale string) []string {
+	locale = normalizeLocale(locale)
+	if locale == "" {
+		return nil
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		return []string{locale, locale[:i]}
+	}
+	return []string{locale}
+}
+
+func normalizeLocale(locale string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(locale)), "_", "-", -1)
+}
+
+// ParseAcceptLanguage 从Accept-Language中选择一个注册过的语言
+// 按照q值从大到小选择，如果没有注册过的语言，返回空字符串
+func ParseAcceptLanguage(acceptLanguage string) string {
+	type language struct {
+		locale string
+		q      float64
+	}
+	languages := []language{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		items := strings.Split(part, ";")
+		locale := normalizeLocale(items[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, item := range items[1:] {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "q=") {
+				if v, err := strconv.ParseFloat(item[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		languages = append(languages, language{locale, q})
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+	for _, l := range languages {
+		if l.q > 0 && hasLocale(l.locale) {
+			return l.locale
+		}
+	}
+	return ""
+}
+
+// SetLocale 设置当前请求使用的语言，会覆盖Accept-Language
+// 通常在中间件中根据用户设置调用
+func (this *Context) SetLocale(locale string) {
+	this.locale = locale
+	this.hasLocale = true
+}
+
+// Locale 返回当前请求使用的语言
+// 如果没有通过SetLocale设置，就从Accept-Language中选择一个注册过的语言
+// 返回空字符串表示不需要翻译
+func (this *Context) Locale() string {
+	if !this.hasLocale {
+		this.hasLocale = true
+		if this.Request != nil {
+			this.locale = ParseAcceptLanguage(this.Request.Header.Get("Accept-Language"))
+		}
+	}
+	return this.locale
+}
+
+// Localize 返回翻译后的Status
+// 如果message是字符串，并且有对应的翻译，就返回一个新的Status，否则返回自己
+func (this *Status) Localize(locale string) *Status {
+	if msg, ok := this.Message.(string); ok && locale != "" {
+		if translated, ok := translate(locale, msg); ok {
+			return &Status{this.Status, translated}
+		}
+	}
+	return this
+}
+
+// LocalizeError 返回翻译后的校验错误，其他错误原样返回
+// 如果在valid tag中定义了message，使用message作为消息id翻译
+// 否则使用valid.<rule>翻译默认提示
+// 如果找不到翻译，message不变
+func LocalizeError(err error, locale string) error {
+	if locale == "" {
+		return err
+	}
+	switch e := err.(type) {
+	case *ValidError:
+		return localizeValidError(e, locale)
+	case ValidErrors:
+		ret := ValidErrors{}
+		for _, validErr := range e {
+			ret = append(ret, localizeValidError(validErr, locale))
+		}
+		return ret
+	}
+	return err
+}
+
+func localizeValidError(err *ValidError, locale string) *ValidError {
+	ret := *err
+	if err.Custom() {
+		if msg, ok := translate(locale, err.Message); ok {
+			ret.Message = msg
+		}
+	} else if msg, ok := translate(locale, "valid."+err.Rule, err.Field(), strings.Join(err.Params, ",")); ok {
+		ret.Message = msg
+	}
+	return &ret
+}
+
+var zhMessages = map[string]string{
+	"valid.required":    "{0}是必填的",
+	"valid.required_if": "{0}是必填的",
+	"valid.regexp":      "{0}格式不正确",
+	"valid.range":       "{0}不在范围{1}内",
+	"valid.rune_range":  "{0}的长度不在范围{1}内",
+	"valid.func":        "{0}不合法",
+	"valid.type":        "{0}类型不正确",
+	"valid.in":          "{0}必须是{1}其中之一",
+	"valid.email":       "{0}必须是邮箱",
+	"valid.url":         "{0}必须是URL",
+	"valid.ip":          "{0}必须是IP地址",
+	"valid.ipv4":        "{0}必须是IPv4地址",
+	"valid.ipv6":        "{0}必须是IPv6地址",
+	"valid.cidr":        "{0}必须是CIDR",
+	"valid.uuid":        "{0}必须是UUID",
+	"valid.date":        "{0}必须是{1}格式的日期",
+	"valid.uint":        "{0}必须是非负整数",
+	"valid.eqfield":     "{0}必须等于{1}",
+	"valid.nefield":     "{0}不能等于{1}",
+	"valid.gtfield":     "{0}必须大于{1}",
+	"valid.gtefield":    "{0}必须大于等于{1}",
+	"valid.ltfield":     "{0}必须小于{1}",
+	"valid.ltefield":    "{0}必须小于等于{1}",
+
+	"unauthorized": "未授权",
+	"forbidden":    "没有权限",
+	"not found":    "不存在",
+
+	"doc.title":       "# 接口文档",
+	"doc.path":        "请求路径：",
+	"doc.param":       "请求参数：",
+	"doc.response":    "返回数据：",
+	"doc.status":      "异常返回：",
+	"doc.required":    "必填",
+	"doc.optional":    "可选",
+	"doc.required_if": "当{0}={1}时必填",
+	"doc.elem":        "元素: ",
+	"doc.key":         "key: ",
+	"doc.regexp":      "匹配/{0}/",
+	"doc.range":       "{0}",
+	"doc.length":      "长度{0}",
+	"doc.rune_length": "字符数{0}",
+	"doc.count":       "元素个数{0}",
+	"doc.func":        "@{0}",
+	"doc.in":          "取值{0}之一",
+	"doc.email":       "邮箱格式",
+	"doc.url":         "URL格式",
+	"doc.ip":          "IP地址格式",
+	"doc.ipv4":        "IPv4地址格式",
+	"doc.ipv6":        "IPv6地址格式",
+	"doc.cidr":        "CIDR格式",
+	"doc.uuid":        "UUID格式",
+	"doc.date":        "日期格式{0}",
+	"doc.uint":        "非负整数",
+	"doc.eqfield":     "等于{0}",
+	"doc.nefield":     "不等于{0}",
+	"doc.gtfield":     "大于{0}",
+	"doc.gtefield":    "大于等于{0}",
+	"doc.ltfield":     "小于{0}",
+	"doc.ltefield":    "小于等于{0}",
+}
+
+var enMessages = map[string]string{
+	"valid.required":    "{0} is required",
+	"valid.required_if": "{0} is required",
+	"valid.regexp":      "{0} is in wrong format",
+	"valid.range":       "{0} is out of range {1}",
+	"valid.rune_range":  "length of {0} is out of range {1}",
+	"valid.func":        "{0} is invalid",
+	"valid.type":        "{0} has wrong type",
+	"valid.in":          "{0} must be one of {1}",
+	"valid.email":       "{0} must be an email",
+	"valid.url":         "{0} must be a URL",
+	"valid.ip":          "{0} must be an IP address",
+	"valid.ipv4":        "{0} must be an IPv4 address",
+	"valid.ipv6":        "{0} must be an IPv6 address",
+	"valid.cidr":        "{0} must be a CIDR",
+	"valid.uuid":        "{0} must be a UUID",
+	"valid.date":        "{0} must be a date in format {1}",
+	"valid.uint":        "{0} must be a non-negative integer",
+	"valid.eqfield":     "{0} must be equal to {1}",
+	"valid.nefield":     "{0} must not be equal to {1}",
+	"valid.gtfield":     "{0} must be greater than {1}",
+	"valid.gtefield":    "{0} must be greater than or equal to {1}",
+	"valid.ltfield":     "{0} must be less than {1}",
+	"valid.ltefield":    "{0} must be less than or equal to {1}",
+
+	"成功":    "success",
+	"未知错误":  "unknown error",
+	"数据库错误": "database error",
+
+	"默认为0":    "0 by default",
+	"默认为空字符串": "empty string by default",
+	"请参考开发者定义的Status列表": "see the status list defined by developer",
+	"用于联调测试时参考的错误信息":    "error message for debugging",
+
+	"doc.title":       "# API Document",
+	"doc.path":        "Path:",
+	"doc.param":       "Request:",
+	"doc.response":    "Response:",
+	"doc.status":      "Error:",
+	"doc.required":    "required",
+	"doc.optional":    "optional",
+	"doc.required_if": "required if {0}={1}",
+	"doc.elem":        "element: ",
+	"doc.key":         "key: ",
+	"doc.regexp":      "matches /{0}/",
+	"doc.range":       "{0}",
+	"doc.length":      "length {0}",
+	"doc.rune_length": "characters {0}",
+	"doc.count":       "count {0}",
+	"doc.func":        "@{0}",
+	"doc.in":          "one of {0}",
+	"doc.email":       "email",
+	"doc.url":         "URL",
+	"doc.ip":          "IP address",
+	"doc.ipv4":        "IPv4 address",
+	"doc.ipv6":        "IPv6 address",
+	"doc.cidr":        "CIDR",
+	"doc.uuid":        "UUID",
+	"doc.date":        "date in format {0}",
+	"doc.uint":        "non-negative integer",
+	"doc.eqfield":     "equal to {0}",
+	"doc.nefield":     "not equal to {0}",
+	"doc.gtfield":     "greater than {0}",
+	"doc.gtefield":    "greater than or equal to {0}",
+	"doc.ltfield":     "less than {0}",
+	"doc.ltefield":    "less than or equal to {0}",
+}
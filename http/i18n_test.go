@@ -0,0 +1,130 @@
+package http
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	RegisterMessages("zh-TW", map[string]string{"doc.required": "必填欄位"})
+	for _, c := range []struct {
+		locale string
+		key    string
+		args   []string
+		expect string
+	}{
+		{"en", "valid.required", []string{"name"}, "name is required"},
+		{"en-US", "valid.range", []string{"age", "[0,150]"}, "age is out of range [0,150]"},
+		{"zh_CN", "valid.required", []string{"name"}, "name是必填的"},
+		{"zh-tw", "doc.required", nil, "必填欄位"},
+		{"zh-tw", "doc.optional", nil, "可选"},
+		{"zh-tw", "unknown", nil, "unknown"},
+		{"fr", "valid.required", []string{"name"}, "valid.required"},
+		{"", "not found", nil, "not found"},
+	} {
+		if msg := Translate(c.locale, c.key, c.args...); msg != c.expect {
+			t.Error(c.locale, c.key, "should be translated to", c.expect, "but", msg)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		expect string
+	}{
+		{"en-US,en;q=0.9,zh-CN;q=0.8", "en-us"},
+		{"fr-FR,zh-CN;q=0.8,en;q=0.9", "en"},
+		{"zh-CN;q=0.5,fr", "zh-cn"},
+		{"fr,de;q=0.5", ""},
+		{"*", ""},
+		{"", ""},
+	} {
+		if locale := ParseAcceptLanguage(c.header); locale != c.expect {
+			t.Error(c.header, "should choose", c.expect, "but", locale)
+		}
+	}
+}
+
+type structForTestLocale struct {
+	Name string `json:"name" valid:"rune[1,10],message=invalid_name"`
+	Age  int    `json:"age" valid:"[0,150]"`
+}
+
+func TestLocalizedResponse(t *testing.T) {
+	RegisterMessages(LOCALE_EN, map[string]string{"invalid_name": "name must have 1 to 10 characters"})
+	RegisterMessages(LOCALE_ZH, map[string]string{"invalid_name": "名字必须是1到10个字"})
+	server := New("")
+	server.ValidAll(true)
+	server.Use(func(c *Context) {
+		// 用户设置的语言优先
+		if locale := c.Request.Header.Get("X-Locale"); locale != "" {
+			c.SetLocale(locale)
+		}
+		c.Next()
+	})
+	server.Handle("locale", "/valid", func(in *structForTestLocale) {})
+	server.Handle("not found", "/not_found", func() *Status { return STATUS_NOT_FOUND })
+	ts := server.RunTest()
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	for _, c := range []struct {
+		path   string
+		header map[string]string
+		expect string
+	}{
+		{"/valid", nil, `{"status":3,"message":[` +
+			`{"path":"/name","rule":"required","params":[],"message":"invalid_name"},` +
+			`{"path":"/age","rule":"required","params":[],"message":"age valid faild"}]}`},
+		{"/valid", map[string]string{"Accept-Language": "en-US,en;q=0.9"}, `{"status":3,"message":[` +
+			`{"path":"/name","rule":"required","params":[],"message":"name must have 1 to 10 characters"},` +
+			`{"path":"/age","rule":"required","params":[],"message":"age is required"}]}`},
+		{"/valid", map[string]string{"Accept-Language": "en", "X-Locale": "zh"}, `{"status":3,"message":[` +
+			`{"path":"/name","rule":"required","params":[],"message":"名字必须是1到10个字"},` +
+			`{"path":"/age","rule":"required","params":[],"message":"age是必填的"}]}`},
+		{"/not_found", nil, `{"status":404,"message":"not found"}`},
+		{"/not_found", map[string]string{"Accept-Language": "zh-CN"}, `{"status":404,"message":"不存在"}`},
+	} {
+		req, _ := client.BuildRequest(c.path, "POST", []byte(`{}`))
+		for key, value := range c.header {
+			req.Header.Set(key, value)
+		}
+		_, body, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != c.expect {
+			t.Error(c.path, c.header, "response should be", c.expect, "but", string(body))
+		}
+	}
+	// STATUS_NOT_FOUND本身不会被修改
+	if STATUS_NOT_FOUND.Message != "not found" {
+		t.Error("status global should not be changed", STATUS_NOT_FOUND.Message)
+	}
+}
+
+func TestDocLocale(t *testing.T) {
+	server := New("")
+	server.Handle("locale", "/valid", func(in *structForTestLocale) {})
+	dir, err := ioutil.TempDir("", "kelp_doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for locale, expects := range map[string][]string{
+		LOCALE_ZH: {"# 接口文档", "请求参数：", `"int |必填, 0<=x<=150|"`, `"string |必填, 字符数1<=x<=10|"`},
+		LOCALE_EN: {"# API Document", "Request:", `"int |required, 0<=x<=150|"`, `"string |required, characters 1<=x<=10|"`, "0 by default"},
+	} {
+		file := filepath.Join(dir, locale+".md")
+		server.DocLocale(file, locale)
+		doc, _ := ioutil.ReadFile(file)
+		for _, expect := range expects {
+			if !strings.Contains(string(doc), expect) {
+				t.Error(locale, "doc should contain", expect, "but", string(doc))
+			}
+		}
+	}
+}
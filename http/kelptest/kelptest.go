@@ -0,0 +1,342 @@
+// Package kelptest provides utilities for testing kelp http servers and clients.
+//
+// Test a server with a fluent request builder:
+//
+//	kt := kelptest.New(t, server)
+//	defer kt.Close()
+//	kt.Post("/todo/create").Json(in).Do().
+//		Status(0).
+//		Data("id", 1).
+//		Golden("todo_create")
+//
+// Record the interactions of a client and replay them offline:
+//
+//	recorder := kelptest.NewRecorder("testdata/service.json", kelptest.MODE_AUTO)
+//	defer recorder.Close()
+//	client.SetTransport(recorder)
+package kelptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	gohttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mapleque/kelp/http"
+)
+
+// Tester Send requests to a kelp server started by Server.RunTest.
+type Tester struct {
+	t      testing.TB
+	server *httptest.Server
+	header gohttp.Header
+}
+
+// New Start the server and return a Tester, call Close after testing.
+func New(t testing.TB, server *http.Server) *Tester {
+	return &Tester{
+		t:      t,
+		server: server.RunTest(),
+		header: gohttp.Header{},
+	}
+}
+
+// Close Stop the server.
+func (this *Tester) Close() {
+	this.server.Close()
+}
+
+// URL Return the base url of the server, such as http://127.0.0.1:port.
+func (this *Tester) URL() string {
+	return this.server.URL
+}
+
+// Header Set a header on all requests sent by the Tester,
+// such as Authorization.
+func (this *Tester) Header(key, value string) *Tester {
+	this.header.Set(key, value)
+	return this
+}
+
+// Request Create a request with method and path.
+func (this *Tester) Request(method, path string) *Request {
+	header := gohttp.Header{}
+	for key, values := range this.header {
+		header[key] = append([]string{}, values...)
+	}
+	return &Request{
+		tester: this,
+		method: method,
+		path:   path,
+		header: header,
+		query:  url.Values{},
+	}
+}
+
+// Get Create a GET request with path.
+func (this *Tester) Get(path string) *Request {
+	return this.Request("GET", path)
+}
+
+// Post Create a POST request with path, which is the method used by KelpClient.
+func (this *Tester) Post(path string) *Request {
+	return this.Request("POST", path)
+}
+
+// Request A request builder.
+type Request struct {
+	tester *Tester
+	method string
+	path   string
+	header gohttp.Header
+	query  url.Values
+	body   []byte
+}
+
+// Header Set a request header.
+func (this *Request) Header(key, value string) *Request {
+	this.header.Set(key, value)
+	return this
+}
+
+// Query Add a query param.
+func (this *Request) Query(key, value string) *Request {
+	this.query.Add(key, value)
+	return this
+}
+
+// Body Set the request body.
+func (this *Request) Body(body []byte) *Request {
+	this.body = body
+	return this
+}
+
+// Json Set the request body as json of v,
+// v can be a struct, a map or a json string.
+func (this *Request) Json(v interface{}) *Request {
+	this.tester.t.Helper()
+	switch data := v.(type) {
+	case string:
+		this.body = []byte(data)
+	case []byte:
+		this.body = data
+	default:
+		body, err := json.Marshal(v)
+		if err != nil {
+			this.tester.t.Fatal("kelptest: marshal request body failed", err)
+		}
+		this.body = body
+	}
+	this.header.Set("Content-Type", "application/json")
+	return this
+}
+
+// Do Send the request, the test fails at once if the request can not be sent.
+func (this *Request) Do() *Response {
+	t := this.tester.t
+	t.Helper()
+	target := this.tester.server.URL + this.path
+	if len(this.query) > 0 {
+		target += "?" + this.query.Encode()
+	}
+	req, err := gohttp.NewRequest(this.method, target, bytes.NewReader(this.body))
+	if err != nil {
+		t.Fatal("kelptest: build request failed", err)
+	}
+	req.Header = this.header
+	resp, err := this.tester.server.Client().Do(req)
+	if err != nil {
+		t.Fatal("kelptest: send request failed", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("kelptest: read response failed", err)
+	}
+	return &Response{
+		t:        t,
+		name:     this.method + " " + this.path,
+		Response: resp,
+		Body:     body,
+	}
+}
+
+// Response A response with assertions,
+// every assertion reports error on the test and returns the response for chaining.
+type Response struct {
+	t    testing.TB
+	name string
+
+	Response *gohttp.Response
+	Body     []byte
+
+	json     interface{}
+	jsonErr  error
+	hasParse bool
+}
+
+// HttpStatus Assert the http status code.
+func (this *Response) HttpStatus(code int) *Response {
+	this.t.Helper()
+	if this.Response.StatusCode != code {
+		this.t.Error(this.name, "http status should be", code, "but", this.Response.StatusCode)
+	}
+	return this
+}
+
+// Status Assert the status in kelp json response.
+func (this *Response) Status(status int) *Response {
+	this.t.Helper()
+	return this.Json("status", status)
+}
+
+// Message Assert the message in kelp json response.
+func (this *Response) Message(message interface{}) *Response {
+	this.t.Helper()
+	return this.Json("message", message)
+}
+
+// Data Assert the value on path of data in kelp json response.
+// The path is separated by dot, and the index of array is a number,
+// such as "list.0.title". If path is empty, the whole data is compared.
+func (this *Response) Data(path string, expect interface{}) *Response {
+	this.t.Helper()
+	if path == "" {
+		return this.Json("data", expect)
+	}
+	return this.Json("data."+path, expect)
+}
+
+// Json Assert the value on path of the json response,
+// the expect value is compared in json form, so that a struct can be used.
+func (this *Response) Json(path string, expect interface{}) *Response {
+	this.t.Helper()
+	actual, err := this.value(path)
+	if err != nil {
+		this.t.Error(this.name, err)
+		return this
+	}
+	expectJson, err := normalizeJson(expect)
+	if err != nil {
+		this.t.Error(this.name, "invalid expect value on", path, err)
+		return this
+	}
+	if !reflect.DeepEqual(actual, expectJson) {
+		actualBytes, _ := json.Marshal(actual)
+		expectBytes, _ := json.Marshal(expectJson)
+		this.t.Error(this.name, path, "should be", string(expectBytes), "but", string(actualBytes))
+	}
+	return this
+}
+
+// Bind Unmarshal the data in kelp json response into out.
+func (this *Response) Bind(out interface{}) *Response {
+	this.t.Helper()
+	data, err := this.value("data")
+	if err != nil {
+		this.t.Error(this.name, err)
+		return this
+	}
+	raw, _ := json.Marshal(data)
+	if err := json.Unmarshal(raw, out); err != nil {
+		this.t.Error(this.name, "bind data failed", err)
+	}
+	return this
+}
+
+// Golden Compare the response body with the golden file testdata/<name>.golden,
+// json body is compared in indent form.
+// Run test with environment KELP_UPDATE_GOLDEN=1 to create or update golden files.
+func (this *Response) Golden(name string) *Response {
+	this.t.Helper()
+	content := this.Body
+	if _, err := this.parse(); err == nil {
+		indent := &bytes.Buffer{}
+		json.Indent(indent, this.Body, "", "  ")
+		content = append(indent.Bytes(), '\n')
+	}
+	file := filepath.Join("testdata", name+".golden")
+	if os.Getenv("KELP_UPDATE_GOLDEN") != "" {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			this.t.Fatal("kelptest: create golden dir failed", err)
+		}
+		if err := ioutil.WriteFile(file, content, 0644); err != nil {
+			this.t.Fatal("kelptest: write golden file failed", err)
+		}
+		return this
+	}
+	expect, err := ioutil.ReadFile(file)
+	if err != nil {
+		this.t.Error(this.name, "read golden file failed, run with KELP_UPDATE_GOLDEN=1 to create it", err)
+		return this
+	}
+	if !bytes.Equal(expect, content) {
+		this.t.Errorf("%s response does not match %s\nexpect:\n%s\nactual:\n%s", this.name, file, expect, content)
+	}
+	return this
+}
+
+func (this *Response) parse() (interface{}, error) {
+	if !this.hasParse {
+		this.hasParse = true
+		this.jsonErr = json.Unmarshal(this.Body, &this.json)
+	}
+	return this.json, this.jsonErr
+}
+
+func (this *Response) value(path string) (interface{}, error) {
+	current, err := this.parse()
+	if err != nil {
+		return nil, &pathError{path, "response is not json: " + err.Error()}
+	}
+	if path == "" {
+		return current, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, &pathError{path, "key " + key + " not found"}
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, &pathError{path, "index " + key + " out of range"}
+			}
+			current = node[index]
+		default:
+			return nil, &pathError{path, "can not find " + key + " in a value"}
+		}
+	}
+	return current, nil
+}
+
+type pathError struct {
+	path string
+	msg  string
+}
+
+func (this *pathError) Error() string {
+	return "kelptest: json path " + this.path + ": " + this.msg
+}
+
+// normalizeJson convert v into the form of json.Unmarshal into interface{}
+func normalizeJson(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal(raw, &ret)
+	return ret, err
+}
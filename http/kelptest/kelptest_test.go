@@ -0,0 +1,157 @@
+package kelptest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	gohttp "net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mapleque/kelp/http"
+	"github.com/mapleque/kelp/http/kelptest"
+)
+
+type echoParam struct {
+	Name string `json:"name" valid:"message=invalid name"`
+}
+
+type echoResponse struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+func newServer() *http.Server {
+	server := http.New("")
+	server.Handle("echo", "/echo", func(in *echoParam, out *echoResponse) {
+		out.Name = in.Name
+		out.Tags = []string{"a", "b"}
+	})
+	server.Handle("query", "/query", func(c *http.Context) {
+		c.Text(c.QueryDefault("name", "-") + "," + c.Request.Header.Get("Authorization"))
+	})
+	return server
+}
+
+func TestTester(t *testing.T) {
+	kt := kelptest.New(t, newServer()).Header("Authorization", "token")
+	defer kt.Close()
+
+	out := &echoResponse{}
+	kt.Post("/echo").Json(&echoParam{"kelp"}).Do().
+		HttpStatus(200).
+		Status(0).
+		Data("name", "kelp").
+		Data("tags.1", "b").
+		Data("", &echoResponse{"kelp", []string{"a", "b"}}).
+		Bind(out).
+		Golden("echo")
+	if out.Name != "kelp" || len(out.Tags) != 2 {
+		t.Error("wrong bind data", out)
+	}
+
+	kt.Post("/echo").Json(`{}`).Do().
+		Status(3).
+		Message("invalid name")
+
+	resp := kt.Get("/query").Query("name", "kelp").Do().HttpStatus(200)
+	if string(resp.Body) != "kelp,token" {
+		t.Error("wrong query response", string(resp.Body))
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixture.json")
+
+	// record with a real server
+	kt := kelptest.New(t, newServer())
+	recorder := kelptest.NewRecorder(fixture, kelptest.MODE_AUTO)
+	if recorder.Mode() != kelptest.MODE_RECORD {
+		t.Fatal("should record without fixture file")
+	}
+	client := http.NewKelpClient(kt.URL(), "token")
+	client.SetTransport(recorder)
+	out := &echoResponse{}
+	if err := client.Call("/echo", &echoParam{"kelp"}, out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	kt.Close()
+
+	// replay offline
+	recorder = kelptest.NewRecorder(fixture, kelptest.MODE_AUTO)
+	if recorder.Mode() != kelptest.MODE_REPLAY {
+		t.Fatal("should replay with fixture file")
+	}
+	client = http.NewKelpClient(kt.URL(), "token")
+	client.SetTransport(recorder)
+	out = &echoResponse{}
+	if err := client.Call("/echo", &echoParam{"kelp"}, out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "kelp" || len(out.Tags) != 2 {
+		t.Error("wrong replay data", out)
+	}
+	if err := client.Call("/echo", &echoParam{"other"}, out, nil); err == nil {
+		t.Error("unrecorded request should fail")
+	}
+
+	fixtureData, _ := ioutil.ReadFile(fixture)
+	if string(fixtureData) == "" || strings.Contains(string(fixtureData), "token") {
+		t.Error("fixture should not contain authorization", string(fixtureData))
+	}
+}
+
+type binaryTransport struct{}
+
+func (binaryTransport) RoundTrip(req *gohttp.Request) (*gohttp.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	return &gohttp.Response{
+		StatusCode: 200,
+		Header:     gohttp.Header{"Content-Type": {"application/octet-stream"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(append([]byte{0x1f, 0x8b, 0xff}, body...))),
+	}, nil
+}
+
+func TestRecorderBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixture.json")
+	payload := []byte{0x00, 0xfe, 0xff}
+	expect := []byte{0x1f, 0x8b, 0xff, 0x00, 0xfe, 0xff}
+
+	send := func(recorder *kelptest.Recorder) {
+		t.Helper()
+		body := ioutil.NopCloser(bytes.NewReader(payload))
+		req, _ := gohttp.NewRequest("POST", "http://kelp.test/binary", body)
+		resp, err := recorder.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != body {
+			t.Error("request of caller should not be modified")
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if !bytes.Equal(data, expect) {
+			t.Error("wrong binary response", data)
+		}
+	}
+
+	recorder := kelptest.NewRecorder(fixture, kelptest.MODE_RECORD).SetTransport(binaryTransport{})
+	send(recorder)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	send(kelptest.NewRecorder(fixture, kelptest.MODE_REPLAY))
+}
@@ -0,0 +1,211 @@
+package kelptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RecordMode Mode of Recorder.
+type RecordMode int
+
+const (
+	// MODE_REPLAY replay interactions from fixture file, never send real requests
+	MODE_REPLAY RecordMode = iota
+	// MODE_RECORD send real requests and record the interactions into fixture file
+	MODE_RECORD
+	// MODE_AUTO replay if the fixture file exists, or record
+	MODE_AUTO
+)
+
+// Recorder A http.RoundTripper which records interactions into a fixture file,
+// and replays them offline, use it by Client.SetTransport.
+//
+// The Authorization and Cookie headers of request are not recorded.
+// In replay mode, a request matches an interaction with the same method, url and body,
+// the same request recorded many times is replayed in order.
+type Recorder struct {
+	file      string
+	mode      RecordMode
+	transport http.RoundTripper
+
+	interactions []*Interaction
+	used         []bool
+	mux          *sync.Mutex
+}
+
+// Interaction A recorded request and its response.
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest The body is saved as base64 in fixture file,
+// so binary payloads (gzip, images, protobuf) are replayed byte by byte.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Url    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// RecordedResponse The body is saved as base64 in fixture file.
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// NewRecorder Create a Recorder with fixture file and mode.
+// It panics if the fixture file can not be loaded in replay mode.
+func NewRecorder(file string, mode RecordMode) *Recorder {
+	if mode == MODE_AUTO {
+		if _, err := os.Stat(file); err == nil {
+			mode = MODE_REPLAY
+		} else {
+			mode = MODE_RECORD
+		}
+	}
+	recorder := &Recorder{
+		file:         file,
+		mode:         mode,
+		transport:    http.DefaultTransport,
+		interactions: []*Interaction{},
+		mux:          new(sync.Mutex),
+	}
+	if mode == MODE_REPLAY {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(data, &recorder.interactions); err != nil {
+			panic(err)
+		}
+		recorder.used = make([]bool, len(recorder.interactions))
+	}
+	return recorder
+}
+
+// SetTransport Set the transport used to send real requests in record mode,
+// default is http.DefaultTransport.
+func (this *Recorder) SetTransport(transport http.RoundTripper) *Recorder {
+	this.transport = transport
+	return this
+}
+
+// Mode Return the real mode, MODE_AUTO has been resolved.
+func (this *Recorder) Mode() RecordMode {
+	return this.mode
+}
+
+// RoundTrip Implement http.RoundTripper.
+// The request of caller is not modified, a clone with the read body is sent.
+func (this *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody := []byte{}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = body
+	}
+	if this.mode == MODE_REPLAY {
+		return this.replay(req, reqBody)
+	}
+	clone := req.Clone(req.Context())
+	if req.Body != nil {
+		clone.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	return this.record(clone, reqBody)
+}
+
+func (this *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for i, interaction := range this.interactions {
+		if this.used[i] ||
+			interaction.Request.Method != req.Method ||
+			interaction.Request.Url != req.URL.String() ||
+			!bytes.Equal(interaction.Request.Body, body) {
+			continue
+		}
+		this.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header,
+			Body:          ioutil.NopCloser(bytes.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("kelptest: no recorded interaction for %s %s in %s", req.Method, req.URL.String(), this.file)
+}
+
+func (this *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := this.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.interactions = append(this.interactions, &Interaction{
+		Request: &RecordedRequest{
+			Method: req.Method,
+			Url:    req.URL.String(),
+			Header: recordedHeader(req.Header),
+			Body:   body,
+		},
+		Response: &RecordedResponse{
+			Status: resp.StatusCode,
+			Header: resp.Header,
+			Body:   respBody,
+		},
+	})
+	return resp, nil
+}
+
+// recordedHeader remove credentials from request header
+func recordedHeader(header http.Header) http.Header {
+	ret := http.Header{}
+	for key, values := range header {
+		if key == "Authorization" || key == "Cookie" {
+			continue
+		}
+		ret[key] = values
+	}
+	return ret
+}
+
+// Close Save the recorded interactions into fixture file in record mode.
+func (this *Recorder) Close() error {
+	if this.mode != MODE_RECORD {
+		return nil
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	data, err := json.MarshalIndent(this.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(this.file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(this.file, append(data, '\n'), 0644)
+}
@@ -13,6 +13,7 @@ type Router struct {
 	path         string
 	realPath     string
 	method       string
+	endpoint     bool
 	handlerChain []HandlerFunc
 	children     []*Router
 }
@@ -64,6 +65,7 @@ func (this *Router) Handle(title, path string, handlers ...HandlerFunc) *Router
 		title:        title,
 		path:         path,
 		realPath:     this.realPath + path,
+		endpoint:     true,
 		handlerChain: handlerChain,
 		children:     []*Router{},
 	}
@@ -20,6 +20,8 @@ type Server struct {
 	router  *Router
 	comment string
 
+	validAll bool
+
 	start time.Time
 }
 
@@ -50,6 +52,7 @@ func (this *Server) Run() {
 
 func (this *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	c := newContext(w, req)
+	c.validAll = this.validAll
 	this.handle(c)
 }
 
@@ -86,6 +89,12 @@ func (this *Server) Comment(comment string) {
 	this.comment = comment
 }
 
+// ValidAll 设置handler绑定参数时是否校验所有字段
+// 开启后，参数校验失败时会返回所有校验不通过的字段
+func (this *Server) ValidAll(all bool) {
+	this.validAll = all
+}
+
 func (this *Server) metric(c *Context) {
 	ret := map[string]interface{}{}
 	ret["hostname"] = os.Getenv("HOSTNAME")
@@ -19,7 +19,12 @@ var (
 	STATUS_NOT_FOUND    = &Status{404, "not found"}
 )
 
+// StatusInvalidParam 参数错误
+// 如果err是ValidErrors，message是所有校验错误的列表
 func StatusInvalidParam(err error) *Status {
+	if errs, ok := err.(ValidErrors); ok {
+		return &Status{3, errs}
+	}
 	return &Status{3, err.Error()}
 }
 
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -68,63 +69,6 @@ func assertValid(t *testing.T, c Case, err error) {
 	}
 }
 
-type validParseAssert struct {
-	isOptional bool
-	message    string
-	rulesValue []string
-	tagsStr    string
-}
-
-func TestValidParse(t *testing.T) {
-	for _, a := range []validParseAssert{
-		validParseAssert{false, "", []string{}, ""},
-		validParseAssert{false, "", []string{"func"}, "@func"},
-		validParseAssert{false, "", []string{"func1", "func2"}, "@func1,@func2"},
-		validParseAssert{false, "", []string{"1<=x<=2"}, "[1,2]"},
-		validParseAssert{false, "", []string{"-2<=x<=-1"}, "[-2,-1]"},
-		validParseAssert{false, "", []string{"1<x<=2"}, "(1,2]"},
-		validParseAssert{false, "", []string{"1<=x<2"}, "[1,2)"},
-		validParseAssert{false, "", []string{"1<x<2"}, "(1,2)"},
-		validParseAssert{false, "", []string{"1<x<"}, "(1,)"},
-		validParseAssert{false, "", []string{"<x<2"}, "(,2)"},
-		validParseAssert{false, "", []string{".*"}, "/.*/"},
-		validParseAssert{false, "", []string{`\d+`}, `/\d+/`},
-		validParseAssert{true, "", []string{}, "optional"},
-		validParseAssert{false, "aaa", []string{}, "message=aaa"},
-		validParseAssert{true, "", []string{"func"}, "@func,optional"},
-		validParseAssert{true, "", []string{"1<=x<=2"}, "[1,2],optional"},
-		validParseAssert{false, "", []string{"func", "1<=x<=2"}, "@func,[1,2]"},
-		validParseAssert{true, "", []string{"func", "1<=x<=2"}, "@func,[1,2],optional"},
-		validParseAssert{true, "hello 123", []string{"func", "1<=x<=2"}, "@func,[1,2],optional,message=hello 123"},
-	} {
-		if g, err := validParse(a.tagsStr); err != nil {
-			t.Error(err)
-		} else {
-			if a.isOptional != g.optional ||
-				a.message != g.message ||
-				len(a.rulesValue) != len(g.rules) {
-				t.Error(a, g, a.rulesValue, len(g.rules))
-			}
-			for _, r := range a.rulesValue {
-				if !hasRule(g.rules, r) {
-					for _, tr := range g.rules {
-						t.Error(r, "vs", tr.value())
-					}
-				}
-			}
-		}
-	}
-}
-
-func hasRule(rules []rule, value string) bool {
-	for _, rule := range rules {
-		if rule.value() == value {
-			return true
-		}
-	}
-	return false
-}
-
 type structForTestBind struct {
 	A int                   `json:"a" valid:"message=invalid a"`
 	B structSubForTestBind  `json:"b"`
@@ -153,3 +97,65 @@ func TestBindAndValidJson(t *testing.T) {
 		}
 	}
 }
+
+type structForTestValidAll struct {
+	Name  string                   `json:"name" valid:"(0,10],message=invalid name"`
+	Age   int                      `json:"age" valid:"[0,150]"`
+	Code  string                   `json:"code" valid:"/^\\d+$/,optional"`
+	Sub   structSubForTestValidAll `json:"sub"`
+	Slash string                   `json:"a/b" valid:""`
+}
+
+type structSubForTestValidAll struct {
+	D int `json:"d" valid:"[1,),message=invalid d in sub"`
+}
+
+func TestBindAndValidJsonAll(t *testing.T) {
+	err := BindAndValidJsonAll(&structForTestBind{}, []byte(`{"a":1,"b":{"d":1.3}}`))
+	if errs, ok := err.(ValidErrors); !ok || len(errs) != 1 ||
+		errs[0].Path != "/b/d" || errs[0].Rule != "type" || errs[0].Message != "invalid d in sub" {
+		t.Error("wrong type error", err)
+	}
+}
+
+func TestStatusInvalidParam(t *testing.T) {
+	server := New("")
+	server.ValidAll(true)
+	server.Handle("valid all", "/valid", func(in *structForTestValidAll) {})
+	ts := server.RunTest()
+	defer ts.Close()
+	_, body, err := NewClient(ts.URL).Request("/valid", "POST", []byte(`{"name":"a","age":-1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"status":3,"message":[` +
+		`{"path":"/age","rule":"range","params":["[0","150]"],"message":"age valid faild"},` +
+		`{"path":"/sub/d","rule":"required","params":[],"message":"invalid d in sub"},` +
+		`{"path":"/a~1b","rule":"required","params":[],"message":"a/b valid faild"}]}`
+	if string(body) != expect {
+		t.Error("wrong invalid param response", string(body))
+	}
+}
+
+func TestValidDoc(t *testing.T) {
+	param := reflect.TypeOf(struct {
+		A int               `valid:"(0,),message=invalid a"`
+		B string            `valid:"rune[1,10],optional"`
+		C []string          `valid:"[1,)" valid_elem:"in:a|b"`
+		D map[string]string `valid_key:"/^[a-z]+$/" valid_elem:"email"`
+		E string            `valid:"required_if:type=1,date"`
+		F int               `valid:"gtfield:a"`
+	}{})
+	for i, expect := range []string{
+		"必填, 0<x",
+		"可选, 字符数1<=x<=10",
+		"必填, 元素个数1<=x; 元素: 必填, 取值a|b之一",
+		"元素: 必填, 邮箱格式; key: 必填, 匹配/^[a-z]+$/",
+		"当type=1时必填, 日期格式2006-01-02",
+		"必填, 大于a",
+	} {
+		if doc := validDoc(param.Field(i), LOCALE_ZH); doc != expect {
+			t.Error("valid doc should be", expect, "but", doc)
+		}
+	}
+}
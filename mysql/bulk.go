@@ -0,0 +1,333 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	driver "github.com/go-sql-driver/mysql"
+
+	"github.com/mapleque/kelp/mysql/query"
+)
+
+const (
+	// DEFAULT_MAX_PACKET is the default max size of a bulk statement,
+	// which is the default max_allowed_packet of mysql 5.7
+	DEFAULT_MAX_PACKET = 4 << 20
+	// MAX_PLACEHOLDERS is the max count of placeholders in a prepared statement
+	MAX_PLACEHOLDERS = 65535
+)
+
+// BulkResult is the result of a chunk in bulk operations.
+// On a connector other than db, tx or cluster, such as FakeDB,
+// only LastInsertId of inserts and AffectedRows of other statements are returned.
+type BulkResult struct {
+	// Rows is the count of rows in the chunk
+	Rows int
+	// LastInsertId is the id generated for the first row of the chunk
+	LastInsertId int64
+	// AffectedRows is the count of affected rows,
+	// a row updated by ON DUPLICATE KEY UPDATE is counted as 2
+	AffectedRows int64
+}
+
+// executor is implemented by db and tx, which returns the sql.Result
+type executor interface {
+	exec(query string, args ...interface{}) (sql.Result, error)
+	execOnce(query string, args ...interface{}) (sql.Result, error)
+	prepare(query string) (*sql.Stmt, func(), error)
+}
+
+// Bulk inserts many rows with multi-row INSERT statements.
+// The rows are split into chunks, so that every statement is smaller than max packet,
+// and has no more than MAX_PLACEHOLDERS placeholders.
+//
+// Chunks are executed one by one, they are not atomic unless conn is a transaction.
+// A failed chunk is not sent again, because it may have been written.
+type Bulk struct {
+	conn      Connector
+	table     string
+	columns   []string
+	maxPacket int
+	ignore    bool
+	updates   []string
+}
+
+// NewBulk creates a bulk insert into table with columns.
+func NewBulk(conn Connector, table string, columns ...string) *Bulk {
+	return &Bulk{
+		conn:      conn,
+		table:     table,
+		columns:   columns,
+		maxPacket: DEFAULT_MAX_PACKET,
+	}
+}
+
+// MaxPacket sets the max size of a statement, which should not be larger than max_allowed_packet.
+func (this *Bulk) MaxPacket(size int) *Bulk {
+	this.maxPacket = size
+	return this
+}
+
+// Ignore uses INSERT IGNORE, rows conflict with primary or unique key are skipped.
+func (this *Bulk) Ignore() *Bulk {
+	this.ignore = true
+	return this
+}
+
+// OnDuplicateKeyUpdate updates columns with the inserted values
+// when a primary or unique key conflicts.
+func (this *Bulk) OnDuplicateKeyUpdate(columns ...string) *Bulk {
+	this.updates = columns
+	return this
+}
+
+// Insert inserts rows chunk by chunk, and returns the results of executed chunks.
+// If a chunk fails, it stops and returns the results of chunks before it with the error.
+func (this *Bulk) Insert(rows [][]interface{}) ([]*BulkResult, error) {
+	results := []*BulkResult{}
+	for _, chunk := range this.chunks(rows) {
+		builder := query.Insert(this.table).Columns(this.columns...)
+		if this.ignore {
+			builder.Ignore()
+		}
+		for _, row := range chunk {
+			builder.Values(row...)
+		}
+		if len(this.updates) > 0 {
+			builder.OnDuplicateKeyUpdate(this.updates...)
+		}
+		sql, args, err := builder.ToSql()
+		if err != nil {
+			return results, err
+		}
+		result, err := bulkExec(this.conn, "bulk", sql, args, true)
+		if err != nil {
+			return results, err
+		}
+		result.Rows = len(chunk)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// chunks splits rows by max packet and MAX_PLACEHOLDERS
+func (this *Bulk) chunks(rows [][]interface{}) [][][]interface{} {
+	// INSERT IGNORE INTO `table` (`a`, `b`) VALUES ... ON DUPLICATE KEY UPDATE `a` = VALUES(`a`)
+	base := 64 + len(this.table)
+	for _, column := range this.columns {
+		base += len(column) + 4
+	}
+	for _, column := range this.updates {
+		base += len(column)*2 + 16
+	}
+	chunks := [][][]interface{}{}
+	chunk := [][]interface{}{}
+	size, placeholders := base, 0
+	for _, row := range rows {
+		rowSize := 4
+		for _, v := range row {
+			rowSize += valueSize(v)
+		}
+		if len(chunk) > 0 && (size+rowSize > this.maxPacket || placeholders+len(row) > MAX_PLACEHOLDERS) {
+			chunks = append(chunks, chunk)
+			chunk = [][]interface{}{}
+			size, placeholders = base, 0
+		}
+		chunk = append(chunk, row)
+		size += rowSize
+		placeholders += len(row)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// valueSize estimates the size of a value in statement, including placeholder and separator
+func valueSize(v interface{}) int {
+	switch value := v.(type) {
+	case string:
+		return len(value) + 16
+	case []byte:
+		return len(value) + 16
+	}
+	return 32
+}
+
+// executorOf returns the db of a cluster or a node, whose writes go to the primary
+func executorOf(conn Connector) Connector {
+	conn = Primary(conn)
+	if n, ok := conn.(*node); ok {
+		atomic.AddUint64(&n.writes, 1)
+		return n.db
+	}
+	return conn
+}
+
+// bulkExec executes a statement and logs it as method like other queries,
+// the last insert id is returned only if insert is true
+func bulkExec(conn Connector, method, sql string, args []interface{}, insert bool) (*BulkResult, error) {
+	conn = executorOf(conn)
+	if e, ok := conn.(queryExecutor); ok {
+		entry := e.startLog(method, sql, args)
+		var result *BulkResult
+		ret, err := e.execOnce(sql, args...)
+		if err == nil {
+			result, err = bulkResult(ret, insert)
+		}
+		if err == nil {
+			entry.Rows = result.AffectedRows
+			if !insert {
+				result.LastInsertId = 0
+			}
+		}
+		e.finishLog(entry, err)
+		return result, err
+	}
+	// other connectors, such as FakeDB, only return one of them
+	if insert {
+		lastId, err := conn.Insert(sql, args...)
+		return &BulkResult{LastInsertId: lastId}, err
+	}
+	affected, err := conn.Execute(sql, args...)
+	return &BulkResult{AffectedRows: affected}, err
+}
+
+// ExecuteBatch prepares sql once and executes it with every params,
+// and returns the result of every execution, the Rows of result is 1.
+// If an execution fails, it stops and returns the results before it with the error.
+func ExecuteBatch(conn Connector, sql string, params [][]interface{}) ([]*BulkResult, error) {
+	results := []*BulkResult{}
+	conn = executorOf(conn)
+	e, ok := conn.(queryExecutor)
+	if !ok {
+		for _, args := range params {
+			result, err := bulkExec(conn, "batch", sql, args, false)
+			if err != nil {
+				return results, err
+			}
+			result.Rows = 1
+			results = append(results, result)
+		}
+		return results, nil
+	}
+	stmt, release, err := e.prepare(sql)
+	if err != nil {
+		entry := e.startLog("batch", sql, nil)
+		e.finishLog(entry, err)
+		return results, err
+	}
+	defer release()
+	for _, args := range params {
+		entry := e.startLog("batch", sql, args)
+		var result *BulkResult
+		ret, err := stmt.Exec(args...)
+		if err == nil {
+			result, err = bulkResult(ret, false)
+		}
+		if err == nil {
+			entry.Rows = result.AffectedRows
+		}
+		e.finishLog(entry, err)
+		if err != nil {
+			return results, err
+		}
+		result.Rows = 1
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// bulkResult converts the result of a statement,
+// the error of LastInsertId is returned only if insert is true,
+// otherwise LastInsertId is 0 if the statement is not an insert
+func bulkResult(ret sql.Result, insert bool) (*BulkResult, error) {
+	var err error
+	result := &BulkResult{}
+	if result.LastInsertId, err = ret.LastInsertId(); err != nil && insert {
+		return nil, err
+	}
+	if result.AffectedRows, err = ret.RowsAffected(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LoadDataOption is the format of data loaded by LoadData, the zero value is csv format
+type LoadDataOption struct {
+	// FieldsTerminatedBy default is ,
+	FieldsTerminatedBy string
+	// EnclosedBy default is ", set it to a space to disable it
+	EnclosedBy string
+	// LinesTerminatedBy default is \n
+	LinesTerminatedBy string
+	// IgnoreLines is the count of header lines to skip
+	IgnoreLines int
+	// Replace replaces rows conflict with primary or unique key, otherwise they are skipped
+	Replace bool
+}
+
+// LoadData streams data from reader into table with LOAD DATA LOCAL INFILE,
+// and returns the result with affected rows.
+// The server should enable local_infile.
+func LoadData(conn Connector, table string, reader io.Reader, option *LoadDataOption, columns ...string) (*BulkResult, error) {
+	name := "kelp_" + token()
+	driver.RegisterReaderHandler(name, func() io.Reader {
+		return reader
+	})
+	defer driver.DeregisterReaderHandler(name)
+	sql := loadDataSql(name, table, option, columns)
+	return bulkExec(conn, "loaddata", sql, nil, false)
+}
+
+func loadDataSql(name, table string, option *LoadDataOption, columns []string) string {
+	if option == nil {
+		option = &LoadDataOption{}
+	}
+	fields, enclosed, lines := option.FieldsTerminatedBy, option.EnclosedBy, option.LinesTerminatedBy
+	if fields == "" {
+		fields = ","
+	}
+	if enclosed == "" {
+		enclosed = `"`
+	}
+	if lines == "" {
+		lines = "\n"
+	}
+	sql := "LOAD DATA LOCAL INFILE 'Reader::" + name + "'"
+	if option.Replace {
+		sql += " REPLACE"
+	} else {
+		sql += " IGNORE"
+	}
+	sql += " INTO TABLE " + query.Quote(table) +
+		" FIELDS TERMINATED BY " + quoteString(fields)
+	if strings.TrimSpace(enclosed) != "" {
+		sql += " OPTIONALLY ENCLOSED BY " + quoteString(enclosed)
+	}
+	sql += " LINES TERMINATED BY " + quoteString(lines)
+	if option.IgnoreLines > 0 {
+		sql += fmt.Sprintf(" IGNORE %d LINES", option.IgnoreLines)
+	}
+	if len(columns) > 0 {
+		quoted := []string{}
+		for _, column := range columns {
+			quoted = append(quoted, query.Quote(column))
+		}
+		sql += " (" + strings.Join(quoted, ", ") + ")"
+	}
+	return sql
+}
+
+// quoteString quotes a string literal in sql
+func quoteString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "'", `\'`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	s = strings.Replace(s, "\r", `\r`, -1)
+	s = strings.Replace(s, "\t", `\t`, -1)
+	return "'" + s + "'"
+}
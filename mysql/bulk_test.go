@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBulkInsert(t *testing.T) {
+	conn := &recordConnector{}
+	rows := [][]interface{}{}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, []interface{}{i, strings.Repeat("a", 100)})
+	}
+	// every row is about 150 bytes
+	results, err := NewBulk(conn, "user", "id", "name").
+		MaxPacket(450).
+		OnDuplicateKeyUpdate("name").
+		Insert(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Rows != 2 || results[2].Rows != 1 || results[0].LastInsertId != 7 {
+		t.Error("wrong chunks", len(results))
+	}
+	if len(conn.statements) != 3 {
+		t.Fatal("wrong statements", len(conn.statements))
+	}
+	conn.assert(t, "INSERT INTO `user` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)", 4, strings.Repeat("a", 100))
+	if sql := conn.statements[0].sql; sql != "INSERT INTO `user` (`id`, `name`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)" {
+		t.Error("wrong chunk sql", sql)
+	}
+
+	// placeholders limit
+	bulk := NewBulk(conn, "user", "id", "name").MaxPacket(1 << 30)
+	rows = make([][]interface{}, MAX_PLACEHOLDERS)
+	for i := range rows {
+		rows[i] = []interface{}{i, "a"}
+	}
+	chunks := bulk.chunks(rows)
+	if len(chunks) != 3 || len(chunks[0]) != MAX_PLACEHOLDERS/2 {
+		t.Error("wrong chunks of placeholders limit", len(chunks), len(chunks[0]))
+	}
+
+	if results, err := NewBulk(conn, "user", "id").Insert(nil); err != nil || len(results) != 0 {
+		t.Error("insert nothing should do nothing", results, err)
+	}
+}
+
+func TestExecuteBatch(t *testing.T) {
+	conn := &recordConnector{}
+	results, err := ExecuteBatch(conn, "UPDATE `user` SET `name` = ? WHERE `id` = ?", [][]interface{}{
+		{"a", 1},
+		{"b", 2},
+	})
+	if err != nil || len(results) != 2 || results[1].AffectedRows != 1 || results[1].Rows != 1 {
+		t.Error("wrong batch results", results, err)
+	}
+	conn.assert(t, "UPDATE `user` SET `name` = ? WHERE `id` = ?", "b", 2)
+}
+
+func TestLoadDataSql(t *testing.T) {
+	sql := loadDataSql("r", "user", nil, []string{"id", "name"})
+	expect := "LOAD DATA LOCAL INFILE 'Reader::r' IGNORE INTO TABLE `user` FIELDS TERMINATED BY ',' " +
+		`OPTIONALLY ENCLOSED BY '"' LINES TERMINATED BY '\n' (` + "`id`, `name`)"
+	if sql != expect {
+		t.Error("wrong load data sql", sql)
+	}
+	sql = loadDataSql("r", "user", &LoadDataOption{
+		FieldsTerminatedBy: "\t",
+		EnclosedBy:         " ",
+		LinesTerminatedBy:  "\r\n",
+		IgnoreLines:        1,
+		Replace:            true,
+	}, nil)
+	expect = "LOAD DATA LOCAL INFILE 'Reader::r' REPLACE INTO TABLE `user` FIELDS TERMINATED BY '\\t' " +
+		"LINES TERMINATED BY '\\r\\n' IGNORE 1 LINES"
+	if sql != expect {
+		t.Error("wrong load data sql with option", sql)
+	}
+}
+
+func TestBulkOnCluster(t *testing.T) {
+	primary, d := newCountNode("kelp_bulk_primary")
+	replica, _ := newCountNode("kelp_bulk_replica")
+	c := &cluster{name: "bulk", primary: primary, replicas: []*node{replica}}
+	d.affected = 2
+	results, err := NewBulk(c, "user", "id").Insert([][]interface{}{{1}, {2}})
+	if err != nil || len(results) != 1 || results[0].AffectedRows != 2 {
+		t.Error("affected rows should be returned on cluster", results, err)
+	}
+	batch, err := ExecuteBatch(c, "UPDATE `user` SET `id` = ?", [][]interface{}{{1}})
+	if err != nil || len(batch) != 1 || batch[0].AffectedRows != 2 {
+		t.Error("affected rows should be returned on cluster", batch, err)
+	}
+	if stats := primary.stats(); stats.Writes != 2 || replica.stats().Writes != 0 {
+		t.Error("bulk should write on primary", stats.Writes)
+	}
+}
+
+func TestBulkNoRetry(t *testing.T) {
+	testNode, d := newCountNode("kelp_bulk_retry")
+	d.execErr = errors.New("connection lost")
+	if _, err := NewBulk(testNode.db, "user", "id").Insert([][]interface{}{{1}, {2}}); err == nil || d.execs != 1 {
+		t.Error("failed bulk insert should not be sent again", d.execs, err)
+	}
+	d.execs = 0
+	if _, err := LoadData(testNode.db, "user", strings.NewReader("1\n"), nil); err == nil || d.execs != 1 {
+		t.Error("failed load data should not be sent again", d.execs, err)
+	}
+	d.execs = 0
+	if _, err := testNode.db.Execute("UPDATE `user` SET `id` = 1"); err == nil || d.execs != 2 {
+		t.Error("execute should still retry once", d.execs, err)
+	}
+}
+
+func TestBulkQueryLog(t *testing.T) {
+	testNode, d := newCountNode("kelp_bulk_log")
+	d.affected = 2
+	Add("bulklog", testNode.db)
+	logs := []*QueryLog{}
+	SetQueryLogOption("bulklog", &QueryLogOption{
+		RedactColumns: []string{"password"},
+		Handler:       func(log *QueryLog) { logs = append(logs, log) },
+	})
+	conn := GetContext(WithTraceId(context.Background(), "trace-bulk"), "bulklog")
+	NewBulk(conn, "user", "name", "password").Insert([][]interface{}{{"a", "s1"}, {"b", "s2"}})
+	ExecuteBatch(conn, "UPDATE `user` SET `password` = ? WHERE `id` = ?", [][]interface{}{{"s3", 1}})
+	LoadData(conn, "user", strings.NewReader("a,s4\n"), nil)
+	if len(logs) != 3 {
+		t.Fatal("bulk statements should be logged", logs)
+	}
+	for i, method := range []string{"bulk", "batch", "loaddata"} {
+		if logs[i].Method != method || logs[i].TraceId != "trace-bulk" || logs[i].Rows != 2 {
+			t.Error("wrong log of", method, logs[i])
+		}
+	}
+	if fmt.Sprint(logs[0].Params) != fmt.Sprint([]interface{}{"a", REDACTED, "b", REDACTED}) ||
+		fmt.Sprint(logs[1].Params) != fmt.Sprint([]interface{}{REDACTED, 1}) {
+		t.Error("password should be redacted", logs[0].Params, logs[1].Params)
+	}
+}
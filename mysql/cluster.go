@@ -0,0 +1,356 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// CLUSTER_CHECK_INTERVAL is the interval of pinging databases in cluster,
+// which is used by clusters added after it is changed.
+var CLUSTER_CHECK_INTERVAL = 5 * time.Second
+
+// CLUSTER_CHECK_TIMEOUT is the timeout of pinging a database in cluster
+var CLUSTER_CHECK_TIMEOUT = time.Second
+
+// cluster is a Connector of one primary and several replicas.
+// Reads are load-balanced to healthy replicas, writes and transactions go to the primary.
+type cluster struct {
+	name     string
+	primary  *node
+	replicas []*node
+	next     uint64
+	// origin is the cluster copied by withTraceId, whose next is shared
+	origin *cluster
+	// stop stops checking databases
+	stop chan struct{}
+}
+
+// node is a database in cluster
+type node struct {
+	*db
+	*nodeState
+}
+
+// nodeState is the health and statistics of a node, which is shared by its copies
+type nodeState struct {
+	addr    string
+	healthy int32
+	reads   uint64
+	writes  uint64
+	mux     sync.Mutex
+	lastErr string
+}
+
+// ClusterStats is the topology and statistics of a cluster
+type ClusterStats struct {
+	Primary  *NodeStats
+	Replicas []*NodeStats
+}
+
+// NodeStats is the statistics of a database in cluster
+type NodeStats struct {
+	// Addr is the host and port of database
+	Addr string
+	// Healthy is the result of last ping, an unhealthy primary still serves writes
+	Healthy bool
+	// Reads is the count of Query, QueryOne and QueryRows
+	Reads uint64
+	// Writes is the count of Insert, Execute and transactions
+	Writes    uint64
+	LastError string
+	Conns     sql.DBStats
+	Stmts     *StmtStats
+}
+
+type contextKey int
+
+const primaryContextKey contextKey = iota
+
+// AddCluster opens a primary and several replicas, and stores them into pool as one Connector.
+// The databases are pinged every CLUSTER_CHECK_INTERVAL, unhealthy replicas do not serve reads
+// until they are healthy again. If no replica is healthy, reads go to the primary.
+// The cluster added with the same name before is closed.
+func AddCluster(name, primary string, replicas []string, maxOpen, maxIdle int) error {
+	c, err := newCluster(name, primary, replicas, maxOpen, maxIdle)
+	if err != nil {
+		return err
+	}
+	addCluster(name, c)
+	return nil
+}
+
+// addCluster stores c into pool, and closes the cluster replaced by it
+func addCluster(name string, c *cluster) {
+	old, _ := p.store[name].(*cluster)
+	p.store[name] = c
+	if old != nil {
+		old.close()
+	}
+	if CLUSTER_CHECK_INTERVAL > 0 {
+		go c.run(CLUSTER_CHECK_INTERVAL)
+	}
+}
+
+func newCluster(name, primary string, replicas []string, maxOpen, maxIdle int) (*cluster, error) {
+	c := &cluster{name: name, stop: make(chan struct{})}
+	primaryDB, err := openDB(name+"-primary", primary, maxOpen, maxIdle)
+	if err != nil {
+		return nil, err
+	}
+	c.primary = newNode(primaryDB, primary)
+	for i, dsn := range replicas {
+		replicaDB, err := openDB(name+"-replica-"+strconv.Itoa(i), dsn, maxOpen, maxIdle)
+		if err != nil {
+			// close the databases opened
+			c.primary.conn.Close()
+			for _, replica := range c.replicas {
+				replica.conn.Close()
+			}
+			return nil, err
+		}
+		c.replicas = append(c.replicas, newNode(replicaDB, dsn))
+	}
+	return c, nil
+}
+
+func newNode(conn *db, dsn string) *node {
+	n := &node{db: conn, nodeState: &nodeState{addr: dsn, healthy: 1}}
+	// do not expose user and password
+	if cfg, err := driver.ParseDSN(dsn); err == nil {
+		n.addr = cfg.Addr
+	}
+	return n
+}
+
+// UsePrimary returns a context whose reads go to the primary, used to read your writes:
+//
+//	ctx = mysql.UsePrimary(ctx)
+//	conn := mysql.GetContext(ctx, "db")
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey, true)
+}
+
+// GetContext returns the Connector of name, which is the primary of a cluster
+// if ctx is returned by UsePrimary, and logs queries with the trace id set by WithTraceId.
+func GetContext(ctx context.Context, name string) Connector {
+	conn := Get(name)
+	if c, ok := conn.(*cluster); ok {
+		if force, _ := ctx.Value(primaryContextKey).(bool); force {
+			conn = c.primary
+		}
+	}
+	if traceId, _ := ctx.Value(traceIdContextKey).(string); traceId != "" {
+		conn = withTraceId(conn, traceId)
+	}
+	return conn
+}
+
+// Primary returns the primary of conn if it is a cluster added by AddCluster, otherwise conn itself.
+// It is used to read your writes when there is no context, such as in migrations.
+func Primary(conn Connector) Connector {
+	if c, ok := conn.(*cluster); ok {
+		return c.primary
+	}
+	return conn
+}
+
+// GetClusterStats returns the topology and statistics of cluster added by AddCluster,
+// it returns nil if there is no such cluster.
+func GetClusterStats(name string) *ClusterStats {
+	c, ok := p.store[name].(*cluster)
+	if !ok {
+		return nil
+	}
+	stats := &ClusterStats{Primary: c.primary.stats()}
+	for _, replica := range c.replicas {
+		stats.Replicas = append(stats.Replicas, replica.stats())
+	}
+	return stats
+}
+
+// run checks the databases every interval until the cluster is closed
+func (this *cluster) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stop:
+			return
+		case <-ticker.C:
+			this.check()
+		}
+	}
+}
+
+// close stops checking the databases, and closes the databases and their cached statements
+func (this *cluster) close() {
+	select {
+	case <-this.stop:
+	default:
+		close(this.stop)
+		for _, n := range append([]*node{this.primary}, this.replicas...) {
+			n.stmts.clear()
+			n.conn.Close()
+		}
+	}
+}
+
+// check pings the primary and every replica concurrently with CLUSTER_CHECK_TIMEOUT,
+// and ejects the replicas failed
+func (this *cluster) check() {
+	wg := sync.WaitGroup{}
+	for _, n := range append([]*node{this.primary}, this.replicas...) {
+		wg.Add(1)
+		go func(n *node) {
+			defer wg.Done()
+			ctx := context.Background()
+			if CLUSTER_CHECK_TIMEOUT > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, CLUSTER_CHECK_TIMEOUT)
+				defer cancel()
+			}
+			n.setHealth(n.conn.PingContext(ctx))
+		}(n)
+	}
+	wg.Wait()
+}
+
+// reader returns a healthy replica by round robin, or the primary if no replica is healthy
+func (this *cluster) reader() *node {
+	count := len(this.replicas)
+	start := atomic.AddUint64(&this.source().next, 1)
+	for i := 0; i < count; i++ {
+		replica := this.replicas[(start+uint64(i))%uint64(count)]
+		if replica.isHealthy() {
+			return replica
+		}
+	}
+	return this.primary
+}
+
+// source returns the cluster added into pool
+func (this *cluster) source() *cluster {
+	if this.origin != nil {
+		return this.origin
+	}
+	return this
+}
+
+func (this *node) isHealthy() bool {
+	return atomic.LoadInt32(&this.healthy) == 1
+}
+
+func (this *node) setHealth(err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if err != nil {
+		this.lastErr = err.Error()
+		if atomic.SwapInt32(&this.healthy, 0) == 1 {
+			log.Warn(this.name, "unhealthy", this.addr, err)
+		}
+		return
+	}
+	if atomic.SwapInt32(&this.healthy, 1) == 0 {
+		log.Warn(this.name, "recover", this.addr)
+	}
+}
+
+func (this *node) stats() *NodeStats {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return &NodeStats{
+		Addr:      this.addr,
+		Healthy:   this.isHealthy(),
+		Reads:     atomic.LoadUint64(&this.reads),
+		Writes:    atomic.LoadUint64(&this.writes),
+		LastError: this.lastErr,
+		Conns:     this.conn.Stats(),
+		Stmts:     this.stmts.stats(),
+	}
+}
+
+func (this *node) Query(destList interface{}, sql string, params ...interface{}) error {
+	atomic.AddUint64(&this.reads, 1)
+	return this.db.Query(destList, sql, params...)
+}
+
+func (this *node) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	atomic.AddUint64(&this.reads, 1)
+	return this.db.QueryOne(destObject, sql, params...)
+}
+
+func (this *node) QueryRows(sql string, params ...interface{}) (*Rows, error) {
+	atomic.AddUint64(&this.reads, 1)
+	return this.db.QueryRows(sql, params...)
+}
+
+func (this *node) Insert(sql string, params ...interface{}) (int64, error) {
+	atomic.AddUint64(&this.writes, 1)
+	return this.db.Insert(sql, params...)
+}
+
+func (this *node) Execute(sql string, params ...interface{}) (int64, error) {
+	atomic.AddUint64(&this.writes, 1)
+	return this.db.Execute(sql, params...)
+}
+
+func (this *node) Begin() (Connector, error) {
+	atomic.AddUint64(&this.writes, 1)
+	return this.db.Begin()
+}
+
+func (this *node) BeginTx(option *TxOption) (Connector, error) {
+	atomic.AddUint64(&this.writes, 1)
+	return this.db.BeginTx(option)
+}
+
+// Begin starts a transaction on the primary
+func (this *cluster) Begin() (Connector, error) {
+	return this.primary.Begin()
+}
+
+// BeginTx starts a transaction with option on the primary
+func (this *cluster) BeginTx(option *TxOption) (Connector, error) {
+	return this.primary.BeginTx(option)
+}
+
+// Commit is not allow to cluster, which is not a transaction
+func (this *cluster) Commit() error {
+	return this.primary.Commit()
+}
+
+// Rollback is not allow to cluster, which is not a transaction
+func (this *cluster) Rollback() error {
+	return this.primary.Rollback()
+}
+
+// Query queries on a replica
+func (this *cluster) Query(destList interface{}, sql string, params ...interface{}) error {
+	return this.reader().Query(destList, sql, params...)
+}
+
+// QueryOne queries on a replica
+func (this *cluster) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	return this.reader().QueryOne(destObject, sql, params...)
+}
+
+// QueryRows queries rows on a replica
+func (this *cluster) QueryRows(sql string, params ...interface{}) (*Rows, error) {
+	return this.reader().QueryRows(sql, params...)
+}
+
+// Insert inserts on the primary
+func (this *cluster) Insert(sql string, params ...interface{}) (int64, error) {
+	return this.primary.Insert(sql, params...)
+}
+
+// Execute executes on the primary
+func (this *cluster) Execute(sql string, params ...interface{}) (int64, error) {
+	return this.primary.Execute(sql, params...)
+}
@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func newCountNode(name string) (*node, *countDriver) {
+	d := &countDriver{}
+	sql.Register(name, d)
+	conn, _ := sql.Open(name, "")
+	return newNode(&db{name: name, conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}, "user:password@tcp(127.0.0.1:3306)/kelp"), d
+}
+
+func TestCluster(t *testing.T) {
+	primary, _ := newCountNode("kelp_primary")
+	replica1, d1 := newCountNode("kelp_replica1")
+	replica2, _ := newCountNode("kelp_replica2")
+	c := &cluster{name: "cluster", primary: primary, replicas: []*node{replica1, replica2}}
+	Add("cluster", c)
+
+	list := []*struct{}{}
+	for i := 0; i < 4; i++ {
+		c.Query(&list, "SELECT")
+	}
+	c.Execute("UPDATE")
+	c.Insert("INSERT")
+	WithTx(c, func(tx Connector) error {
+		return tx.Query(&list, "SELECT")
+	})
+	if Primary(c) != primary || Primary(primary.db) != primary.db {
+		t.Error("wrong primary")
+	}
+	stats := GetClusterStats("cluster")
+	if stats.Replicas[0].Reads != 2 || stats.Replicas[1].Reads != 2 || stats.Primary.Reads != 0 {
+		t.Error("reads should be balanced to replicas", stats.Replicas[0].Reads, stats.Replicas[1].Reads)
+	}
+	if stats.Primary.Writes != 3 || stats.Replicas[0].Writes != 0 {
+		t.Error("writes and transactions should go to primary", stats.Primary.Writes)
+	}
+	if stats.Primary.Addr != "127.0.0.1:3306" {
+		t.Error("addr should not expose password", stats.Primary.Addr)
+	}
+
+	// eject unhealthy replica
+	d1.down = true
+	c.check()
+	for i := 0; i < 2; i++ {
+		c.Query(&list, "SELECT")
+	}
+	stats = GetClusterStats("cluster")
+	if stats.Replicas[0].Healthy || stats.Replicas[0].LastError == "" || stats.Replicas[0].Reads != 2 || stats.Replicas[1].Reads != 4 {
+		t.Error("unhealthy replica should be ejected", stats.Replicas[0])
+	}
+	d1.down = false
+	c.check()
+	if !GetClusterStats("cluster").Replicas[0].Healthy {
+		t.Error("replica should recover")
+	}
+
+	// read your writes
+	GetContext(UsePrimary(context.Background()), "cluster").Query(&list, "SELECT")
+	GetContext(context.Background(), "cluster").Query(&list, "SELECT")
+	if GetClusterStats("cluster").Primary.Reads != 1 {
+		t.Error("context should force primary")
+	}
+
+	// no healthy replica
+	replica1.setHealth(sql.ErrConnDone)
+	replica2.setHealth(sql.ErrConnDone)
+	if c.reader() != primary {
+		t.Error("reads should go to primary without healthy replica")
+	}
+}
+
+func TestClusterCheck(t *testing.T) {
+	primary, d := newCountNode("kelp_check_primary")
+	replica1, d1 := newCountNode("kelp_check_replica1")
+	replica2, _ := newCountNode("kelp_check_replica2")
+	c := &cluster{name: "check", primary: primary, replicas: []*node{replica1, replica2}, stop: make(chan struct{})}
+	timeout := CLUSTER_CHECK_TIMEOUT
+	CLUSTER_CHECK_TIMEOUT = 50 * time.Millisecond
+	defer func() { CLUSTER_CHECK_TIMEOUT = timeout }()
+
+	// a hung replica does not stall the others
+	d.down = true
+	d1.hang = true
+	start := time.Now()
+	c.check()
+	if time.Since(start) > time.Second {
+		t.Error("check should time out", time.Since(start))
+	}
+	if primary.isHealthy() || replica1.isHealthy() || !replica2.isHealthy() {
+		t.Error("wrong health", primary.stats(), replica1.stats(), replica2.stats())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.run(time.Millisecond)
+		close(done)
+	}()
+	c.close()
+	c.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("run should stop after close")
+	}
+}
+
+func TestAddClusterReplace(t *testing.T) {
+	primary, _ := newCountNode("kelp_replace_primary")
+	replica, d := newCountNode("kelp_replace_replica")
+	old := &cluster{name: "replace", primary: primary, replicas: []*node{replica}, stop: make(chan struct{})}
+	addCluster("replace", old)
+	list := []*struct{}{}
+	if err := Get("replace").Query(&list, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	newPrimary, _ := newCountNode("kelp_replace_new")
+	addCluster("replace", &cluster{name: "replace", primary: newPrimary, stop: make(chan struct{})})
+	defer Get("replace").(*cluster).close()
+	if Get("replace").(*cluster).primary != newPrimary {
+		t.Fatal("cluster should be replaced")
+	}
+	if primary.stmts.stats().Size != 0 || replica.stmts.stats().Size != 0 || d.prepared != 1 || d.closed != 1 {
+		t.Error("cached statements of old cluster should be closed", d.prepared, d.closed)
+	}
+	for _, n := range []*node{primary, replica} {
+		if err := n.conn.Ping(); err == nil {
+			t.Error("databases of old cluster should be closed")
+		}
+	}
+}
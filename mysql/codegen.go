@@ -0,0 +1,330 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ModelOption is the option of GenerateModels
+type ModelOption struct {
+	// Package is the package name of generated files, the default is model
+	Package string
+	// Tables are the tables to generate, the default is all tables in current database
+	Tables []string
+}
+
+// informationTable is a row of information_schema.TABLES
+type informationTable struct {
+	TableName    string `json:"table_name"`
+	TableComment string `json:"table_comment"`
+}
+
+// queryInformationTables queries the base tables in current database
+func queryInformationTables(conn Connector) ([]*informationTable, error) {
+	tables := []*informationTable{}
+	err := conn.Query(
+		&tables,
+		"SELECT TABLE_NAME AS table_name, TABLE_COMMENT AS table_comment "+
+			"FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME",
+	)
+	return tables, err
+}
+
+// GenerateModels reads the tables in current database from information_schema,
+// and returns go source of model structs, the key is the file name <table>.go.
+//
+// The fields have column, json and column_schema tags, so the structs can be used by NewTable,
+// Repo and the row scanner. Nullable columns are pointers except []byte and json.RawMessage.
+// Primary keys, indexes and foreign keys are declared by tags, comments are taken from
+// table and column comments.
+func GenerateModels(conn Connector, option *ModelOption) (map[string][]byte, error) {
+	if option == nil {
+		option = &ModelOption{}
+	}
+	pkg := option.Package
+	if pkg == "" {
+		pkg = "model"
+	}
+	tables, err := queryInformationTables(conn)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := queryInformationColumns(conn)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := queryInformationIndexes(conn)
+	if err != nil {
+		return nil, err
+	}
+	foreignKeys, err := queryInformationForeignKeys(conn)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, table := range tables {
+		if len(option.Tables) > 0 && !contains(option.Tables, table.TableName) {
+			continue
+		}
+		model := &modelSource{table: table}
+		for _, column := range columns {
+			if column.TableName == table.TableName {
+				model.columns = append(model.columns, column)
+			}
+		}
+		for _, index := range indexes {
+			if index.TableName == table.TableName {
+				model.indexes = append(model.indexes, index)
+			}
+		}
+		for _, foreignKey := range foreignKeys {
+			if foreignKey.TableName == table.TableName {
+				model.foreignKeys = append(model.foreignKeys, foreignKey)
+			}
+		}
+		source, err := model.generate(pkg)
+		if err != nil {
+			return nil, err
+		}
+		files[table.TableName+".go"] = source
+	}
+	return files, nil
+}
+
+// ModelsToFiles generates models by GenerateModels and writes them into dir.
+func ModelsToFiles(conn Connector, dir string, option *ModelOption) error {
+	files, err := GenerateModels(conn, option)
+	if err != nil {
+		return err
+	}
+	for name, source := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), source, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modelSource generates the model of a table
+type modelSource struct {
+	table       *informationTable
+	columns     []*informationColumn
+	indexes     []*informationIndex
+	foreignKeys []*informationForeignKey
+}
+
+func (this *modelSource) generate(pkg string) ([]byte, error) {
+	name := goName(this.table.TableName)
+	imports := map[string]bool{}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// %s is the model of table %s", name, this.table.TableName)
+	if this.table.TableComment != "" {
+		fmt.Fprintf(buf, ", %s", oneLine(this.table.TableComment))
+	}
+	buf.WriteString("\n")
+	if getTableNameFromTypeName(name) != this.table.TableName {
+		fmt.Fprintf(buf, "// The table name can not be derived from the struct name, use Table.SetName(%q).\n", this.table.TableName)
+	}
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	primary := this.indexColumns("PRIMARY")
+	for _, column := range this.columns {
+		goType, pkgPath := goType(column)
+		if pkgPath != "" {
+			imports[pkgPath] = true
+		}
+		if column.ColumnComment != "" {
+			fmt.Fprintf(buf, "\t// %s\n", oneLine(column.ColumnComment))
+		}
+		tags := []string{
+			fmt.Sprintf("column:%q", column.ColumnName),
+			fmt.Sprintf("json:%q", column.ColumnName),
+			fmt.Sprintf("column_schema:%q", this.columnSchema(column, primary)),
+		}
+		if len(primary) > 1 && contains(primary, column.ColumnName) {
+			tags = append(tags, `primary_key:""`)
+		}
+		tags = append(tags, this.indexTags(column.ColumnName)...)
+		tags = append(tags, this.referenceTags(column.ColumnName)...)
+		fmt.Fprintf(buf, "\t%s %s %s\n", goName(column.ColumnName), goType, structTag(strings.Join(tags, " ")))
+	}
+	buf.WriteString("}\n")
+
+	source := &bytes.Buffer{}
+	fmt.Fprintf(source, "// Code generated by kelp mysql.GenerateModels from table %s.\n\npackage %s\n\n", this.table.TableName, pkg)
+	if len(imports) > 0 {
+		source.WriteString("import (\n")
+		for _, path := range []string{"encoding/json", "time"} {
+			if imports[path] {
+				fmt.Fprintf(source, "\t%q\n", path)
+			}
+		}
+		source.WriteString(")\n\n")
+	}
+	source.Write(buf.Bytes())
+	return format.Source(source.Bytes())
+}
+
+// columnSchema returns the column definition, a single primary key is declared in it
+func (this *modelSource) columnSchema(column *informationColumn, primary []string) string {
+	length := typeNameLength(column.ColumnType)
+	schema := strings.ToUpper(column.ColumnType[:length]) + column.ColumnType[length:]
+	definition := strings.TrimPrefix(column.definition(), column.ColumnType)
+	if len(primary) == 1 && primary[0] == column.ColumnName {
+		definition = strings.Replace(definition, " NOT NULL", " NOT NULL PRIMARY KEY", 1)
+	}
+	return schema + definition
+}
+
+// indexColumns returns the columns of index in order
+func (this *modelSource) indexColumns(name string) []string {
+	columns := []string{}
+	for _, index := range this.indexes {
+		if index.IndexName == name {
+			columns = append(columns, index.ColumnName)
+		}
+	}
+	return columns
+}
+
+// indexTags returns the index and unique tags of column.
+// The columns of a composite index are declared in the order of fields,
+// which may be different from the index if the table has been altered.
+func (this *modelSource) indexTags(column string) []string {
+	names := map[bool][]string{}
+	for _, index := range this.indexes {
+		// the index created for a foreign key is created again by the constraint
+		if index.ColumnName != column || index.IndexName == "PRIMARY" || this.isForeignKey(index.IndexName) {
+			continue
+		}
+		unique := index.NonUnique == 0
+		if index.IndexName == uniqueOrIndexPrefix(unique)+column {
+			names[unique] = append(names[unique], "")
+		} else {
+			names[unique] = append(names[unique], index.IndexName)
+		}
+	}
+	tags := []string{}
+	if list, exist := names[false]; exist {
+		tags = append(tags, fmt.Sprintf("index:%q", strings.Join(list, ",")))
+	}
+	if list, exist := names[true]; exist {
+		tags = append(tags, fmt.Sprintf("unique:%q", strings.Join(list, ",")))
+	}
+	return tags
+}
+
+// referenceTags returns the references tag of column if it is a single column foreign key
+func (this *modelSource) referenceTags(column string) []string {
+	for _, foreignKey := range this.foreignKeys {
+		if foreignKey.ColumnName != column {
+			continue
+		}
+		count := 0
+		for _, other := range this.foreignKeys {
+			if other.ConstraintName == foreignKey.ConstraintName {
+				count++
+			}
+		}
+		if count == 1 {
+			return []string{fmt.Sprintf("references:\"%s(%s)\"", foreignKey.ReferencedTableName, foreignKey.ReferencedColumnName)}
+		}
+	}
+	return nil
+}
+
+func (this *modelSource) isForeignKey(name string) bool {
+	for _, foreignKey := range this.foreignKeys {
+		if foreignKey.ConstraintName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueOrIndexPrefix(unique bool) string {
+	if unique {
+		return "uk_"
+	}
+	return "idx_"
+}
+
+var typeNameRegexp = regexp.MustCompile(`^[a-zA-Z]+`)
+
+func typeNameLength(columnType string) int {
+	return len(typeNameRegexp.FindString(columnType))
+}
+
+// goType returns the go type of column, and the package it needs
+func goType(column *informationColumn) (string, string) {
+	columnType := strings.ToLower(column.ColumnType)
+	name := typeNameRegexp.FindString(columnType)
+	unsigned := strings.Contains(columnType, "unsigned")
+	goType, pkgPath := "string", ""
+	switch name {
+	case "tinyint":
+		if strings.HasPrefix(columnType, "tinyint(1)") {
+			goType = "bool"
+		} else {
+			goType = "int8"
+		}
+	case "smallint", "year":
+		goType = "int16"
+	case "mediumint", "int", "integer":
+		goType = "int32"
+	case "bigint":
+		goType = "int64"
+	case "float":
+		goType = "float32"
+	case "double", "real":
+		goType = "float64"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit":
+		return "[]byte", ""
+	case "json":
+		return "json.RawMessage", "encoding/json"
+	case "date", "datetime", "timestamp":
+		goType, pkgPath = "time.Time", "time"
+	}
+	if unsigned && strings.HasPrefix(goType, "int") {
+		goType = "u" + goType
+	}
+	if column.IsNullable == "YES" {
+		goType = "*" + goType
+	}
+	return goType, pkgPath
+}
+
+var goNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// goName converts a snake case name to camel case, such as user_id to UserId
+func goName(name string) string {
+	words := goNameRegexp.Split(name, -1)
+	ret := ""
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		ret += strings.ToUpper(word[:1]) + strings.ToLower(word[1:])
+	}
+	if ret == "" || (ret[0] >= '0' && ret[0] <= '9') {
+		ret = "T" + ret
+	}
+	return ret
+}
+
+// structTag returns the tag literal, which is quoted if it contains a backquote
+func structTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,101 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestGenerateModels(t *testing.T) {
+	zero := "0"
+	now := "CURRENT_TIMESTAMP"
+	conn := &informationConnector{tables: []*informationTable{
+		{TableName: "order_item", TableComment: "items of\norder"},
+		{TableName: "log_2fa"},
+	}, columns: []*informationColumn{
+		{TableName: "order_item", ColumnName: "order_id", ColumnType: "bigint(20) unsigned", IsNullable: "NO"},
+		{TableName: "order_item", ColumnName: "sku", ColumnType: "varchar(32)", IsNullable: "NO", ColumnComment: "stock \"keeping\" unit"},
+		{TableName: "order_item", ColumnName: "count", ColumnType: "int(11)", IsNullable: "NO", ColumnDefault: &zero},
+		{TableName: "order_item", ColumnName: "price", ColumnType: "decimal(10,2)", IsNullable: "YES"},
+		{TableName: "order_item", ColumnName: "gift", ColumnType: "tinyint(1)", IsNullable: "YES"},
+		{TableName: "order_item", ColumnName: "extra", ColumnType: "json", IsNullable: "YES"},
+		{TableName: "order_item", ColumnName: "created_at", ColumnType: "datetime", IsNullable: "NO", ColumnDefault: &now, Extra: "DEFAULT_GENERATED"},
+		{TableName: "log_2fa", ColumnName: "id", ColumnType: "int unsigned", IsNullable: "NO", Extra: "auto_increment"},
+		{TableName: "log_2fa", ColumnName: "code", ColumnType: "char(6)", IsNullable: "YES"},
+	}, indexes: []*informationIndex{
+		{TableName: "order_item", IndexName: "PRIMARY", ColumnName: "order_id"},
+		{TableName: "order_item", IndexName: "PRIMARY", ColumnName: "sku"},
+		{TableName: "order_item", IndexName: "idx_sku", NonUnique: 1, ColumnName: "sku"},
+		{TableName: "order_item", IndexName: "idx_time", NonUnique: 1, ColumnName: "created_at"},
+		{TableName: "order_item", IndexName: "fk_order_item_order_id", NonUnique: 1, ColumnName: "order_id"},
+		{TableName: "log_2fa", IndexName: "PRIMARY", ColumnName: "id"},
+	}, foreignKeys: []*informationForeignKey{
+		{TableName: "order_item", ConstraintName: "fk_order_item_order_id", ColumnName: "order_id", ReferencedTableName: "order", ReferencedColumnName: "id"},
+	}}
+	files, err := GenerateModels(conn, &ModelOption{Package: "dao"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatal("wrong files", len(files))
+	}
+	expect := "// Code generated by kelp mysql.GenerateModels from table order_item.\n" +
+		"\n" +
+		"package dao\n" +
+		"\n" +
+		"import (\n" +
+		"\t\"encoding/json\"\n" +
+		"\t\"time\"\n" +
+		")\n" +
+		"\n" +
+		"// OrderItem is the model of table order_item, items of order\n" +
+		"type OrderItem struct {\n" +
+		"\tOrderId uint64 `column:\"order_id\" json:\"order_id\" column_schema:\"BIGINT(20) unsigned NOT NULL\" primary_key:\"\" references:\"order(id)\"`\n" +
+		"\t// stock \"keeping\" unit\n" +
+		"\tSku       string          `column:\"sku\" json:\"sku\" column_schema:\"VARCHAR(32) NOT NULL COMMENT 'stock \\\"keeping\\\" unit'\" primary_key:\"\" index:\"\"`\n" +
+		"\tCount     int32           `column:\"count\" json:\"count\" column_schema:\"INT(11) NOT NULL DEFAULT '0'\"`\n" +
+		"\tPrice     *string         `column:\"price\" json:\"price\" column_schema:\"DECIMAL(10,2) NULL\"`\n" +
+		"\tGift      *bool           `column:\"gift\" json:\"gift\" column_schema:\"TINYINT(1) NULL\"`\n" +
+		"\tExtra     json.RawMessage `column:\"extra\" json:\"extra\" column_schema:\"JSON NULL\"`\n" +
+		"\tCreatedAt time.Time       `column:\"created_at\" json:\"created_at\" column_schema:\"DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\" index:\"idx_time\"`\n" +
+		"}\n"
+	if source := string(files["order_item.go"]); source != expect {
+		t.Errorf("source should be\n%s\nbut\n%s", expect, source)
+	}
+	if source := string(files["log_2fa.go"]); source != "// Code generated by kelp mysql.GenerateModels from table log_2fa.\n"+
+		"\n"+
+		"package dao\n"+
+		"\n"+
+		"// Log2fa is the model of table log_2fa\n"+
+		"// The table name can not be derived from the struct name, use Table.SetName(\"log_2fa\").\n"+
+		"type Log2fa struct {\n"+
+		"\tId   uint32  `column:\"id\" json:\"id\" column_schema:\"INT unsigned NOT NULL PRIMARY KEY AUTO_INCREMENT\"`\n"+
+		"\tCode *string `column:\"code\" json:\"code\" column_schema:\"CHAR(6) NULL\"`\n"+
+		"}\n" {
+		t.Error("wrong source", source)
+	}
+
+	files, _ = GenerateModels(conn, &ModelOption{Tables: []string{"log_2fa"}})
+	if len(files) != 1 || files["log_2fa.go"] == nil {
+		t.Error("should only generate log_2fa", files)
+	}
+}
+
+// CodegenModel is the struct generated from a table
+type CodegenModel struct {
+	OrderId uint64 `column:"order_id" json:"order_id" column_schema:"BIGINT(20) unsigned NOT NULL" primary_key:"" references:"order(id)"`
+	// stock "keeping" unit
+	Sku   string  `column:"sku" json:"sku" column_schema:"VARCHAR(32) NOT NULL COMMENT 'stock \"keeping\" unit'" primary_key:"" index:""`
+	Price *string `column:"price" json:"price" column_schema:"DECIMAL(10,2) NULL"`
+}
+
+func TestGeneratedModelTable(t *testing.T) {
+	table := NewTable(CodegenModel{})
+	if pk := table.PrimaryKey(); len(pk) != 2 || pk[0] != "order_id" || pk[1] != "sku" {
+		t.Error("wrong primary key", pk)
+	}
+	if index := table.Index("idx_sku"); index == nil || len(table.ForeignKeys()) != 1 {
+		t.Error("wrong keys", table.Indexes(), table.ForeignKeys())
+	}
+	if table.fields[1].schema != "VARCHAR(32) NOT NULL COMMENT 'stock \"keeping\" unit'" {
+		t.Error("wrong schema", table.fields[1].schema)
+	}
+}
@@ -15,9 +15,10 @@ type CRUDWrapper struct {
 
 func CRUD(model interface{}, option string, conn Connector) *CRUDWrapper {
 	return &CRUDWrapper{
-		conn:  conn,
-		model: model,
-		table: NewTable(model),
+		conn:   conn,
+		model:  model,
+		table:  NewTable(model),
+		option: option,
 	}
 }
 
@@ -30,7 +31,7 @@ func (this *CRUDWrapper) Elem() interface{} {
 }
 
 func (this *CRUDWrapper) Create(data interface{}) error {
-	if !strings.Contains("C", this.option) {
+	if !strings.Contains(this.option, "C") {
 		return errors.New("do not support create")
 	}
 	if _, err := this.conn.Insert(
@@ -43,7 +44,7 @@ func (this *CRUDWrapper) Create(data interface{}) error {
 }
 
 func (this *CRUDWrapper) Update(id int64, data interface{}) error {
-	if !strings.Contains("U", this.option) {
+	if !strings.Contains(this.option, "U") {
 		return errors.New("do not support update")
 	}
 	if _, err := this.conn.Execute(
@@ -56,7 +57,7 @@ func (this *CRUDWrapper) Update(id int64, data interface{}) error {
 }
 
 func (this *CRUDWrapper) Delete(id int64) error {
-	if !strings.Contains("D", this.option) {
+	if !strings.Contains(this.option, "D") {
 		return errors.New("do not support delete")
 	}
 	if _, err := this.conn.Execute(
@@ -69,7 +70,7 @@ func (this *CRUDWrapper) Delete(id int64) error {
 }
 
 func (this *CRUDWrapper) Retrieve(limit, offset int64) (interface{}, int64, error) {
-	if !strings.Contains("R", this.option) {
+	if !strings.Contains(this.option, "R") {
 		return nil, 0, errors.New("do not support retrieve")
 	}
 	arrType := reflect.SliceOf(reflect.PtrTo(this.table.modelType))
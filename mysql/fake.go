@@ -0,0 +1,550 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	FAKE_UNEXPECTED_CALL = errors.New("kelp.mysql: unexpected call on fake db")
+	FAKE_TX_DONE         = errors.New("kelp.mysql: transaction has been committed or rolled back")
+)
+
+// FakeArg matches an argument of FakeExpectation.WithArgs
+type FakeArg func(arg interface{}) bool
+
+// AnyArg matches any argument
+var AnyArg FakeArg = func(interface{}) bool { return true }
+
+// FakeDB is an in-memory Connector for unit tests, which returns the results of expectations.
+//
+//	fake := mysql.NewFakeDB()
+//	fake.ExpectBegin()
+//	fake.ExpectQuery("SELECT .* FROM `user` WHERE `id` = \\?").WithArgs(1).WillReturnRows(&User{Id: 1, Name: "a"})
+//	fake.ExpectExecute("UPDATE `user`").WithArgs("b", mysql.AnyArg).WillReturnResult(1)
+//	fake.ExpectCommit()
+//
+//	err := service.Rename(fake, 1, "b")
+//	if err := fake.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+//
+// Expectations are matched in the order they are declared, call Unordered to match them in any order.
+// A call matching no expectation returns FAKE_UNEXPECTED_CALL.
+// QueryRows is not supported.
+type FakeDB struct {
+	mux          sync.Mutex
+	expectations []*FakeExpectation
+	calls        []*FakeCall
+	unordered    bool
+	txs          int
+}
+
+// FakeExpectation is an expected call of FakeDB
+type FakeExpectation struct {
+	method  string
+	pattern *regexp.Regexp
+	args    []interface{}
+	argsSet bool
+	rows    []interface{}
+	result  int64
+	err     error
+	times   int
+	called  int
+}
+
+// FakeCall is a call recorded by FakeDB
+type FakeCall struct {
+	// Method is Query, QueryOne, Insert, Execute, Begin, Commit or Rollback
+	Method string
+	Sql    string
+	Args   []interface{}
+	// Tx is the sequence of transaction starting from 1, which is 0 out of transaction
+	Tx int
+	// Err is the error returned
+	Err error
+}
+
+// NewFakeDB creates an empty FakeDB.
+func NewFakeDB() *FakeDB {
+	return &FakeDB{}
+}
+
+// Unordered matches expectations in any order.
+func (this *FakeDB) Unordered() *FakeDB {
+	this.unordered = true
+	return this
+}
+
+// ExpectQuery expects a Query or QueryOne whose sql matches the regular expression pattern,
+// the whitespaces in sql are collapsed before matching.
+func (this *FakeDB) ExpectQuery(pattern string) *FakeExpectation {
+	return this.expect("Query", pattern)
+}
+
+// ExpectInsert expects an Insert whose sql matches pattern, see ExpectQuery.
+func (this *FakeDB) ExpectInsert(pattern string) *FakeExpectation {
+	return this.expect("Insert", pattern)
+}
+
+// ExpectExecute expects an Execute whose sql matches pattern, see ExpectQuery.
+func (this *FakeDB) ExpectExecute(pattern string) *FakeExpectation {
+	return this.expect("Execute", pattern)
+}
+
+// ExpectBegin expects a Begin, which is a savepoint if it is called in a transaction.
+func (this *FakeDB) ExpectBegin() *FakeExpectation {
+	return this.expect("Begin", "")
+}
+
+// ExpectCommit expects a Commit of transaction.
+func (this *FakeDB) ExpectCommit() *FakeExpectation {
+	return this.expect("Commit", "")
+}
+
+// ExpectRollback expects a Rollback of transaction.
+func (this *FakeDB) ExpectRollback() *FakeExpectation {
+	return this.expect("Rollback", "")
+}
+
+func (this *FakeDB) expect(method, pattern string) *FakeExpectation {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	expectation := &FakeExpectation{method: method, times: 1}
+	if pattern != "" {
+		expectation.pattern = regexp.MustCompile(pattern)
+	}
+	this.expectations = append(this.expectations, expectation)
+	return expectation
+}
+
+// WithArgs expects the arguments, an argument matches if it is a FakeArg returning true,
+// or it equals the expected value after converted by database/sql, such as int to int64.
+func (this *FakeExpectation) WithArgs(args ...interface{}) *FakeExpectation {
+	this.args = args
+	this.argsSet = true
+	return this
+}
+
+// WillReturnRows returns rows to Query and QueryOne,
+// a row is a struct, a pointer to struct or a map[string]interface{},
+// whose values are scanned into dest as the columns returned by database.
+func (this *FakeExpectation) WillReturnRows(rows ...interface{}) *FakeExpectation {
+	this.rows = rows
+	return this
+}
+
+// WillReturnResult returns the last insert id to Insert, or the affected rows to Execute.
+func (this *FakeExpectation) WillReturnResult(result int64) *FakeExpectation {
+	this.result = result
+	return this
+}
+
+// WillReturnError returns err to the call.
+func (this *FakeExpectation) WillReturnError(err error) *FakeExpectation {
+	this.err = err
+	return this
+}
+
+// Times expects the call n times, the default is 1.
+func (this *FakeExpectation) Times(n int) *FakeExpectation {
+	this.times = n
+	return this
+}
+
+func (this *FakeExpectation) String() string {
+	if this.pattern == nil {
+		return this.method
+	}
+	if this.argsSet {
+		return fmt.Sprintf("%s %s %v", this.method, this.pattern, this.args)
+	}
+	return fmt.Sprintf("%s %s", this.method, this.pattern)
+}
+
+func (this *FakeExpectation) match(method, sql string, args []interface{}) bool {
+	if (this.method != method && !(this.method == "Query" && method == "QueryOne")) || this.called >= this.times {
+		return false
+	}
+	if this.pattern != nil && !this.pattern.MatchString(sql) {
+		return false
+	}
+	if !this.argsSet {
+		return true
+	}
+	if len(args) != len(this.args) {
+		return false
+	}
+	for i, expect := range this.args {
+		if matcher, ok := expect.(FakeArg); ok {
+			if !matcher(args[i]) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(fakeValue(expect), fakeValue(args[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeValue converts v as database/sql does before sending it to driver
+func fakeValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(columnValue(reflect.ValueOf(v)))
+	if err != nil {
+		return v
+	}
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+// Calls returns the recorded calls.
+func (this *FakeDB) Calls() []*FakeCall {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return append([]*FakeCall{}, this.calls...)
+}
+
+// ExpectationsWereMet returns an error listing the expectations not called.
+func (this *FakeDB) ExpectationsWereMet() error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	missing := []string{}
+	for _, expectation := range this.expectations {
+		if expectation.called < expectation.times {
+			missing = append(missing, fmt.Sprintf("%s (%d/%d)", expectation, expectation.called, expectation.times))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("kelp.mysql: expectations were not met: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// call matches the call with expectations and records it
+func (this *FakeDB) call(method, sql string, args []interface{}, tx int) (*FakeExpectation, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	sql = strings.Join(strings.Fields(sql), " ")
+	call := &FakeCall{Method: method, Sql: sql, Args: args, Tx: tx}
+	this.calls = append(this.calls, call)
+	for _, expectation := range this.expectations {
+		if expectation.match(method, sql, args) {
+			expectation.called++
+			call.Err = expectation.err
+			return expectation, expectation.err
+		}
+		if !this.unordered && expectation.called < expectation.times {
+			break
+		}
+	}
+	call.Err = fmt.Errorf("%w: %s %s %v", FAKE_UNEXPECTED_CALL, method, sql, args)
+	log.Error("fake", call.Err)
+	return nil, call.Err
+}
+
+func (this *FakeDB) query(destList interface{}, sql string, params []interface{}, tx int, one bool) error {
+	method := "Query"
+	if one {
+		method = "QueryOne"
+	}
+	expectation, err := this.call(method, sql, params, tx)
+	if err != nil {
+		return err
+	}
+	rows, err := newFakeRows(expectation.rows)
+	if err != nil {
+		return err
+	}
+	if one {
+		return scanQueryOne(destList, rows)
+	}
+	return scanQueryRows(destList, rows)
+}
+
+// Begin starts a simulated transaction.
+func (this *FakeDB) Begin() (Connector, error) {
+	if _, err := this.call("Begin", "", nil, 0); err != nil {
+		return nil, err
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.txs++
+	return &fakeTx{db: this, id: this.txs}, nil
+}
+
+// Commit is not allow out of transaction
+func (this *FakeDB) Commit() error {
+	return METHOD_NOT_ALLOW
+}
+
+// Rollback is not allow out of transaction
+func (this *FakeDB) Rollback() error {
+	return METHOD_NOT_ALLOW
+}
+
+// Query returns the rows of matched expectation into destList
+func (this *FakeDB) Query(destList interface{}, sql string, params ...interface{}) error {
+	return this.query(destList, sql, params, 0, false)
+}
+
+// QueryOne returns the first row of matched expectation into destObject
+func (this *FakeDB) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	return this.query(destObject, sql, params, 0, true)
+}
+
+// Insert returns the result of matched expectation as last insert id
+func (this *FakeDB) Insert(sql string, params ...interface{}) (int64, error) {
+	expectation, err := this.call("Insert", sql, params, 0)
+	if err != nil {
+		return 0, err
+	}
+	return expectation.result, nil
+}
+
+// Execute returns the result of matched expectation as affected rows
+func (this *FakeDB) Execute(sql string, params ...interface{}) (int64, error) {
+	expectation, err := this.call("Execute", sql, params, 0)
+	if err != nil {
+		return 0, err
+	}
+	return expectation.result, nil
+}
+
+// fakeTx is a simulated transaction of FakeDB, or a savepoint if parent is set
+type fakeTx struct {
+	db     *FakeDB
+	id     int
+	parent *fakeTx
+	done   bool
+}
+
+// active returns whether the transaction and its parents are not committed or rolled back
+func (this *fakeTx) active() bool {
+	for tx := this; tx != nil; tx = tx.parent {
+		if tx.done {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *fakeTx) Begin() (Connector, error) {
+	if !this.active() {
+		return nil, FAKE_TX_DONE
+	}
+	if _, err := this.db.call("Begin", "", nil, this.id); err != nil {
+		return nil, err
+	}
+	return &fakeTx{db: this.db, id: this.id, parent: this}, nil
+}
+
+func (this *fakeTx) finish(method string) error {
+	if !this.active() {
+		return FAKE_TX_DONE
+	}
+	this.done = true
+	_, err := this.db.call(method, "", nil, this.id)
+	return err
+}
+
+func (this *fakeTx) Commit() error {
+	return this.finish("Commit")
+}
+
+func (this *fakeTx) Rollback() error {
+	return this.finish("Rollback")
+}
+
+func (this *fakeTx) Query(destList interface{}, sql string, params ...interface{}) error {
+	if !this.active() {
+		return FAKE_TX_DONE
+	}
+	return this.db.query(destList, sql, params, this.id, false)
+}
+
+func (this *fakeTx) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	if !this.active() {
+		return FAKE_TX_DONE
+	}
+	return this.db.query(destObject, sql, params, this.id, true)
+}
+
+func (this *fakeTx) Insert(sql string, params ...interface{}) (int64, error) {
+	if !this.active() {
+		return 0, FAKE_TX_DONE
+	}
+	expectation, err := this.db.call("Insert", sql, params, this.id)
+	if err != nil {
+		return 0, err
+	}
+	return expectation.result, nil
+}
+
+func (this *fakeTx) Execute(sql string, params ...interface{}) (int64, error) {
+	if !this.active() {
+		return 0, FAKE_TX_DONE
+	}
+	expectation, err := this.db.call("Execute", sql, params, this.id)
+	if err != nil {
+		return 0, err
+	}
+	return expectation.result, nil
+}
+
+// fakeRows are the rows returned by FakeDB, which are scanned like *sql.Rows
+type fakeRows struct {
+	columns []string
+	values  [][]interface{}
+	current int
+}
+
+// newFakeRows converts structs and maps to rows,
+// the columns are the union of all rows, missing values are NULL
+func newFakeRows(rows []interface{}) (*fakeRows, error) {
+	ret := &fakeRows{current: -1}
+	positions := map[string]int{}
+	for _, row := range rows {
+		columns, values, err := fakeRow(row)
+		if err != nil {
+			return nil, err
+		}
+		converted := make([]interface{}, len(ret.columns))
+		for i, column := range columns {
+			position, exist := positions[column]
+			if !exist {
+				position = len(ret.columns)
+				positions[column] = position
+				ret.columns = append(ret.columns, column)
+				converted = append(converted, nil)
+			}
+			converted[position] = values[i]
+		}
+		ret.values = append(ret.values, converted)
+	}
+	for i, values := range ret.values {
+		for len(values) < len(ret.columns) {
+			values = append(values, nil)
+		}
+		ret.values[i] = values
+	}
+	return ret, nil
+}
+
+// fakeRow returns the columns and values of a struct or a map
+func fakeRow(row interface{}) ([]string, []interface{}, error) {
+	v := reflect.ValueOf(row)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	columns := []string{}
+	values := []interface{}{}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, nil, fmt.Errorf("kelp.mysql: fake row should be a map of string keys but %s", v.Type())
+		}
+		keys := []string{}
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			columns = append(columns, key)
+			value := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).Interface()
+			if value != nil {
+				value = columnValue(reflect.ValueOf(value))
+			}
+			values = append(values, value)
+		}
+	case reflect.Struct:
+		collectFakeRow(v, &columns, &values)
+	default:
+		return nil, nil, fmt.Errorf("kelp.mysql: fake row should be a struct or a map but %T", row)
+	}
+	for i, value := range values {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("kelp.mysql: fake column %s: %v", columns[i], err)
+		}
+		values[i] = converted
+	}
+	return columns, values, nil
+}
+
+// collectFakeRow collects the fields of struct as Table and the scanner name the columns
+func collectFakeRow(v reflect.Value, columns *[]string, values *[]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := getColumnName(field)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == field.Name && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			collectFakeRow(embedded, columns, values)
+			continue
+		}
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		*columns = append(*columns, name)
+		*values = append(*values, columnValue(v.Field(i)))
+	}
+}
+
+func (this *fakeRows) Columns() ([]string, error) {
+	return this.columns, nil
+}
+
+func (this *fakeRows) Next() bool {
+	this.current++
+	return this.current < len(this.values)
+}
+
+// Scan sets the values into *interface{} or sql.Scanner, as the scanner uses
+func (this *fakeRows) Scan(dest ...interface{}) error {
+	row := this.values[this.current]
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *interface{}:
+			*d = row[i]
+		case sql.Scanner:
+			if err := d.Scan(row[i]); err != nil {
+				return fmt.Errorf("kelp.mysql: fake column %s: %v", this.columns[i], err)
+			}
+		default:
+			return fmt.Errorf("kelp.mysql: fake rows can not scan into %T", d)
+		}
+	}
+	return nil
+}
+
+func (this *fakeRows) Err() error {
+	return nil
+}
+
+func (this *fakeRows) Close() error {
+	return nil
+}
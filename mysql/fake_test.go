@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mapleque/kelp/mysql/query"
+)
+
+type FakeUser struct {
+	Id        int64        `json:"id" column_schema:"BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT"`
+	Name      string       `json:"name" column_schema:"VARCHAR(32) NOT NULL"`
+	Email     *string      `json:"email" column_schema:"VARCHAR(64) NULL"`
+	CreatedAt time.Time    `json:"created_at" column_schema:"DATETIME NOT NULL"`
+	Profile   *ScanProfile `json:"profile" column_schema:"JSON NULL"`
+}
+
+func TestFakeDB(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	email := "a@b.c"
+	fake := NewFakeDB()
+	fake.ExpectQuery("SELECT .* FROM `fake_user` WHERE `id` = \\?").WithArgs(1).WillReturnRows(
+		&FakeUser{Id: 1, Name: "a", Email: &email, CreatedAt: created, Profile: &ScanProfile{City: "sh"}},
+	)
+	fake.ExpectQuery("FROM `fake_user`").WillReturnRows(
+		map[string]interface{}{"id": 2, "name": "b", "created_at": created},
+		map[string]interface{}{"id": 3, "name": "c", "email": "c@d.e"},
+	)
+	fake.ExpectInsert("INSERT INTO `fake_user`").WithArgs("d", AnyArg, AnyArg, AnyArg).WillReturnResult(4)
+	fake.ExpectExecute("UPDATE `fake_user`").WillReturnError(errors.New("lock wait timeout"))
+
+	repo := NewRepo[FakeUser](fake, nil)
+	user, err := repo.Find(1)
+	if err != nil || user.Name != "a" || *user.Email != email || !user.CreatedAt.Equal(created) || user.Profile.City != "sh" {
+		t.Error("wrong user", user, err)
+	}
+	list, err := repo.FindBy(query.Gt("id", 1))
+	if err != nil || len(list) != 2 || list[0].Email != nil || *list[1].Email != "c@d.e" || !list[1].CreatedAt.IsZero() {
+		t.Error("wrong list", list, err)
+	}
+	model := &FakeUser{Name: "d"}
+	if err := repo.Insert(model); err != nil || model.Id != 4 {
+		t.Error("wrong insert", model, err)
+	}
+	if _, err := repo.Update(model, "name"); err == nil || err.Error() != "lock wait timeout" {
+		t.Error("should return injected error", err)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if _, err := repo.Delete(4); !errors.Is(err, FAKE_UNEXPECTED_CALL) {
+		t.Error("should be unexpected", err)
+	}
+	calls := fake.Calls()
+	if len(calls) != 5 || calls[0].Method != "QueryOne" || calls[1].Method != "Query" || calls[4].Err == nil {
+		t.Error("wrong calls", calls)
+	}
+	if calls[2].Sql != "INSERT INTO `fake_user` (`name`, `email`, `created_at`, `profile`) VALUES (?, ?, ?, ?)" {
+		t.Error("wrong sql", calls[2].Sql)
+	}
+}
+
+func TestFakeDBOrder(t *testing.T) {
+	fake := NewFakeDB()
+	fake.ExpectExecute("UPDATE a").Times(2)
+	fake.ExpectExecute("UPDATE b")
+	if _, err := fake.Execute("UPDATE b"); err == nil {
+		t.Error("should be out of order")
+	}
+	fake.Execute("UPDATE a")
+	fake.Execute("UPDATE a")
+	if _, err := fake.Execute("UPDATE b"); err != nil {
+		t.Error(err)
+	}
+
+	fake = NewFakeDB().Unordered()
+	fake.ExpectExecute("UPDATE a")
+	fake.ExpectExecute("UPDATE b").WithArgs(1)
+	if _, err := fake.Execute("UPDATE b", 2); err == nil {
+		t.Error("args should not match")
+	}
+	fake.Execute("UPDATE b", int8(1))
+	if err := fake.ExpectationsWereMet(); err == nil || !strings.Contains(err.Error(), "UPDATE a") {
+		t.Error("UPDATE a is not met", err)
+	}
+}
+
+func TestFakeDBTx(t *testing.T) {
+	fake := NewFakeDB()
+	fake.ExpectBegin()
+	fake.ExpectExecute("UPDATE a")
+	fake.ExpectBegin()
+	fake.ExpectExecute("UPDATE b").WillReturnError(errors.New("failed"))
+	fake.ExpectRollback()
+	fake.ExpectCommit()
+	err := WithTx(fake, func(tx Connector) error {
+		if _, err := tx.Execute("UPDATE a"); err != nil {
+			return err
+		}
+		WithTx(tx, func(sp Connector) error {
+			_, err := sp.Execute("UPDATE b")
+			return err
+		})
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	for _, call := range fake.Calls()[1:] {
+		if call.Tx != 1 {
+			t.Error("should be in transaction", call)
+		}
+	}
+
+	fake.ExpectBegin()
+	tx, _ := fake.Begin()
+	fake.ExpectCommit()
+	tx.Commit()
+	if _, err := tx.Execute("UPDATE c"); err != FAKE_TX_DONE {
+		t.Error("transaction should be done", err)
+	}
+	if err := fake.Commit(); err != METHOD_NOT_ALLOW {
+		t.Error("should not commit out of transaction", err)
+	}
+}
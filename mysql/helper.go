@@ -1,8 +1,11 @@
 package mysql
 
 import (
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/mapleque/kelp/mysql/query"
 )
 
 type WhereInterface interface {
@@ -37,6 +40,10 @@ type PagerElement interface {
 	GetOffset() int64
 }
 
+// Where builds a WHERE clause joined with AND.
+//
+// Deprecated: use query.Select(...).Where(...) in package mysql/query,
+// which supports OR groups, operators and subqueries.
 type Where struct {
 	condition []string
 	bind      []interface{}
@@ -89,6 +96,9 @@ func (this *Where) Bind() []interface{} {
 	return this.bind
 }
 
+// In builds a WHERE clause with IN lists.
+//
+// Deprecated: use query.In in package mysql/query.
 type In struct {
 	fields []string
 	bind   map[string][]interface{}
@@ -130,6 +140,10 @@ func (this *In) Bind() []interface{} {
 	return bind
 }
 
+// Sorter builds an ORDER BY clause, the fields are quoted,
+// a field which is not a column name or table.column is ignored.
+//
+// Deprecated: use SelectBuilder.Sort in package mysql/query.
 type Sorter struct {
 	sqls []string
 }
@@ -140,8 +154,15 @@ func NewSorter() *Sorter {
 	}
 }
 
+var sorterFieldRegexp = regexp.MustCompile(`^\w+(\.\w+)?$`)
+
 func (this *Sorter) Add(sorter SorterElement) {
-	sql := sorter.GetField()
+	field := sorter.GetField()
+	if !sorterFieldRegexp.MatchString(field) {
+		log.Error("sorter", "invalid field", field)
+		return
+	}
+	sql := query.Quote(field)
 	if sorter.GetReverse() {
 		sql += " DESC"
 	} else {
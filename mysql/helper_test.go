@@ -60,14 +60,16 @@ func (this *SorterForTest) GetReverse() bool {
 func TestSorter(t *testing.T) {
 	sorter := NewSorter()
 	sorter.Add(&SorterForTest{"field1", true})
-	if sorter.Sql() != " ORDER BY field1 DESC" {
+	if sorter.Sql() != " ORDER BY `field1` DESC" {
 		t.Error("wrong sorter sql", sorter.Sql())
 	}
 
 	sorter = NewSorter()
 	sorter.Add(&SorterForTest{"field1", true})
-	sorter.Add(&SorterForTest{"field2", false})
-	if sorter.Sql() != " ORDER BY field1 DESC, field2 ASC" {
+	sorter.Add(&SorterForTest{"t.field2", false})
+	sorter.Add(&SorterForTest{"field3; DROP TABLE user", false})
+	sorter.Add(&SorterForTest{"(SELECT 1)", true})
+	if sorter.Sql() != " ORDER BY `field1` DESC, `t`.`field2` ASC" {
 		t.Error("wrong sorter sql", sorter.Sql())
 	}
 }
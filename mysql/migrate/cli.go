@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mapleque/kelp/mysql"
+)
+
+const usage = `usage: %s [options] <command> [args]
+
+commands:
+  status          show the status of migrations
+  up [n]          apply n pending migrations, all if n is not set
+  down [n]        revert n applied migrations, 1 if n is not set
+  plan [name]     print the changes from database to schema,
+                  and write them as a new migration if name is set
+
+options:
+`
+
+// Main runs the command in os.Args, and exits with 1 on error, see Run.
+//
+//	func main() {
+//		mysql.AddDB("db", dsn, 10, 5)
+//		schema := mysql.NewSchema()
+//		schema.Add(User{})
+//		migrate.Main(mysql.Get("db"), "./migrations", schema)
+//	}
+func Main(conn mysql.Connector, dir string, schema *mysql.Schema) {
+	if err := Run(conn, dir, schema, os.Args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Run runs the command in args on conn with migrations in dir,
+// args[0] is the name of program, the output is written into out.
+// schema is used by plan command, which can be nil if plan is not used.
+func Run(conn mysql.Connector, dir string, schema *mysql.Schema, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.StringVar(&dir, "dir", dir, "the directory of migration files")
+	table := flags.String("table", DEFAULT_TABLE, "the name of history table")
+	timeout := flags.Duration("lock-timeout", DEFAULT_LOCK_TIMEOUT, "the time waiting for the lock")
+	flags.Usage = func() {
+		fmt.Fprintf(out, usage, args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("kelp.mysql.migrate: command is required")
+	}
+	command, arg := flags.Arg(0), flags.Arg(1)
+	if command == "plan" {
+		return plan(conn, dir, schema, arg, out)
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return err
+	}
+	migrator := New(conn, migrations).Table(*table).LockTimeout(*timeout)
+	steps := 0
+	if arg != "" {
+		if _, err := fmt.Sscanf(arg, "%d", &steps); err != nil || steps <= 0 {
+			return fmt.Errorf("kelp.mysql.migrate: invalid steps %s", arg)
+		}
+	}
+	switch command {
+	case "status":
+		return status(migrator, out)
+	case "up":
+		done, err := migrator.Up(steps)
+		for _, migration := range done {
+			fmt.Fprintf(out, "up %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "no pending migration")
+		}
+		return err
+	case "down":
+		done, err := migrator.Down(steps)
+		for _, migration := range done {
+			fmt.Fprintf(out, "down %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	}
+	flags.Usage()
+	return fmt.Errorf("kelp.mysql.migrate: unknown command %s", command)
+}
+
+func status(migrator *Migrator, out io.Writer) error {
+	list, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range list {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+			if status.AppliedAt != nil {
+				state += " at " + status.AppliedAt.Format(time.RFC3339)
+			}
+		}
+		if status.Modified {
+			state += ", modified"
+		}
+		if status.Missing {
+			state += ", missing"
+		}
+		fmt.Fprintf(out, "%d_%s\t%s\n", status.Version, status.Name, state)
+	}
+	return nil
+}
+
+func plan(conn mysql.Connector, dir string, schema *mysql.Schema, name string, out io.Writer) error {
+	if schema == nil {
+		return errors.New("kelp.mysql.migrate: schema is required by plan")
+	}
+	changes, err := schema.Plan(mysql.Primary(conn))
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "database is up to date")
+		return nil
+	}
+	up := []string{}
+	down := []string{}
+	for _, change := range changes {
+		up = append(up, change.Up+";")
+		if change.Down != "" {
+			// revert in reverse order
+			down = append([]string{change.Down + ";"}, down...)
+		}
+	}
+	fmt.Fprintln(out, strings.Join(up, "\n"))
+	if name == "" {
+		return nil
+	}
+	migration, err := Create(dir, name, strings.Join(up, "\n")+"\n", strings.Join(down, "\n")+"\n")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created %d_%s\n", migration.Version, migration.Name)
+	return nil
+}
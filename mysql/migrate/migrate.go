@@ -0,0 +1,484 @@
+// Package migrate runs versioned schema migrations on mysql.
+//
+// Migrations are sql files in a directory, named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// the version is a number increasing by time, such as 20200102150405.
+// Applied migrations are recorded in a history table with the checksum of up file,
+// a migration can not be changed after it is applied.
+//
+// DDL statements are not transactional in mysql, if a migration fails halfway,
+// the applied statements should be fixed by hand.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mapleque/kelp/mysql"
+)
+
+var (
+	CHECKSUM_MISMATCH = errors.New("kelp.mysql.migrate: applied migration has been changed")
+	LOCK_TIMEOUT      = errors.New("kelp.mysql.migrate: migration is locked by another process")
+	NO_DOWN_MIGRATION = errors.New("kelp.mysql.migrate: migration has no down file")
+	MISSING_MIGRATION = errors.New("kelp.mysql.migrate: applied migration has no file")
+)
+
+const (
+	// DEFAULT_TABLE is the default name of history table
+	DEFAULT_TABLE = "schema_migrations"
+	// DEFAULT_LOCK_TIMEOUT is the default time waiting for the lock
+	DEFAULT_LOCK_TIMEOUT = time.Minute
+	// DEFAULT_LOCK_EXPIRE is the default time after which a lock is considered stale,
+	// such as the process holding it crashed
+	DEFAULT_LOCK_EXPIRE = 10 * time.Minute
+)
+
+var filenameRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a versioned migration
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the sha256 of Up
+	Checksum string
+}
+
+// Status is the state of a migration
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Modified is true if the migration file is changed after applied
+	Modified bool
+	// Missing is true if the migration is applied but its file is not found
+	Missing bool
+}
+
+// history is a row of history table
+type history struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Checksum  string     `json:"checksum"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Load loads migrations from files in dir, ordered by version.
+func Load(dir string) ([]*Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[int64]*Migration{}
+	for _, file := range files {
+		match := filenameRegexp.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, exist := versions[version]
+		if !exist {
+			migration = &Migration{Version: version, Name: match[2]}
+			versions[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("kelp.mysql.migrate: version %d has different names %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	migrations := []*Migration{}
+	for _, migration := range versions {
+		migration.Checksum = checksum(migration.Up)
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Create writes a new migration into dir, whose version is current time.
+func Create(dir, name, up, down string) (*Migration, error) {
+	migration := &Migration{
+		Version:  ToVersion(time.Now()),
+		Name:     strings.Replace(strings.TrimSpace(name), " ", "_", -1),
+		Up:       up,
+		Down:     down,
+		Checksum: checksum(up),
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+	if err := ioutil.WriteFile(prefix+".up.sql", []byte(up), 0644); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(prefix+".down.sql", []byte(down), 0644); err != nil {
+		os.Remove(prefix + ".up.sql")
+		return nil, err
+	}
+	return migration, nil
+}
+
+// ToVersion returns the version of time, such as 20200102150405
+func ToVersion(t time.Time) int64 {
+	version, _ := strconv.ParseInt(t.Format("20060102150405"), 10, 64)
+	return version
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrator applies migrations on a database.
+type Migrator struct {
+	conn        mysql.Connector
+	migrations  []*Migration
+	table       string
+	lockTimeout time.Duration
+	lockExpire  time.Duration
+	owner       string
+}
+
+// New creates a migrator of migrations on conn,
+// if conn is a cluster, the history and the lock are read from the primary.
+func New(conn mysql.Connector, migrations []*Migration) *Migrator {
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		conn:        mysql.Primary(conn),
+		migrations:  migrations,
+		table:       DEFAULT_TABLE,
+		lockTimeout: DEFAULT_LOCK_TIMEOUT,
+		lockExpire:  DEFAULT_LOCK_EXPIRE,
+		owner:       fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+	}
+}
+
+// Table sets the name of history table, the lock table is the name with suffix _lock.
+func (this *Migrator) Table(name string) *Migrator {
+	this.table = name
+	return this
+}
+
+// LockTimeout sets the time waiting for the lock held by another process.
+func (this *Migrator) LockTimeout(timeout time.Duration) *Migrator {
+	this.lockTimeout = timeout
+	return this
+}
+
+// Status returns the status of all migrations and applied migrations without files, ordered by version.
+func (this *Migrator) Status() ([]*Status, error) {
+	if err := this.init(); err != nil {
+		return nil, err
+	}
+	applied, err := this.applied()
+	if err != nil {
+		return nil, err
+	}
+	return this.status(applied), nil
+}
+
+func (this *Migrator) status(applied map[int64]*history) []*Status {
+	ret := []*Status{}
+	for _, migration := range this.migrations {
+		status := &Status{Version: migration.Version, Name: migration.Name}
+		if row, exist := applied[migration.Version]; exist {
+			status.Applied = true
+			status.AppliedAt = row.AppliedAt
+			status.Modified = row.Checksum != migration.Checksum
+		}
+		ret = append(ret, status)
+	}
+	for version, row := range applied {
+		if this.find(version) == nil {
+			ret = append(ret, &Status{
+				Version:   version,
+				Name:      row.Name,
+				Applied:   true,
+				AppliedAt: row.AppliedAt,
+				Missing:   true,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	return ret
+}
+
+// Up applies at most steps pending migrations in the order of version, 0 means all,
+// and returns the applied migrations.
+// It fails without applying anything if an applied migration has been changed.
+func (this *Migrator) Up(steps int) ([]*Migration, error) {
+	done := []*Migration{}
+	err := this.withLock(func(applied map[int64]*history) error {
+		for _, status := range this.status(applied) {
+			if status.Modified {
+				return fmt.Errorf("%w: %d_%s", CHECKSUM_MISMATCH, status.Version, status.Name)
+			}
+		}
+		for _, migration := range this.migrations {
+			if _, exist := applied[migration.Version]; exist {
+				continue
+			}
+			if steps > 0 && len(done) >= steps {
+				break
+			}
+			if err := this.execute(migration.Up); err != nil {
+				return fmt.Errorf("kelp.mysql.migrate: up %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := this.conn.Execute(
+				"INSERT INTO `"+this.table+"` (`version`, `name`, `checksum`, `applied_at`) VALUES (?, ?, ?, ?)",
+				migration.Version, migration.Name, migration.Checksum, time.Now(),
+			); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts at most steps applied migrations from the latest one, 0 means 1,
+// and returns the reverted migrations.
+func (this *Migrator) Down(steps int) ([]*Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	done := []*Migration{}
+	err := this.withLock(func(applied map[int64]*history) error {
+		versions := []int64{}
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		for _, version := range versions {
+			if len(done) >= steps {
+				break
+			}
+			migration := this.find(version)
+			if migration == nil {
+				return fmt.Errorf("%w: %d_%s", MISSING_MIGRATION, version, applied[version].Name)
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("%w: %d_%s", NO_DOWN_MIGRATION, version, migration.Name)
+			}
+			if err := this.execute(migration.Down); err != nil {
+				return fmt.Errorf("kelp.mysql.migrate: down %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := this.conn.Execute("DELETE FROM `"+this.table+"` WHERE `version` = ?", version); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (this *Migrator) find(version int64) *Migration {
+	for _, migration := range this.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+// execute executes statements separated by semicolon
+func (this *Migrator) execute(content string) error {
+	for _, statement := range splitStatements(content) {
+		if _, err := this.conn.Execute(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits sql by semicolons out of quotes and comments, and removes comments.
+// Comments are -- (followed by a whitespace), # and /* */, a /*! */ comment is kept since it is executed by mysql.
+// Backslash escapes are recognized in quoted strings.
+func splitStatements(content string) []string {
+	statements := []string{}
+	current := strings.Builder{}
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// copy the quoted string
+			current.WriteRune(c)
+			for i++; i < len(runes); i++ {
+				current.WriteRune(runes[i])
+				if runes[i] == '\\' && c != '`' && i+1 < len(runes) {
+					i++
+					current.WriteRune(runes[i])
+				} else if runes[i] == c {
+					break
+				}
+			}
+		case c == '#' || (c == '-' && i+2 < len(runes) && runes[i+1] == '-' && unicode.IsSpace(runes[i+2])) ||
+			(c == '-' && i+2 == len(runes) && runes[i+1] == '-'):
+			// skip to the end of line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := i + 2
+			for end+1 < len(runes) && !(runes[end] == '*' && runes[end+1] == '/') {
+				end++
+			}
+			if end += 2; end > len(runes) {
+				end = len(runes)
+			}
+			if comment := string(runes[i:end]); strings.HasPrefix(comment, "/*!") {
+				current.WriteString(comment)
+			} else {
+				current.WriteRune(' ')
+			}
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// init creates the history table and the lock table
+func (this *Migrator) init() error {
+	if _, err := this.conn.Execute(
+		"CREATE TABLE IF NOT EXISTS `" + this.table + "` (\n" +
+			"\t`version` BIGINT NOT NULL PRIMARY KEY,\n" +
+			"\t`name` VARCHAR(255) NOT NULL,\n" +
+			"\t`checksum` CHAR(64) NOT NULL,\n" +
+			"\t`applied_at` DATETIME NOT NULL\n" +
+			") DEFAULT CHARSET=utf8mb4",
+	); err != nil {
+		return err
+	}
+	_, err := this.conn.Execute(
+		"CREATE TABLE IF NOT EXISTS `" + this.table + "_lock` (\n" +
+			"\t`id` INT NOT NULL PRIMARY KEY,\n" +
+			"\t`owner` VARCHAR(255) NOT NULL,\n" +
+			"\t`locked_at` DATETIME NOT NULL\n" +
+			") DEFAULT CHARSET=utf8mb4",
+	)
+	return err
+}
+
+func (this *Migrator) applied() (map[int64]*history, error) {
+	rows := []*history{}
+	if err := this.conn.Query(&rows, "SELECT `version`, `name`, `checksum`, `applied_at` FROM `"+this.table+"`"); err != nil {
+		return nil, err
+	}
+	applied := map[int64]*history{}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// withLock runs fn with the lock, which is a row in the lock table,
+// so that migrations are not run by concurrent processes.
+// The lock is refreshed while fn runs, a lock not refreshed in lockExpire is considered stale and is released.
+func (this *Migrator) withLock(fn func(applied map[int64]*history) error) error {
+	if err := this.init(); err != nil {
+		return err
+	}
+	lockTable := "`" + this.table + "_lock`"
+	deadline := time.Now().Add(this.lockTimeout)
+	for {
+		if _, err := this.conn.Execute(
+			"DELETE FROM "+lockTable+" WHERE `id` = 1 AND `locked_at` < ?",
+			time.Now().Add(-this.lockExpire),
+		); err != nil {
+			return err
+		}
+		_, err := this.conn.Insert(
+			"INSERT IGNORE INTO "+lockTable+" (`id`, `owner`, `locked_at`) VALUES (1, ?, ?)",
+			this.owner, time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+		lock := &struct {
+			Owner string `json:"owner"`
+		}{}
+		if err := this.conn.QueryOne(lock, "SELECT `owner` FROM "+lockTable+" WHERE `id` = 1"); err != nil && err != mysql.NO_DATA_TO_BIND {
+			return err
+		}
+		if lock.Owner == this.owner {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", LOCK_TIMEOUT, lock.Owner)
+		}
+		time.Sleep(time.Second)
+	}
+	defer this.conn.Execute("DELETE FROM "+lockTable+" WHERE `id` = 1 AND `owner` = ?", this.owner)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go this.heartbeat(lockTable, stop, done)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	applied, err := this.applied()
+	if err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+// heartbeat refreshes the lock until stop is closed,
+// so that a long migration, such as ALTER TABLE on a big table, is not considered stale
+func (this *Migrator) heartbeat(lockTable string, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(this.lockExpire / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			this.conn.Execute(
+				"UPDATE "+lockTable+" SET `locked_at` = ? WHERE `id` = 1 AND `owner` = ?",
+				time.Now(), this.owner,
+			)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mapleque/kelp/mysql"
+)
+
+// historyConnector keeps the history table and the lock table in memory
+type historyConnector struct {
+	*mysql.TestDB
+	mux        sync.Mutex
+	rows       map[int64]*history
+	owner      string
+	executed   []string
+	fail       string
+	heartbeats int
+}
+
+func newHistoryConnector() *historyConnector {
+	return &historyConnector{TestDB: mysql.NewTestDB(), rows: map[int64]*history{}}
+}
+
+func (this *historyConnector) Query(destList interface{}, sql string, params ...interface{}) error {
+	list := destList.(*[]*history)
+	for _, row := range this.rows {
+		*list = append(*list, row)
+	}
+	return nil
+}
+
+func (this *historyConnector) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	if this.owner == "" {
+		return mysql.NO_DATA_TO_BIND
+	}
+	reflect.ValueOf(destObject).Elem().FieldByName("Owner").SetString(this.owner)
+	return nil
+}
+
+func (this *historyConnector) Insert(sql string, params ...interface{}) (int64, error) {
+	if this.owner != "" {
+		return 0, nil
+	}
+	this.owner = params[0].(string)
+	return 1, nil
+}
+
+func (this *historyConnector) Execute(sql string, params ...interface{}) (int64, error) {
+	if strings.Contains(sql, "SLOW") {
+		time.Sleep(100 * time.Millisecond)
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	switch {
+	case strings.HasPrefix(sql, "UPDATE `schema_migrations_lock`"):
+		this.heartbeats++
+	case strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS"):
+	case strings.HasPrefix(sql, "DELETE FROM `schema_migrations_lock`"):
+		if len(params) == 1 && params[0] == this.owner {
+			this.owner = ""
+		}
+	case strings.HasPrefix(sql, "INSERT INTO `schema_migrations`"):
+		now := params[3].(time.Time)
+		this.rows[params[0].(int64)] = &history{params[0].(int64), params[1].(string), params[2].(string), &now}
+	case strings.HasPrefix(sql, "DELETE FROM `schema_migrations`"):
+		delete(this.rows, params[0].(int64))
+	default:
+		if this.fail != "" && strings.Contains(sql, this.fail) {
+			return 0, errors.New("syntax error")
+		}
+		this.executed = append(this.executed, sql)
+	}
+	return 0, nil
+}
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"2_add_age.up.sql":       "ALTER TABLE `user` ADD COLUMN `age` INT;",
+		"2_add_age.down.sql":     "ALTER TABLE `user` DROP COLUMN `age`;",
+		"1_create_user.up.sql":   "CREATE TABLE `user` (`id` INT);",
+		"README.md":              "not a migration",
+		"10_create_log.up.sql":   "CREATE TABLE `log` (`id` INT);",
+		"1_create_user.down.sql": "DROP TABLE `user`;",
+	})
+	defer os.RemoveAll(dir)
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 3 ||
+		migrations[0].Name != "create_user" ||
+		migrations[1].Name != "add_age" ||
+		migrations[2].Version != 10 ||
+		migrations[2].Down != "" ||
+		migrations[0].Checksum != checksum("CREATE TABLE `user` (`id` INT);") {
+		t.Error("wrong migrations", migrations)
+	}
+
+	migration, err := Create(dir, "add index", "CREATE INDEX `idx_age` ON `user` (`age`);", "DROP INDEX `idx_age` ON `user`;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrations, _ = Load(dir); len(migrations) != 4 || migrations[3].Name != "add_index" || migrations[3].Version != migration.Version {
+		t.Error("wrong created migration", migrations[3])
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("-- create user\nCREATE TABLE `user` (\n\t`name` VARCHAR(32) DEFAULT 'a;b'\n);\n\n# done\nINSERT INTO `user` VALUES (\"x;y\")")
+	if len(statements) != 2 ||
+		statements[0] != "CREATE TABLE `user` (\n\t`name` VARCHAR(32) DEFAULT 'a;b'\n)" ||
+		statements[1] != "INSERT INTO `user` VALUES (\"x;y\")" {
+		t.Errorf("wrong statements %q", statements)
+	}
+}
+
+func TestSplitStatementsComments(t *testing.T) {
+	for content, expect := range map[string][]string{
+		"CREATE TABLE a (id INT); -- don't forget\nCREATE TABLE b (id INT);\nCREATE TABLE c (id INT);": {
+			"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)", "CREATE TABLE c (id INT)",
+		},
+		"INSERT INTO a VALUES ('it\\'s; ok'); INSERT INTO a VALUES (\"say \\\"hi\\\"; \\\\\");": {
+			"INSERT INTO a VALUES ('it\\'s; ok')", "INSERT INTO a VALUES (\"say \\\"hi\\\"; \\\\\")",
+		},
+		"UPDATE a SET b = 1 # it's; done\nWHERE c = 2;": {
+			"UPDATE a SET b = 1 \nWHERE c = 2",
+		},
+		"/* don't; split */ CREATE TABLE a (id INT) /*!50100 ENGINE=InnoDB */; SELECT 3--1;": {
+			"CREATE TABLE a (id INT) /*!50100 ENGINE=InnoDB */", "SELECT 3--1",
+		},
+	} {
+		if statements := splitStatements(content); fmt.Sprintf("%q", statements) != fmt.Sprintf("%q", expect) {
+			t.Errorf("wrong statements of %q: %q", content, statements)
+		}
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "create_user", Up: "CREATE TABLE `user` (`id` INT);", Down: "DROP TABLE `user`;"},
+		{Version: 2, Name: "add_age", Up: "ALTER TABLE `user` ADD COLUMN `age` INT;\nALTER TABLE `user` ADD INDEX (`age`);", Down: "ALTER TABLE `user` DROP COLUMN `age`;"},
+		{Version: 3, Name: "create_log", Up: "CREATE TABLE `log` (`id` INT);"},
+	}
+	for _, migration := range migrations {
+		migration.Checksum = checksum(migration.Up)
+	}
+	conn := newHistoryConnector()
+	migrator := New(conn, migrations)
+
+	done, err := migrator.Up(2)
+	if err != nil || len(done) != 2 || len(conn.executed) != 3 || len(conn.rows) != 2 {
+		t.Fatal("wrong up", done, err, conn.executed)
+	}
+	if conn.owner != "" {
+		t.Error("lock is not released")
+	}
+	status, _ := migrator.Status()
+	if len(status) != 3 || !status[1].Applied || status[2].Applied {
+		t.Error("wrong status", status)
+	}
+
+	// the lock is held by another process
+	conn.owner = "another"
+	if _, err := migrator.LockTimeout(0).Up(0); !errors.Is(err, LOCK_TIMEOUT) {
+		t.Error("should be locked", err)
+	}
+	conn.owner = ""
+
+	if done, err := migrator.Down(0); err != nil || len(done) != 1 || done[0].Version != 2 || len(conn.rows) != 1 {
+		t.Error("wrong down", done, err)
+	}
+	if done, err := migrator.Up(0); err != nil || len(done) != 2 || len(conn.rows) != 3 {
+		t.Error("wrong up all", done, err)
+	}
+	if _, err := migrator.Down(1); !errors.Is(err, NO_DOWN_MIGRATION) {
+		t.Error("should have no down", err)
+	}
+
+	// an applied migration is changed
+	migrations[0].Checksum = checksum("changed")
+	if _, err := migrator.Up(0); !errors.Is(err, CHECKSUM_MISMATCH) {
+		t.Error("should be mismatched", err)
+	}
+	if status, _ := migrator.Status(); !status[0].Modified {
+		t.Error("should be modified", status[0])
+	}
+}
+
+func TestMigratorFail(t *testing.T) {
+	conn := newHistoryConnector()
+	conn.fail = "`log`"
+	migrations := []*Migration{
+		{Version: 1, Name: "create_user", Up: "CREATE TABLE `user` (`id` INT);"},
+		{Version: 2, Name: "create_log", Up: "CREATE TABLE `log` (`id` INT);"},
+	}
+	done, err := New(conn, migrations).Up(0)
+	if err == nil || len(done) != 1 || len(conn.rows) != 1 || conn.owner != "" {
+		t.Error("should stop at failed migration", done, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_create_user.up.sql":   "CREATE TABLE `user` (`id` INT);",
+		"1_create_user.down.sql": "DROP TABLE `user`;",
+	})
+	defer os.RemoveAll(dir)
+	conn := newHistoryConnector()
+	out := &bytes.Buffer{}
+	if err := Run(conn, dir, nil, []string{"migrate", "up"}, out); err != nil || out.String() != "up 1_create_user\n" {
+		t.Error("wrong up", err, out.String())
+	}
+	out.Reset()
+	if err := Run(conn, dir, nil, []string{"migrate", "status"}, out); err != nil || !strings.HasPrefix(out.String(), "1_create_user\tapplied at ") {
+		t.Error("wrong status", err, out.String())
+	}
+	out.Reset()
+	if err := Run(conn, dir, nil, []string{"migrate", "down", "x"}, out); err == nil {
+		t.Error("should fail on invalid steps")
+	}
+	if err := Run(conn, dir, nil, []string{"migrate", "plan"}, out); err == nil {
+		t.Error("should fail without schema")
+	}
+	if err := Run(conn, dir, nil, []string{"migrate", "unknown"}, out); err == nil {
+		t.Error("should fail on unknown command")
+	}
+}
+
+func TestMigratorHeartbeat(t *testing.T) {
+	migrations := []*Migration{{Version: 1, Name: "slow", Up: "ALTER TABLE `big` ADD COLUMN `SLOW` INT;"}}
+	conn := newHistoryConnector()
+	migrator := New(conn, migrations)
+	migrator.lockExpire = 30 * time.Millisecond
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	conn.mux.Lock()
+	defer conn.mux.Unlock()
+	if conn.heartbeats == 0 || conn.owner != "" {
+		t.Error("lock should be refreshed while migrating", conn.heartbeats, conn.owner)
+	}
+}
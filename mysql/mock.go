@@ -1,5 +1,6 @@
 package mysql
 
+// TestDB is a Connector doing nothing, use FakeDB to return results and check calls.
 type TestDB struct{}
 
 func NewTestDB() *TestDB {
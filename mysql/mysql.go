@@ -6,9 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"reflect"
 	"strconv"
-	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -21,29 +19,48 @@ var (
 
 // db is sql.DB connector implement Connector
 type db struct {
-	name string
-	conn *sql.DB
+	name   string
+	conn   *sql.DB
+	stmts  *stmtCache
+	logger *queryLogger
+	// traceId is logged with queries, which is set by GetContext with WithTraceId
+	traceId string
 }
 
 // tx is sql.Tx connector implement Connector
 type tx struct {
 	name string
 	conn *sql.Tx
+	// db is the db begins the transaction, whose prepared statements are reused
+	db *db
+	// savepoints is the count of savepoints created by Begin
+	savepoints int
+	logger     *queryLogger
+	traceId    string
 }
 
 // AddDB opens a mysql connection and store it into pool
 func AddDB(name, dsn string, maxOpen, maxIdle int) error {
-	conn, err := sql.Open("mysql", dsn)
+	conn, err := openDB(name, dsn, maxOpen, maxIdle)
 	if err != nil {
 		return err
 	}
+	p.store[name] = conn
+	return nil
+}
+
+func openDB(name, dsn string, maxOpen, maxIdle int) (*db, error) {
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
 	if err := conn.Ping(); err != nil {
-		return err
+		conn.Close()
+		return nil, err
 	}
 	conn.SetMaxOpenConns(maxOpen)
 	conn.SetMaxIdleConns(maxIdle)
-	p.store[name] = &db{name: name, conn: conn}
-	return nil
+	return &db{name: name, conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE), logger: newQueryLogger()}, nil
 }
 
 func (this *db) begin() (*sql.Tx, error) {
@@ -56,14 +73,27 @@ func (this *db) begin() (*sql.Tx, error) {
 	return conn, nil
 }
 
-func (this *db) prepare(query string) (*sql.Stmt, error) {
+func (this *db) prepare(query string) (*sql.Stmt, func(), error) {
+	if stmt, release, exist := this.stmts.get(query); exist {
+		return stmt, release, nil
+	}
 	stmt, err := this.conn.Prepare(query)
 	if err != nil {
 		// retry once on error
 		log.Warn("retry prepare on", err)
-		return this.conn.Prepare(query)
+		if stmt, err = this.conn.Prepare(query); err != nil {
+			return nil, nil, err
+		}
 	}
-	return stmt, nil
+	if !this.stmts.enabled() {
+		return stmt, func() { stmt.Close() }, nil
+	}
+	stmt, release := this.stmts.put(query, stmt)
+	return stmt, release, nil
+}
+
+func (this *db) evict(query string) {
+	this.stmts.remove(query)
 }
 
 func (this *db) exec(query string, args ...interface{}) (sql.Result, error) {
@@ -76,14 +106,38 @@ func (this *db) exec(query string, args ...interface{}) (sql.Result, error) {
 	return ret, nil
 }
 
-func (this *tx) prepare(query string) (*sql.Stmt, error) {
+// execOnce executes without retry, which is used by statements can not be sent again safely,
+// such as bulk insert and LOAD DATA, database/sql only retries them on driver.ErrBadConn
+func (this *db) execOnce(query string, args ...interface{}) (sql.Result, error) {
+	return this.conn.Exec(query, args...)
+}
+
+func (this *tx) prepare(query string) (*sql.Stmt, func(), error) {
+	// reuse the prepared statement of db
+	if this.db != nil && this.db.stmts.enabled() {
+		if stmt, release, err := this.db.prepare(query); err == nil {
+			txStmt := this.conn.Stmt(stmt)
+			return txStmt, func() {
+				txStmt.Close()
+				release()
+			}, nil
+		}
+	}
 	stmt, err := this.conn.Prepare(query)
 	if err != nil {
 		// retry once on error
 		log.Warn("retry prepare on", err)
-		return this.conn.Prepare(query)
+		if stmt, err = this.conn.Prepare(query); err != nil {
+			return nil, nil, err
+		}
+	}
+	return stmt, func() { stmt.Close() }, nil
+}
+
+func (this *tx) evict(query string) {
+	if this.db != nil {
+		this.db.evict(query)
 	}
-	return stmt, nil
 }
 
 func (this *tx) exec(query string, args ...interface{}) (sql.Result, error) {
@@ -96,6 +150,12 @@ func (this *tx) exec(query string, args ...interface{}) (sql.Result, error) {
 	return ret, nil
 }
 
+// execOnce executes without retry, which is used by statements can not be sent again safely,
+// such as bulk insert and LOAD DATA, database/sql only retries them on driver.ErrBadConn
+func (this *tx) execOnce(query string, args ...interface{}) (sql.Result, error) {
+	return this.conn.Exec(query, args...)
+}
+
 func (this *db) Begin() (Connector, error) {
 	name := this.name + "-" + token()
 	log.Debug(this.name, "begin", name)
@@ -104,8 +164,7 @@ func (this *db) Begin() (Connector, error) {
 		log.Error(this.name, "begin", err)
 		return nil, err
 	}
-	tx := &tx{name: name, conn: conn}
-	return tx, nil
+	return this.newTx(name, conn), nil
 }
 
 // Commit is not allow to query connector
@@ -123,85 +182,28 @@ func (this *db) Rollback() error {
 // Query select a set of data and bind into a dest list.
 // The destList should be an pointor of slice assembled by data model.
 func (this *db) Query(destList interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "query", sql, params)
-	stmt, err := this.prepare(sql)
-	if err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(params...)
-	if err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	if err := scanQueryRows(destList, rows); err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	return nil
+	return queryList(this, destList, sql, params)
+}
+
+// QueryRows queries rows for iterating, the rows should be closed after using.
+func (this *db) QueryRows(sql string, params ...interface{}) (*Rows, error) {
+	return queryRowsIter(this, sql, params)
 }
 
 // QueryOne select one data and bind into a dest object.
 // The destOjbect should be an pointer of data model.
 func (this *db) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "queryone", sql, params)
-	stmt, err := this.prepare(sql)
-	if err != nil {
-		log.Error(this.name, "queryone", err)
-		return err
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(params...)
-	if err != nil {
-		log.Error(this.name, "queryone", err)
-		return err
-	}
-	if err := scanQueryOne(destObject, rows); err != nil {
-		if err != NO_DATA_TO_BIND {
-			log.Error(this.name, "queryone", err)
-		}
-		return err
-	}
-	return nil
+	return queryOne(this, destObject, sql, params)
 }
 
 // Insert executes an insert sql and returns last insert id.
 func (this *db) Insert(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "insert", sql, params)
-	ret, err := this.exec(sql, params...)
-	if err != nil {
-		log.Error(this.name, "insert", err)
-		return 0, err
-	}
-	lastId, err := ret.LastInsertId()
-	if err != nil {
-		log.Error(this.name, "insert", err)
-		return 0, err
-	}
-	return lastId, nil
+	return insert(this, sql, params)
 }
 
 // Execute executes a sql and returns effected rows.
 func (this *db) Execute(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "execute", sql, params)
-	ret, err := this.exec(sql, params...)
-	if err != nil {
-		log.Error(this.name, "execute", err)
-		return 0, err
-	}
-	eff, err := ret.RowsAffected()
-	if err != nil {
-		log.Error(this.name, "execute", err)
-		return 0, err
-	}
-	return eff, nil
-}
-
-// Begin is not allow to transaction connector.
-func (this *tx) Begin() (Connector, error) {
-	log.Error(this.name, "begin", METHOD_NOT_ALLOW)
-	return nil, METHOD_NOT_ALLOW
+	return execute(this, sql, params)
 }
 
 // Commit commits a transaction
@@ -227,270 +229,116 @@ func (this *tx) Rollback() error {
 // Query select a set of data and bind into a dest list.
 // The destList should be an pointor of slice assembled by data model.
 func (this *tx) Query(destList interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "query", sql, params)
-	stmt, err := this.prepare(sql)
-	if err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(params...)
-	if err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	if err := scanQueryRows(destList, rows); err != nil {
-		log.Error(this.name, "query", err)
-		return err
-	}
-	return nil
+	return queryList(this, destList, sql, params)
+}
+
+// QueryRows queries rows for iterating, the rows should be closed after using.
+func (this *tx) QueryRows(sql string, params ...interface{}) (*Rows, error) {
+	return queryRowsIter(this, sql, params)
 }
 
 // QueryOne select one data and bind into a dest object.
 // The destOjbect should be an pointer of data model.
 func (this *tx) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "queryone", sql, params)
-	stmt, err := this.prepare(sql)
-	if err != nil {
-		log.Error(this.name, "queryone", err)
-		return err
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(params...)
-	if err != nil {
-		log.Error(this.name, "queryone", err)
-		return err
-	}
-	if err := scanQueryOne(destObject, rows); err != nil {
-		if err != NO_DATA_TO_BIND {
-			log.Error(this.name, "queryone", err)
-		}
-		return err
-	}
-	return nil
+	return queryOne(this, destObject, sql, params)
 }
 
 // Insert executes an insert sql and returns last insert id.
 func (this *tx) Insert(sql string, params ...interface{}) (lastInsertId int64, err error) {
-	log.Debug(this.name, "insert", sql, params)
-	ret, err := this.exec(sql, params...)
-	if err != nil {
-		log.Error(this.name, "insert", err)
-		return 0, err
-	}
-	lastId, err := ret.LastInsertId()
-	if err != nil {
-		log.Error(this.name, "insert", err)
-		return 0, err
-	}
-	return lastId, nil
+	return insert(this, sql, params)
 }
 
 // Execute executes a sql and returns effected rows.
 func (this *tx) Execute(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "execute", sql, params)
-	ret, err := this.exec(sql, params...)
-	if err != nil {
-		log.Error(this.name, "execute", err)
-		return 0, err
-	}
-	eff, err := ret.RowsAffected()
-	if err != nil {
-		log.Error(this.name, "execute", err)
-		return 0, err
-	}
-	return eff, nil
+	return execute(this, sql, params)
 }
 
-func scanQueryRows(dest interface{}, rows *sql.Rows) error {
-	defer rows.Close()
-	// dest 必须是 ptr
-	destType := reflect.TypeOf(dest)
-	if destType.Kind() != reflect.Ptr {
-		return fmt.Errorf("kelp.db.mysql: dest should be a ptr but %s %s", destType.Kind(), destType)
-	}
-	destValue := reflect.ValueOf(dest).Elem()
-	if !destValue.CanSet() {
-		return fmt.Errorf("kelp.db.mysql: dest can not set")
-	}
-	listType := destType.Elem()
+// queryExecutor is db or tx, which executes queries and logs them
+type queryExecutor interface {
+	executor
+	statementPreparer
+	// startLog starts the log of a query
+	startLog(method, query string, params []interface{}) *QueryLog
+	// finishLog logs a query with its error
+	finishLog(entry *QueryLog, err error)
+}
 
-	// list必须是slice
-	if listType.Kind() != reflect.Slice {
-		return fmt.Errorf("kelp.db.mysql: target should be a slice but %s %s", listType.Kind(), listType)
-	}
-	// 获取list的元素类型
-	eleType := listType.Elem()
-	isPointer := false
-	// 如果是指针类型，就再取真实类型
-	if eleType.Kind() == reflect.Ptr {
-		eleType = eleType.Elem()
-		isPointer = true
-	}
+// queryList queries rows into destList and logs the count of rows
+func queryList(conn queryExecutor, destList interface{}, sql string, params []interface{}) error {
+	entry := conn.startLog("query", sql, params)
+	rows, release, err := queryRows(conn, sql, params)
+	if err == nil {
+		err = scanQueryRows(destList, rows)
+		release()
+	}
+	entry.Rows = countList(destList)
+	conn.finishLog(entry, err)
+	return err
+}
 
-	// 必须要是struct类型
-	if eleType.Kind() != reflect.Struct {
-		return fmt.Errorf("kelp.db.mysql: target should be a []struct or a []*struct but []%s", eleType.Kind())
+// queryRowsIter queries rows for iterating and logs the time until the rows are returned
+func queryRowsIter(conn queryExecutor, sql string, params []interface{}) (*Rows, error) {
+	entry := conn.startLog("queryrows", sql, params)
+	// the rows are not counted until they are iterated
+	entry.Rows = -1
+	rows, release, err := queryRows(conn, sql, params)
+	conn.finishLog(entry, err)
+	if err != nil {
+		return nil, err
 	}
+	return newRows(rows, release)
+}
 
-	// 遍历查询结果
-	columnTypes, err := rows.ColumnTypes()
-	if err != nil {
-		return err
+// queryOne queries one row into destObject
+func queryOne(conn queryExecutor, destObject interface{}, sql string, params []interface{}) error {
+	entry := conn.startLog("queryone", sql, params)
+	rows, release, err := queryRows(conn, sql, params)
+	if err == nil {
+		err = scanQueryOne(destObject, rows)
+		release()
 	}
-	values := make([]interface{}, len(columnTypes))
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
+	if err == nil {
+		entry.Rows = 1
 	}
-	for rows.Next() {
-		// 根据field name和tag给元素赋值
-		err = rows.Scan(scanArgs...)
-		if err != nil {
-			return err
-		}
-		// 新建一个元素实例
-		eleAddr := reflect.New(eleType)
-		ele := eleAddr.Elem()
-		for i, col := range values {
-			key := columnTypes[i].Name()
-			for j := 0; j < ele.NumField(); j++ {
-				field := ele.Type().Field(j)
-				fieldName, ok := field.Tag.Lookup("column")
-				if !ok {
-					fieldName, ok = field.Tag.Lookup("json")
-					if ok {
-						fieldName = strings.Split(fieldName, ",")[0]
-					}
-				}
-				if !ok {
-					fieldName = strings.ToLower(field.Name)
-				}
-				if key == fieldName {
-					eleField := ele.FieldByName(field.Name)
-					if eleField.CanSet() {
-						switch field.Type.Kind() {
-						case reflect.Int:
-							eleField.Set(reflect.ValueOf(ToInt(col)))
-						case reflect.Int64:
-							eleField.Set(reflect.ValueOf(ToInt64(col)))
-						case reflect.Float64:
-							eleField.Set(reflect.ValueOf(ToFloat(col)))
-						case reflect.String:
-							eleField.Set(reflect.ValueOf(ToString(col)))
-						case reflect.Bool:
-							eleField.Set(reflect.ValueOf(ToBool(col)))
-						case reflect.Struct:
-							switch {
-							case field.Type.Name() == "Time":
-								eleField.Set(reflect.ValueOf(ToTime(col)))
-							}
-						default:
-							eleField.Set(reflect.ValueOf(col))
-						}
-					}
-				}
-			}
-		}
+	if err == NO_DATA_TO_BIND {
+		// no row is not an error of the query
+		conn.finishLog(entry, nil)
+	} else {
+		conn.finishLog(entry, err)
+	}
+	return err
+}
 
-		if isPointer {
-			// 元素是指针，要往slice里append指针
-			destValue.Set(reflect.Append(destValue, ele.Addr()))
-		} else {
-			destValue.Set(reflect.Append(destValue, ele))
-		}
+// insert executes sql and logs the count of affected rows
+func insert(conn queryExecutor, sql string, params []interface{}) (int64, error) {
+	entry := conn.startLog("insert", sql, params)
+	lastId := int64(0)
+	ret, err := conn.exec(sql, params...)
+	if err == nil {
+		entry.Rows, _ = ret.RowsAffected()
+		lastId, err = ret.LastInsertId()
 	}
-	if err = rows.Err(); err != nil {
-		return err
+	conn.finishLog(entry, err)
+	if err != nil {
+		return 0, err
 	}
-
-	return nil
+	return lastId, nil
 }
 
-func scanQueryOne(dest interface{}, rows *sql.Rows) error {
-	defer rows.Close()
-	if rows.Next() {
-		if dest == nil {
-			return nil
-		}
-		// dest 必须是 ptr
-		destType := reflect.TypeOf(dest)
-		if destType.Kind() != reflect.Ptr {
-			return fmt.Errorf("kelp.db.mysql: dest should be a ptr but %s", destType.Kind())
-		}
-		destValue := reflect.ValueOf(dest).Elem()
-		if !destValue.CanSet() {
-			return fmt.Errorf("kelp.db.mysql: dest can not set")
-		}
-		eleType := destType.Elem()
-		// 必须要是struct类型
-		if eleType.Kind() != reflect.Struct {
-			return fmt.Errorf("kelp.db.mysql: target should be a *struct but *%s", eleType.Kind())
-		}
-		// 遍历查询结果
-		columnTypes, err := rows.ColumnTypes()
-		if err != nil {
-			return err
-		}
-		values := make([]interface{}, len(columnTypes))
-		scanArgs := make([]interface{}, len(values))
-		for i := range values {
-			scanArgs[i] = &values[i]
-		}
-		// 新建一个元素实例
-		ele := destValue
-		err = rows.Scan(scanArgs...)
-		if err != nil {
-			return err
-		}
-		for i, col := range values {
-			key := columnTypes[i].Name()
-			for j := 0; j < ele.NumField(); j++ {
-				field := ele.Type().Field(j)
-				fieldName, ok := field.Tag.Lookup("column")
-				if !ok {
-					fieldName, ok = field.Tag.Lookup("json")
-					if ok {
-						fieldName = strings.Split(fieldName, ",")[0]
-					}
-				}
-				if !ok {
-					fieldName = strings.ToLower(field.Name)
-				}
-				if key == fieldName {
-					eleField := ele.FieldByName(field.Name)
-					if eleField.CanSet() {
-						switch field.Type.Kind() {
-						case reflect.Int:
-							eleField.Set(reflect.ValueOf(ToInt(col)))
-						case reflect.Int64:
-							eleField.Set(reflect.ValueOf(ToInt64(col)))
-						case reflect.Float64:
-							eleField.Set(reflect.ValueOf(ToFloat(col)))
-						case reflect.String:
-							eleField.Set(reflect.ValueOf(ToString(col)))
-						case reflect.Bool:
-							eleField.Set(reflect.ValueOf(ToBool(col)))
-						case reflect.Struct:
-							switch {
-							case field.Type.Name() == "Time":
-								eleField.Set(reflect.ValueOf(ToTime(col)))
-							}
-						default:
-							eleField.Set(reflect.ValueOf(col))
-						}
-					}
-				}
-			}
-		}
-	} else {
-		return NO_DATA_TO_BIND
+// execute executes sql and logs the count of affected rows
+func execute(conn queryExecutor, sql string, params []interface{}) (int64, error) {
+	entry := conn.startLog("execute", sql, params)
+	eff := int64(0)
+	ret, err := conn.exec(sql, params...)
+	if err == nil {
+		eff, err = ret.RowsAffected()
+		entry.Rows = eff
 	}
-
-	if err := rows.Err(); err != nil {
-		return err
+	conn.finishLog(entry, err)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return eff, nil
 }
 
 // 类型转换，任何类型转成int
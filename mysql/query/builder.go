@@ -0,0 +1,583 @@
+package query
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortElement is the same as mysql.SorterElement
+type SortElement interface {
+	GetField() string
+	GetReverse() bool
+}
+
+// PageElement is the same as mysql.PagerElement
+type PageElement interface {
+	GetSize() int64
+	GetOffset() int64
+}
+
+// writer collects sql and args, and keeps the first error
+type writer struct {
+	sql  []string
+	args []interface{}
+	err  error
+}
+
+func (this *writer) write(sql string, args ...interface{}) {
+	this.sql = append(this.sql, sql)
+	this.args = append(this.args, args...)
+}
+
+// expr writes prefix and the sql of e, nothing is written if the sql is empty
+func (this *writer) expr(prefix string, e Expr) {
+	sql, args, err := e.ToSql()
+	if err != nil {
+		if this.err == nil {
+			this.err = err
+		}
+		return
+	}
+	if sql != "" {
+		this.write(prefix+sql, args...)
+	}
+}
+
+func (this *writer) columns(columns []interface{}) {
+	sqls := []string{}
+	for _, c := range columns {
+		sql, args, err := column(c)
+		if err != nil && this.err == nil {
+			this.err = err
+		}
+		sqls = append(sqls, sql)
+		this.args = append(this.args, args...)
+	}
+	this.sql = append(this.sql, strings.Join(sqls, ", "))
+}
+
+func (this *writer) toSql() (string, []interface{}, error) {
+	if this.err != nil {
+		return "", nil, this.err
+	}
+	return strings.Join(this.sql, ""), this.args, nil
+}
+
+type join struct {
+	kind  string
+	table interface{}
+	on    []Expr
+}
+
+type order struct {
+	column string
+	desc   bool
+}
+
+func orderSql(orders []order) string {
+	sqls := []string{}
+	for _, o := range orders {
+		if o.desc {
+			sqls = append(sqls, Quote(o.column)+" DESC")
+		} else {
+			sqls = append(sqls, Quote(o.column)+" ASC")
+		}
+	}
+	return " ORDER BY " + strings.Join(sqls, ", ")
+}
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	columns   []interface{}
+	distinct  bool
+	from      interface{}
+	joins     []*join
+	where     []Expr
+	groupBy   []interface{}
+	having    []Expr
+	orders    []order
+	limit     int64
+	offset    int64
+	forUpdate bool
+}
+
+// Select starts a SELECT statement.
+// A column can be a name, which is quoted, or an Expr, such as query.Raw("COUNT(*) AS total").
+// All columns are selected if no column is given.
+func Select(columns ...interface{}) *SelectBuilder {
+	return &SelectBuilder{
+		columns: columns,
+		limit:   -1,
+		offset:  -1,
+	}
+}
+
+// Distinct selects distinct rows
+func (this *SelectBuilder) Distinct() *SelectBuilder {
+	this.distinct = true
+	return this
+}
+
+// From sets the table, which can have an alias, such as "user AS u"
+func (this *SelectBuilder) From(table string) *SelectBuilder {
+	this.from = table
+	return this
+}
+
+// FromSub selects from a subquery with alias
+func (this *SelectBuilder) FromSub(sub *SelectBuilder, alias string) *SelectBuilder {
+	this.from = &aliasExpr{sub, alias}
+	return this
+}
+
+// Join adds an INNER JOIN, on conds are joined with AND
+func (this *SelectBuilder) Join(table string, on ...Expr) *SelectBuilder {
+	this.joins = append(this.joins, &join{"INNER JOIN", table, on})
+	return this
+}
+
+// LeftJoin adds a LEFT JOIN
+func (this *SelectBuilder) LeftJoin(table string, on ...Expr) *SelectBuilder {
+	this.joins = append(this.joins, &join{"LEFT JOIN", table, on})
+	return this
+}
+
+// RightJoin adds a RIGHT JOIN
+func (this *SelectBuilder) RightJoin(table string, on ...Expr) *SelectBuilder {
+	this.joins = append(this.joins, &join{"RIGHT JOIN", table, on})
+	return this
+}
+
+// JoinSub adds an INNER JOIN with a subquery
+func (this *SelectBuilder) JoinSub(sub *SelectBuilder, alias string, on ...Expr) *SelectBuilder {
+	this.joins = append(this.joins, &join{"INNER JOIN", &aliasExpr{sub, alias}, on})
+	return this
+}
+
+// Where adds conds, all conds are joined with AND, use query.Or for OR
+func (this *SelectBuilder) Where(conds ...Expr) *SelectBuilder {
+	this.where = append(this.where, conds...)
+	return this
+}
+
+// GroupBy adds GROUP BY columns
+func (this *SelectBuilder) GroupBy(columns ...interface{}) *SelectBuilder {
+	this.groupBy = append(this.groupBy, columns...)
+	return this
+}
+
+// Having adds HAVING conds, which are joined with AND
+func (this *SelectBuilder) Having(conds ...Expr) *SelectBuilder {
+	this.having = append(this.having, conds...)
+	return this
+}
+
+// OrderBy adds an ORDER BY column
+func (this *SelectBuilder) OrderBy(column string, desc bool) *SelectBuilder {
+	this.orders = append(this.orders, order{column, desc})
+	return this
+}
+
+// Sort adds ORDER BY columns from sort elements, the fields are quoted
+func (this *SelectBuilder) Sort(elements ...SortElement) *SelectBuilder {
+	for _, element := range elements {
+		this.OrderBy(element.GetField(), element.GetReverse())
+	}
+	return this
+}
+
+// Limit sets LIMIT
+func (this *SelectBuilder) Limit(limit int64) *SelectBuilder {
+	this.limit = limit
+	return this
+}
+
+// Offset sets OFFSET, which is only used with Limit
+func (this *SelectBuilder) Offset(offset int64) *SelectBuilder {
+	this.offset = offset
+	return this
+}
+
+// Page sets LIMIT and OFFSET from a page element, nothing is set if size is not positive
+func (this *SelectBuilder) Page(element PageElement) *SelectBuilder {
+	if element.GetSize() > 0 {
+		this.limit = element.GetSize()
+		this.offset = element.GetOffset()
+	}
+	return this
+}
+
+// ForUpdate locks the selected rows in a transaction
+func (this *SelectBuilder) ForUpdate() *SelectBuilder {
+	this.forUpdate = true
+	return this
+}
+
+// ToSql returns the sql and bind args
+func (this *SelectBuilder) ToSql() (string, []interface{}, error) {
+	w := &writer{}
+	w.write("SELECT ")
+	if this.distinct {
+		w.write("DISTINCT ")
+	}
+	if len(this.columns) == 0 {
+		w.write("*")
+	} else {
+		w.columns(this.columns)
+	}
+	if this.from != nil {
+		w.write(" FROM ")
+		w.columns([]interface{}{this.from})
+	}
+	for _, j := range this.joins {
+		w.write(" " + j.kind + " ")
+		w.columns([]interface{}{j.table})
+		w.expr(" ON ", And(j.on...))
+	}
+	w.expr(" WHERE ", And(this.where...))
+	if len(this.groupBy) > 0 {
+		w.write(" GROUP BY ")
+		w.columns(this.groupBy)
+	}
+	w.expr(" HAVING ", And(this.having...))
+	if len(this.orders) > 0 {
+		w.write(orderSql(this.orders))
+	}
+	if this.limit >= 0 {
+		w.write(" LIMIT " + strconv.FormatInt(this.limit, 10))
+		if this.offset >= 0 {
+			w.write(" OFFSET " + strconv.FormatInt(this.offset, 10))
+		}
+	}
+	if this.forUpdate {
+		w.write(" FOR UPDATE")
+	}
+	return w.toSql()
+}
+
+// Query runs the statement and binds rows into destList, see mysql.Connector.Query
+func (this *SelectBuilder) Query(conn Connector, destList interface{}) error {
+	sql, args, err := this.ToSql()
+	if err != nil {
+		return err
+	}
+	return conn.Query(destList, sql, args...)
+}
+
+// QueryOne runs the statement and binds the first row into destObject, see mysql.Connector.QueryOne
+func (this *SelectBuilder) QueryOne(conn Connector, destObject interface{}) error {
+	sql, args, err := this.ToSql()
+	if err != nil {
+		return err
+	}
+	return conn.QueryOne(destObject, sql, args...)
+}
+
+type aliasExpr struct {
+	expr  Expr
+	alias string
+}
+
+func (this *aliasExpr) ToSql() (string, []interface{}, error) {
+	sql, args, err := value(this.expr)
+	return sql + " AS " + quoteName(this.alias), args, err
+}
+
+// InsertBuilder builds an INSERT statement
+type InsertBuilder struct {
+	verb    string
+	table   string
+	ignore  bool
+	columns []string
+	rows    [][]interface{}
+	sub     *SelectBuilder
+	updates []string
+	keeps   []string
+}
+
+// Insert starts an INSERT statement
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{verb: "INSERT", table: table}
+}
+
+// Replace starts a REPLACE statement
+func Replace(table string) *InsertBuilder {
+	return &InsertBuilder{verb: "REPLACE", table: table}
+}
+
+// Ignore uses INSERT IGNORE
+func (this *InsertBuilder) Ignore() *InsertBuilder {
+	this.ignore = true
+	return this
+}
+
+// Columns sets the columns to insert
+func (this *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	this.columns = columns
+	return this
+}
+
+// Values adds a row, a value can be an Expr, such as query.Raw("NOW()")
+func (this *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	this.rows = append(this.rows, values)
+	return this
+}
+
+// SetMap sets columns and a row from a map, the columns are sorted
+func (this *InsertBuilder) SetMap(data map[string]interface{}) *InsertBuilder {
+	this.columns = sortedKeys(data)
+	row := []interface{}{}
+	for _, c := range this.columns {
+		row = append(row, data[c])
+	}
+	this.rows = [][]interface{}{row}
+	return this
+}
+
+// Select inserts rows selected by a subquery
+func (this *InsertBuilder) Select(sub *SelectBuilder) *InsertBuilder {
+	this.sub = sub
+	return this
+}
+
+// OnDuplicateKeyUpdate updates columns with the inserted values when a primary or unique key conflicts
+func (this *InsertBuilder) OnDuplicateKeyUpdate(columns ...string) *InsertBuilder {
+	this.updates = append(this.updates, columns...)
+	return this
+}
+
+// OnDuplicateKeyKeep keeps columns unchanged when a primary or unique key conflicts,
+// which ignores the conflict without INSERT IGNORE, so that other errors are still reported
+func (this *InsertBuilder) OnDuplicateKeyKeep(columns ...string) *InsertBuilder {
+	this.keeps = append(this.keeps, columns...)
+	return this
+}
+
+// ToSql returns the sql and bind args
+func (this *InsertBuilder) ToSql() (string, []interface{}, error) {
+	if this.table == "" {
+		return "", nil, EMPTY_TABLE
+	}
+	if this.sub == nil && len(this.rows) == 0 {
+		return "", nil, EMPTY_VALUES
+	}
+	w := &writer{}
+	w.write(this.verb)
+	if this.ignore {
+		w.write(" IGNORE")
+	}
+	w.write(" INTO " + Quote(this.table))
+	if len(this.columns) > 0 {
+		columns := []string{}
+		for _, c := range this.columns {
+			columns = append(columns, Quote(c))
+		}
+		w.write(" (" + strings.Join(columns, ", ") + ")")
+	}
+	if this.sub != nil {
+		w.expr(" ", this.sub)
+	} else {
+		this.writeValues(w)
+	}
+	if len(this.updates) > 0 || len(this.keeps) > 0 {
+		updates := []string{}
+		for _, c := range this.updates {
+			updates = append(updates, Quote(c)+" = VALUES("+Quote(c)+")")
+		}
+		for _, c := range this.keeps {
+			updates = append(updates, Quote(c)+" = "+Quote(c))
+		}
+		w.write(" ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", "))
+	}
+	return w.toSql()
+}
+
+func (this *InsertBuilder) writeValues(w *writer) {
+	w.write(" VALUES ")
+	for i, row := range this.rows {
+		if len(this.columns) > 0 && len(row) != len(this.columns) {
+			w.err = COLUMNS_MISMATCH
+			return
+		}
+		if i > 0 {
+			w.write(", ")
+		}
+		values := []string{}
+		for _, v := range row {
+			sql, args, err := value(v)
+			if err != nil {
+				w.err = err
+				return
+			}
+			values = append(values, sql)
+			w.args = append(w.args, args...)
+		}
+		w.write("(" + strings.Join(values, ", ") + ")")
+	}
+}
+
+// Insert runs the statement and returns last insert id, see mysql.Connector.Insert
+func (this *InsertBuilder) Insert(conn Connector) (int64, error) {
+	sql, args, err := this.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Insert(sql, args...)
+}
+
+type assignment struct {
+	column string
+	value  interface{}
+}
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	table  string
+	sets   []assignment
+	where  []Expr
+	orders []order
+	limit  int64
+}
+
+// Update starts an UPDATE statement
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table, limit: -1}
+}
+
+// Set sets a column, the value can be an Expr, such as query.Raw("`count` + ?", 1)
+func (this *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	this.sets = append(this.sets, assignment{column, value})
+	return this
+}
+
+// SetMap sets columns from a map, the columns are sorted
+func (this *UpdateBuilder) SetMap(data map[string]interface{}) *UpdateBuilder {
+	for _, c := range sortedKeys(data) {
+		this.Set(c, data[c])
+	}
+	return this
+}
+
+// Where adds conds, which are joined with AND
+func (this *UpdateBuilder) Where(conds ...Expr) *UpdateBuilder {
+	this.where = append(this.where, conds...)
+	return this
+}
+
+// OrderBy adds an ORDER BY column
+func (this *UpdateBuilder) OrderBy(column string, desc bool) *UpdateBuilder {
+	this.orders = append(this.orders, order{column, desc})
+	return this
+}
+
+// Limit sets LIMIT
+func (this *UpdateBuilder) Limit(limit int64) *UpdateBuilder {
+	this.limit = limit
+	return this
+}
+
+// ToSql returns the sql and bind args
+func (this *UpdateBuilder) ToSql() (string, []interface{}, error) {
+	if this.table == "" {
+		return "", nil, EMPTY_TABLE
+	}
+	if len(this.sets) == 0 {
+		return "", nil, EMPTY_SET
+	}
+	w := &writer{}
+	w.write("UPDATE " + Quote(this.table) + " SET ")
+	for i, set := range this.sets {
+		if i > 0 {
+			w.write(", ")
+		}
+		sql, args, err := value(set.value)
+		if err != nil {
+			return "", nil, err
+		}
+		w.write(Quote(set.column)+" = "+sql, args...)
+	}
+	w.expr(" WHERE ", And(this.where...))
+	if len(this.orders) > 0 {
+		w.write(orderSql(this.orders))
+	}
+	if this.limit >= 0 {
+		w.write(" LIMIT " + strconv.FormatInt(this.limit, 10))
+	}
+	return w.toSql()
+}
+
+// Execute runs the statement and returns affected rows, see mysql.Connector.Execute
+func (this *UpdateBuilder) Execute(conn Connector) (int64, error) {
+	sql, args, err := this.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Execute(sql, args...)
+}
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	table  string
+	where  []Expr
+	orders []order
+	limit  int64
+}
+
+// Delete starts a DELETE statement
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table, limit: -1}
+}
+
+// Where adds conds, which are joined with AND
+func (this *DeleteBuilder) Where(conds ...Expr) *DeleteBuilder {
+	this.where = append(this.where, conds...)
+	return this
+}
+
+// OrderBy adds an ORDER BY column
+func (this *DeleteBuilder) OrderBy(column string, desc bool) *DeleteBuilder {
+	this.orders = append(this.orders, order{column, desc})
+	return this
+}
+
+// Limit sets LIMIT
+func (this *DeleteBuilder) Limit(limit int64) *DeleteBuilder {
+	this.limit = limit
+	return this
+}
+
+// ToSql returns the sql and bind args
+func (this *DeleteBuilder) ToSql() (string, []interface{}, error) {
+	if this.table == "" {
+		return "", nil, EMPTY_TABLE
+	}
+	w := &writer{}
+	w.write("DELETE FROM " + Quote(this.table))
+	w.expr(" WHERE ", And(this.where...))
+	if len(this.orders) > 0 {
+		w.write(orderSql(this.orders))
+	}
+	if this.limit >= 0 {
+		w.write(" LIMIT " + strconv.FormatInt(this.limit, 10))
+	}
+	return w.toSql()
+}
+
+// Execute runs the statement and returns affected rows, see mysql.Connector.Execute
+func (this *DeleteBuilder) Execute(conn Connector) (int64, error) {
+	sql, args, err := this.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Execute(sql, args...)
+}
+
+func sortedKeys(data map[string]interface{}) []string {
+	keys := []string{}
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
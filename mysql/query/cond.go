@@ -0,0 +1,291 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+)
+
+type compare struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+// Eq is column = value, or column IS NULL if value is nil
+func Eq(column string, value interface{}) Expr {
+	return &compare{column, "=", value}
+}
+
+// Ne is column <> value, or column IS NOT NULL if value is nil
+func Ne(column string, value interface{}) Expr {
+	return &compare{column, "<>", value}
+}
+
+// Gt is column > value
+func Gt(column string, value interface{}) Expr {
+	return &compare{column, ">", value}
+}
+
+// Gte is column >= value
+func Gte(column string, value interface{}) Expr {
+	return &compare{column, ">=", value}
+}
+
+// Lt is column < value
+func Lt(column string, value interface{}) Expr {
+	return &compare{column, "<", value}
+}
+
+// Lte is column <= value
+func Lte(column string, value interface{}) Expr {
+	return &compare{column, "<=", value}
+}
+
+// Like is column LIKE pattern, % and _ in pattern are wildcards
+func Like(column string, pattern interface{}) Expr {
+	return &compare{column, "LIKE", pattern}
+}
+
+// NotLike is column NOT LIKE pattern
+func NotLike(column string, pattern interface{}) Expr {
+	return &compare{column, "NOT LIKE", pattern}
+}
+
+func (this *compare) ToSql() (string, []interface{}, error) {
+	if this.value == nil {
+		switch this.op {
+		case "=":
+			return IsNull(this.column).ToSql()
+		case "<>":
+			return IsNotNull(this.column).ToSql()
+		}
+	}
+	sql, args, err := value(this.value)
+	return Quote(this.column) + " " + this.op + " " + sql, args, err
+}
+
+type in struct {
+	column string
+	not    bool
+	values []interface{}
+}
+
+// In is column IN (values...).
+// The values can be a slice, or a subquery.
+// If there is no value, it is always false.
+func In(column string, values ...interface{}) Expr {
+	return &in{column, false, values}
+}
+
+// NotIn is column NOT IN (values...), if there is no value, it is always true
+func NotIn(column string, values ...interface{}) Expr {
+	return &in{column, true, values}
+}
+
+func (this *in) ToSql() (string, []interface{}, error) {
+	op := " IN "
+	if this.not {
+		op = " NOT IN "
+	}
+	values := this.values
+	if len(values) == 1 {
+		if sub, ok := values[0].(Expr); ok {
+			sql, args, err := sub.ToSql()
+			return Quote(this.column) + op + "(" + sql + ")", args, err
+		}
+		if v := reflect.ValueOf(values[0]); (v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8) ||
+			v.Kind() == reflect.Array {
+			values = make([]interface{}, v.Len())
+			for i := range values {
+				values[i] = v.Index(i).Interface()
+			}
+		}
+	}
+	if len(values) == 0 {
+		if this.not {
+			return "1 = 1", nil, nil
+		}
+		return "1 = 0", nil, nil
+	}
+	sqls := []string{}
+	args := []interface{}{}
+	for _, v := range values {
+		sql, vArgs, err := value(v)
+		if err != nil {
+			return "", nil, err
+		}
+		sqls = append(sqls, sql)
+		args = append(args, vArgs...)
+	}
+	return Quote(this.column) + op + "(" + strings.Join(sqls, ",") + ")", args, nil
+}
+
+type between struct {
+	column string
+	not    bool
+	from   interface{}
+	to     interface{}
+}
+
+// Between is column BETWEEN from AND to
+func Between(column string, from, to interface{}) Expr {
+	return &between{column, false, from, to}
+}
+
+// NotBetween is column NOT BETWEEN from AND to
+func NotBetween(column string, from, to interface{}) Expr {
+	return &between{column, true, from, to}
+}
+
+func (this *between) ToSql() (string, []interface{}, error) {
+	fromSql, fromArgs, err := value(this.from)
+	if err != nil {
+		return "", nil, err
+	}
+	toSql, toArgs, err := value(this.to)
+	if err != nil {
+		return "", nil, err
+	}
+	op := " BETWEEN "
+	if this.not {
+		op = " NOT BETWEEN "
+	}
+	return Quote(this.column) + op + fromSql + " AND " + toSql, append(fromArgs, toArgs...), nil
+}
+
+type null struct {
+	column string
+	not    bool
+}
+
+// IsNull is column IS NULL
+func IsNull(column string) Expr {
+	return &null{column, false}
+}
+
+// IsNotNull is column IS NOT NULL
+func IsNotNull(column string) Expr {
+	return &null{column, true}
+}
+
+func (this *null) ToSql() (string, []interface{}, error) {
+	if this.not {
+		return Quote(this.column) + " IS NOT NULL", nil, nil
+	}
+	return Quote(this.column) + " IS NULL", nil, nil
+}
+
+type exists struct {
+	sub *SelectBuilder
+	not bool
+}
+
+// Exists is EXISTS (subquery)
+func Exists(sub *SelectBuilder) Expr {
+	return &exists{sub, false}
+}
+
+// NotExists is NOT EXISTS (subquery)
+func NotExists(sub *SelectBuilder) Expr {
+	return &exists{sub, true}
+}
+
+func (this *exists) ToSql() (string, []interface{}, error) {
+	sql, args, err := value(this.sub)
+	if this.not {
+		return "NOT EXISTS " + sql, args, err
+	}
+	return "EXISTS " + sql, args, err
+}
+
+type not struct {
+	cond Expr
+}
+
+// Not is NOT (cond)
+func Not(cond Expr) Expr {
+	return &not{cond}
+}
+
+func (this *not) ToSql() (string, []interface{}, error) {
+	sql, args, err := this.cond.ToSql()
+	return "NOT (" + sql + ")", args, err
+}
+
+type group struct {
+	op    string
+	conds []Expr
+}
+
+// And joins conds with AND, nil conds are skipped
+func And(conds ...Expr) Expr {
+	return &group{" AND ", conds}
+}
+
+// Or joins conds with OR, nil conds are skipped
+func Or(conds ...Expr) Expr {
+	return &group{" OR ", conds}
+}
+
+func (this *group) ToSql() (string, []interface{}, error) {
+	sqls := []string{}
+	terms := []bool{}
+	args := []interface{}{}
+	for _, cond := range this.conds {
+		if cond == nil {
+			continue
+		}
+		sql, condArgs, err := cond.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		if sql == "" {
+			continue
+		}
+		sqls = append(sqls, sql)
+		terms = append(terms, this.isTerm(cond))
+		args = append(args, condArgs...)
+	}
+	if len(sqls) > 1 {
+		for i, term := range terms {
+			if !term {
+				sqls[i] = "(" + sqls[i] + ")"
+			}
+		}
+	}
+	return strings.Join(sqls, this.op), args, nil
+}
+
+// isTerm returns true if cond can be joined without brackets,
+// such as a comparison or a nested group with the same operator.
+// Others, such as Raw and Not, are put in brackets, which may contain OR.
+func (this *group) isTerm(cond Expr) bool {
+	switch e := cond.(type) {
+	case *compare, *in, *between, *null, *exists, col:
+		return true
+	case *group:
+		if e.op == this.op {
+			return true
+		}
+		// a group of one cond is the cond itself
+		if e.size() == 1 {
+			for _, sub := range e.conds {
+				if sub != nil {
+					return this.isTerm(sub)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// size returns the count of conds which are not nil
+func (this *group) size() int {
+	n := 0
+	for _, cond := range this.conds {
+		if cond != nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+/*
+Package query builds mysql statements with bind args.
+
+Identifiers are always quoted with backticks and values are always bound with ?,
+so that user input can be used as column names, sort fields or values safely.
+The sql and args can be passed to mysql.Connector directly:
+
+	sql, args, err := query.Select("id", "name").
+		From("user").
+		Where(
+			query.Eq("status", 1),
+			query.Or(query.Like("name", "kelp%"), query.Gt("age", 18)),
+		).
+		OrderBy("id", true).
+		Limit(10).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	err = conn.Query(&users, sql, args...)
+
+Or run the builder with a connector:
+
+	err := query.Select().From("user").Where(query.Eq("id", 1)).QueryOne(conn, &user)
+*/
+package query
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	EMPTY_TABLE      = errors.New("kelp.mysql.query: table is empty")
+	EMPTY_SET        = errors.New("kelp.mysql.query: nothing to set")
+	EMPTY_VALUES     = errors.New("kelp.mysql.query: no values to insert")
+	COLUMNS_MISMATCH = errors.New("kelp.mysql.query: count of values does not match columns")
+)
+
+// Expr is a sql fragment with bind args, such as a condition or a subquery
+type Expr interface {
+	ToSql() (string, []interface{}, error)
+}
+
+// Connector is the part of mysql.Connector used to run statements
+type Connector interface {
+	Query(destList interface{}, sql string, params ...interface{}) error
+	QueryOne(destObject interface{}, sql string, params ...interface{}) error
+	Insert(sql string, params ...interface{}) (lastInsertId int64, err error)
+	Execute(sql string, params ...interface{}) (affectRows int64, err error)
+}
+
+var aliasRegexp = regexp.MustCompile(`(?i)\s+as\s+`)
+
+// Quote quotes an identifier with backticks, such as user.id to `user`.`id`.
+// Backticks in identifier are escaped and * is kept,
+// an alias can be given with AS, such as "user.name AS user_name".
+func Quote(name string) string {
+	if parts := aliasRegexp.Split(strings.TrimSpace(name), 2); len(parts) == 2 {
+		return Quote(parts[0]) + " AS " + quoteName(parts[1])
+	}
+	ret := []string{}
+	for _, part := range strings.Split(strings.TrimSpace(name), ".") {
+		if part == "*" {
+			ret = append(ret, part)
+		} else {
+			ret = append(ret, quoteName(part))
+		}
+	}
+	return strings.Join(ret, ".")
+}
+
+func quoteName(name string) string {
+	return "`" + strings.Replace(strings.TrimSpace(name), "`", "``", -1) + "`"
+}
+
+type raw struct {
+	sql  string
+	args []interface{}
+}
+
+// Raw is a sql fragment written by developer, which is used as it is.
+// Never put user input into sql, bind it with ? and args instead.
+func Raw(sql string, args ...interface{}) Expr {
+	return &raw{sql, args}
+}
+
+func (this *raw) ToSql() (string, []interface{}, error) {
+	return this.sql, this.args, nil
+}
+
+type col string
+
+// Col is a column used as a value, such as query.Eq("user.id", query.Col("order.user_id"))
+func Col(name string) Expr {
+	return col(name)
+}
+
+func (this col) ToSql() (string, []interface{}, error) {
+	return Quote(string(this)), nil, nil
+}
+
+// value returns the sql of a value, a subquery is put in brackets
+func value(v interface{}) (string, []interface{}, error) {
+	switch e := v.(type) {
+	case *SelectBuilder:
+		sql, args, err := e.ToSql()
+		return "(" + sql + ")", args, err
+	case Expr:
+		return e.ToSql()
+	}
+	return "?", []interface{}{v}, nil
+}
+
+// column returns the sql of a column, which can be a name or an Expr
+func column(c interface{}) (string, []interface{}, error) {
+	if name, ok := c.(string); ok {
+		return Quote(name), nil, nil
+	}
+	return value(c)
+}
@@ -0,0 +1,254 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	for name, expect := range map[string]string{
+		"id":                  "`id`",
+		"user.id":             "`user`.`id`",
+		"u.*":                 "`u`.*",
+		"*":                   "*",
+		"user.name AS u_name": "`user`.`name` AS `u_name`",
+		"user as u":           "`user` AS `u`",
+		"id`; DROP TABLE a":   "`id``; DROP TABLE a`",
+	} {
+		if actual := Quote(name); actual != expect {
+			t.Error("quote", name, "should be", expect, "but", actual)
+		}
+	}
+}
+
+type sqlCase struct {
+	builder Expr
+	sql     string
+	args    []interface{}
+}
+
+func assertSql(t *testing.T, cases []sqlCase) {
+	t.Helper()
+	for _, c := range cases {
+		sql, args, err := c.builder.ToSql()
+		if err != nil {
+			t.Error("build", c.sql, "failed", err)
+			continue
+		}
+		if args == nil {
+			args = []interface{}{}
+		}
+		if sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Error("sql should be", c.sql, c.args, "but", sql, args)
+		}
+	}
+}
+
+func TestCond(t *testing.T) {
+	assertSql(t, []sqlCase{
+		{Eq("a", 1), "`a` = ?", []interface{}{1}},
+		{Eq("a", nil), "`a` IS NULL", []interface{}{}},
+		{Ne("a", nil), "`a` IS NOT NULL", []interface{}{}},
+		{Gte("a", 1), "`a` >= ?", []interface{}{1}},
+		{Like("name", "k%"), "`name` LIKE ?", []interface{}{"k%"}},
+		{NotLike("name", "k%"), "`name` NOT LIKE ?", []interface{}{"k%"}},
+		{In("id", 1, 2), "`id` IN (?,?)", []interface{}{1, 2}},
+		{In("id", []int64{1, 2}), "`id` IN (?,?)", []interface{}{int64(1), int64(2)}},
+		{In("id", []int{}), "1 = 0", []interface{}{}},
+		{NotIn("id"), "1 = 1", []interface{}{}},
+		{In("data", []byte("a")), "`data` IN (?)", []interface{}{[]byte("a")}},
+		{Between("age", 1, 10), "`age` BETWEEN ? AND ?", []interface{}{1, 10}},
+		{NotBetween("age", 1, 10), "`age` NOT BETWEEN ? AND ?", []interface{}{1, 10}},
+		{IsNull("deleted_at"), "`deleted_at` IS NULL", []interface{}{}},
+		{Not(Eq("a", 1)), "NOT (`a` = ?)", []interface{}{1}},
+		{Eq("u.id", Col("o.user_id")), "`u`.`id` = `o`.`user_id`", []interface{}{}},
+		{
+			And(Eq("a", 1), nil, Or(Eq("b", 2), And(Eq("c", 3), Eq("d", 4))), Or(Eq("e", 5))),
+			"`a` = ? AND (`b` = ? OR (`c` = ? AND `d` = ?)) AND `e` = ?",
+			[]interface{}{1, 2, 3, 4, 5},
+		},
+		{Raw("`count` > ? + 1", 2), "`count` > ? + 1", []interface{}{2}},
+		{
+			And(Eq("a", 1), Raw("b = ? OR c = ?", 2, 3), Not(Eq("d", 4))),
+			"`a` = ? AND (b = ? OR c = ?) AND (NOT (`d` = ?))",
+			[]interface{}{1, 2, 3, 4},
+		},
+		{And(Eq("a", 1), Or(Raw("b = 1 OR c = 1"))), "`a` = ? AND (b = 1 OR c = 1)", []interface{}{1}},
+		{In("id", Raw("SELECT id FROM v")), "`id` IN (SELECT id FROM v)", []interface{}{}},
+		{
+			Select().From("u").Where(Eq("a", 1), Raw("b = ? OR c = ?", 2, 3)),
+			"SELECT * FROM `u` WHERE `a` = ? AND (b = ? OR c = ?)",
+			[]interface{}{1, 2, 3},
+		},
+	})
+}
+
+type sortForTest struct {
+	field   string
+	reverse bool
+}
+
+func (this *sortForTest) GetField() string {
+	return this.field
+}
+
+func (this *sortForTest) GetReverse() bool {
+	return this.reverse
+}
+
+type pageForTest struct {
+	size   int64
+	offset int64
+}
+
+func (this *pageForTest) GetSize() int64 {
+	return this.size
+}
+
+func (this *pageForTest) GetOffset() int64 {
+	return this.offset
+}
+
+func TestSelect(t *testing.T) {
+	assertSql(t, []sqlCase{
+		{Select().From("user"), "SELECT * FROM `user`", []interface{}{}},
+		{
+			Select("id", "name").Distinct().From("user").
+				Where(Eq("status", 1), Or(Like("name", "k%"), Gt("age", 18))).
+				OrderBy("id", true).
+				Limit(10).
+				Offset(20),
+			"SELECT DISTINCT `id`, `name` FROM `user` WHERE `status` = ? AND (`name` LIKE ? OR `age` > ?) ORDER BY `id` DESC LIMIT 10 OFFSET 20",
+			[]interface{}{1, "k%", 18},
+		},
+		{
+			Select("u.name", Raw("COUNT(*) AS total")).From("user AS u").
+				LeftJoin("order AS o", Eq("o.user_id", Col("u.id")), Eq("o.status", 2)).
+				GroupBy("u.name").
+				Having(Raw("COUNT(*) > ?", 1)),
+			"SELECT `u`.`name`, COUNT(*) AS total FROM `user` AS `u` LEFT JOIN `order` AS `o` ON `o`.`user_id` = `u`.`id` AND `o`.`status` = ? GROUP BY `u`.`name` HAVING COUNT(*) > ?",
+			[]interface{}{2, 1},
+		},
+		{
+			Select().From("user").
+				Where(In("id", Select("user_id").From("order").Where(Gt("amount", 100)))).
+				Where(Exists(Select("id").From("vip").Where(Eq("vip.user_id", Col("user.id"))))),
+			"SELECT * FROM `user` WHERE `id` IN (SELECT `user_id` FROM `order` WHERE `amount` > ?) AND EXISTS (SELECT `id` FROM `vip` WHERE `vip`.`user_id` = `user`.`id`)",
+			[]interface{}{100},
+		},
+		{
+			Select("t.n").FromSub(Select(Raw("COUNT(*) AS n")).From("user").Where(Eq("a", 1)), "t").
+				JoinSub(Select("id").From("b"), "b", Eq("b.id", Col("t.n"))),
+			"SELECT `t`.`n` FROM (SELECT COUNT(*) AS n FROM `user` WHERE `a` = ?) AS `t` INNER JOIN (SELECT `id` FROM `b`) AS `b` ON `b`.`id` = `t`.`n`",
+			[]interface{}{1},
+		},
+		{
+			Select().From("user").Sort(&sortForTest{"name; DROP TABLE user", false}).Page(&pageForTest{10, 30}).ForUpdate(),
+			"SELECT * FROM `user` ORDER BY `name; DROP TABLE user` ASC LIMIT 10 OFFSET 30 FOR UPDATE",
+			[]interface{}{},
+		},
+	})
+}
+
+func TestInsertUpdateDelete(t *testing.T) {
+	assertSql(t, []sqlCase{
+		{
+			Insert("user").Columns("name", "age").Values("a", 1).Values("b", Raw("DEFAULT")),
+			"INSERT INTO `user` (`name`, `age`) VALUES (?, ?), (?, DEFAULT)",
+			[]interface{}{"a", 1, "b"},
+		},
+		{
+			Insert("user").Ignore().SetMap(map[string]interface{}{"name": "a", "age": 1}),
+			"INSERT IGNORE INTO `user` (`age`, `name`) VALUES (?, ?)",
+			[]interface{}{1, "a"},
+		},
+		{
+			Insert("user").Columns("id", "name").Values(1, "a").OnDuplicateKeyUpdate("name"),
+			"INSERT INTO `user` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)",
+			[]interface{}{1, "a"},
+		},
+		{
+			Insert("tag").Columns("post_id", "tag").Values(1, "a").OnDuplicateKeyKeep("post_id"),
+			"INSERT INTO `tag` (`post_id`, `tag`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `post_id` = `post_id`",
+			[]interface{}{1, "a"},
+		},
+		{
+			Replace("user").Columns("name").Select(Select("name").From("tmp").Where(Eq("a", 1))),
+			"REPLACE INTO `user` (`name`) SELECT `name` FROM `tmp` WHERE `a` = ?",
+			[]interface{}{1},
+		},
+		{
+			Update("user").Set("name", "a").Set("count", Raw("`count` + ?", 1)).Where(Eq("id", 1)).Limit(1),
+			"UPDATE `user` SET `name` = ?, `count` = `count` + ? WHERE `id` = ? LIMIT 1",
+			[]interface{}{"a", 1, 1},
+		},
+		{
+			Update("user").SetMap(map[string]interface{}{"b": 2, "a": 1}).OrderBy("id", false),
+			"UPDATE `user` SET `a` = ?, `b` = ? ORDER BY `id` ASC",
+			[]interface{}{1, 2},
+		},
+		{
+			Delete("user").Where(Lt("id", 10)).OrderBy("id", false).Limit(5),
+			"DELETE FROM `user` WHERE `id` < ? ORDER BY `id` ASC LIMIT 5",
+			[]interface{}{10},
+		},
+	})
+}
+
+func TestBuildError(t *testing.T) {
+	for _, c := range []struct {
+		builder Expr
+		err     error
+	}{
+		{Insert("user"), EMPTY_VALUES},
+		{Insert("").Values(1), EMPTY_TABLE},
+		{Insert("user").Columns("a", "b").Values(1), COLUMNS_MISMATCH},
+		{Update("user"), EMPTY_SET},
+		{Delete(""), EMPTY_TABLE},
+		{Select().From("user").Where(In("id", Update("user"))), EMPTY_SET},
+	} {
+		if _, _, err := c.builder.ToSql(); err != c.err {
+			t.Error("build should return", c.err, "but", err)
+		}
+	}
+}
+
+type connectorForTest struct {
+	sql  string
+	args []interface{}
+}
+
+func (this *connectorForTest) Query(destList interface{}, sql string, params ...interface{}) error {
+	this.sql, this.args = sql, params
+	return nil
+}
+
+func (this *connectorForTest) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	this.sql, this.args = sql, params
+	return nil
+}
+
+func (this *connectorForTest) Insert(sql string, params ...interface{}) (int64, error) {
+	this.sql, this.args = sql, params
+	return 1, nil
+}
+
+func (this *connectorForTest) Execute(sql string, params ...interface{}) (int64, error) {
+	this.sql, this.args = sql, params
+	return 1, nil
+}
+
+func TestRun(t *testing.T) {
+	conn := &connectorForTest{}
+	if err := Select().From("user").Where(Eq("id", 1)).QueryOne(conn, nil); err != nil ||
+		conn.sql != "SELECT * FROM `user` WHERE `id` = ?" || !reflect.DeepEqual(conn.args, []interface{}{1}) {
+		t.Error("wrong query", conn.sql, conn.args, err)
+	}
+	if _, err := Delete("user").Where(Eq("id", 2)).Execute(conn); err != nil ||
+		conn.sql != "DELETE FROM `user` WHERE `id` = ?" || !reflect.DeepEqual(conn.args, []interface{}{2}) {
+		t.Error("wrong execute", conn.sql, conn.args, err)
+	}
+	if _, err := Update("user").Execute(conn); err != EMPTY_SET {
+		t.Error("execute should return build error but", err)
+	}
+}
@@ -0,0 +1,386 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// REDACTED replaces the params of redacted columns in query logs
+const REDACTED = "[REDACTED]"
+
+// QueryLog is the log of a query executed by a db or a transaction
+type QueryLog struct {
+	// Name is the name of db, or the name of transaction which is <db>-<token>
+	Name    string
+	TraceId string
+	// Method is query, queryone, queryrows, insert or execute,
+	// or bulk, batch and loaddata of Bulk, ExecuteBatch and LoadData
+	Method string
+	Sql    string
+	// Params are the bind params, the params of redacted columns are REDACTED
+	Params   []interface{}
+	Start    time.Time
+	Duration time.Duration
+	// Rows is the count of rows returned by query and queryone,
+	// or the count of rows affected by other methods, which is -1 for queryrows
+	Rows int64
+	Err  error
+	// Slow is true if the duration exceeds QueryLogOption.SlowThreshold
+	Slow bool
+	// Plan is the result of EXPLAIN if the query is a slow SELECT and QueryLogOption.Explain is set,
+	// which is nil for QueryRows
+	Plan []map[string]string
+	// ExplainErr is the error of running EXPLAIN
+	ExplainErr error
+}
+
+// String formats the log as key=value pairs
+func (this *QueryLog) String() string {
+	fields := []string{
+		"name=" + this.Name,
+		"trace=" + orDash(this.TraceId),
+		"method=" + this.Method,
+		fmt.Sprintf("duration=%s", this.Duration),
+		fmt.Sprintf("rows=%d", this.Rows),
+		fmt.Sprintf("sql=%q", this.Sql),
+		fmt.Sprintf("params=%v", this.Params),
+	}
+	if this.Slow {
+		fields = append(fields, "slow=true")
+	}
+	if this.Err != nil {
+		fields = append(fields, fmt.Sprintf("err=%q", this.Err.Error()))
+	}
+	if this.Plan != nil {
+		fields = append(fields, fmt.Sprintf("plan=%v", this.Plan))
+	}
+	if this.ExplainErr != nil {
+		fields = append(fields, fmt.Sprintf("explain_err=%q", this.ExplainErr.Error()))
+	}
+	return strings.Join(fields, " ")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// QueryLogOption is the option of query logs of a db
+type QueryLogOption struct {
+	// SlowThreshold is the duration over which a query is slow and logged at Warn, 0 disables it
+	SlowThreshold time.Duration
+	// Explain runs EXPLAIN on slow SELECT queries and attaches the plan to the log,
+	// which adds latency to slow queries. EXPLAIN runs on the transaction in a transaction,
+	// otherwise on any connection of the pool. QueryRows is not explained,
+	// since its rows are not read yet when it is logged.
+	Explain bool
+	// RedactColumns are the columns whose params are replaced by REDACTED in logs, such as password,
+	// the column of a param is parsed from sql, such as `password` = ? and INSERT INTO t (`password`) VALUES (?),
+	// if it is set, the params whose columns can not be parsed, such as MD5(?) and LIMIT ?, are also redacted
+	RedactColumns []string
+	// Handler receives the logs instead of the package logger,
+	// by default errors are logged at Error, slow queries at Warn and others at Debug
+	Handler func(log *QueryLog)
+}
+
+// queryLogger holds the option of a db, which is shared by its transactions
+type queryLogger struct {
+	option atomic.Value
+}
+
+func newQueryLogger() *queryLogger {
+	logger := &queryLogger{}
+	logger.option.Store(&QueryLogOption{})
+	return logger
+}
+
+func (this *queryLogger) get() *QueryLogOption {
+	if this == nil {
+		return &QueryLogOption{}
+	}
+	return this.option.Load().(*QueryLogOption)
+}
+
+// SetQueryLogOption sets the option of query logs of db added by AddDB,
+// or of every database of cluster added by AddCluster, nil resets the option.
+func SetQueryLogOption(name string, option *QueryLogOption) {
+	if option == nil {
+		option = &QueryLogOption{}
+	}
+	switch conn := p.store[name].(type) {
+	case *db:
+		conn.setQueryLogOption(option)
+	case *cluster:
+		conn.primary.setQueryLogOption(option)
+		for _, replica := range conn.replicas {
+			replica.setQueryLogOption(option)
+		}
+	}
+}
+
+func (this *db) setQueryLogOption(option *QueryLogOption) {
+	if this.logger == nil {
+		this.logger = newQueryLogger()
+	}
+	this.logger.option.Store(option)
+}
+
+const traceIdContextKey contextKey = primaryContextKey + 1
+
+// WithTraceId returns a context carrying trace id,
+// the queries of the Connector returned by GetContext with the context are logged with the trace id.
+func WithTraceId(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, traceIdContextKey, traceId)
+}
+
+// withTraceId returns a copy of conn which logs queries with trace id,
+// the copy shares connections, statements and statistics with conn.
+func withTraceId(conn Connector, traceId string) Connector {
+	switch conn := conn.(type) {
+	case *db:
+		return conn.withTraceId(traceId)
+	case *node:
+		return conn.withTraceId(traceId)
+	case *cluster:
+		return conn.withTraceId(traceId)
+	}
+	return conn
+}
+
+func (this *db) withTraceId(traceId string) *db {
+	traced := *this
+	traced.traceId = traceId
+	return &traced
+}
+
+func (this *node) withTraceId(traceId string) *node {
+	return &node{db: this.db.withTraceId(traceId), nodeState: this.nodeState}
+}
+
+func (this *cluster) withTraceId(traceId string) *cluster {
+	traced := &cluster{name: this.name, primary: this.primary.withTraceId(traceId), origin: this.source()}
+	for _, replica := range this.replicas {
+		traced.replicas = append(traced.replicas, replica.withTraceId(traceId))
+	}
+	return traced
+}
+
+func (this *db) newTx(name string, conn *sql.Tx) *tx {
+	return &tx{name: name, conn: conn, db: this, logger: this.logger, traceId: this.traceId}
+}
+
+func (this *db) startLog(method, query string, params []interface{}) *QueryLog {
+	return &QueryLog{Name: this.name, TraceId: this.traceId, Method: method, Sql: query, Params: params, Start: time.Now()}
+}
+
+func (this *db) finishLog(entry *QueryLog, err error) {
+	entry.Err = err
+	logQuery(this.logger, this.conn, entry)
+}
+
+func (this *tx) startLog(method, query string, params []interface{}) *QueryLog {
+	return &QueryLog{Name: this.name, TraceId: this.traceId, Method: method, Sql: query, Params: params, Start: time.Now()}
+}
+
+func (this *tx) finishLog(entry *QueryLog, err error) {
+	entry.Err = err
+	logQuery(this.logger, this.conn, entry)
+}
+
+// sqlQuerier is *sql.DB or *sql.Tx
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// logQuery logs a query executed on querier, which runs EXPLAIN if the query is slow
+func logQuery(logger *queryLogger, querier sqlQuerier, entry *QueryLog) {
+	option := logger.get()
+	entry.Duration = time.Since(entry.Start)
+	entry.Slow = option.SlowThreshold > 0 && entry.Duration >= option.SlowThreshold
+	// the connection of QueryRows is busy with the rows not read yet
+	if entry.Slow && option.Explain && entry.Err == nil && entry.Method != "queryrows" && isSelect(entry.Sql) {
+		entry.Plan, entry.ExplainErr = explain(querier, entry.Sql, entry.Params)
+	}
+	entry.Params = redactParams(entry.Sql, entry.Params, option.RedactColumns)
+	if option.Handler != nil {
+		option.Handler(entry)
+		return
+	}
+	switch {
+	case entry.Err != nil:
+		log.Error(entry.String())
+	case entry.Slow:
+		log.Warn(entry.String())
+	default:
+		log.Debug(entry.String())
+	}
+}
+
+func isSelect(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	return len(query) >= 6 && strings.EqualFold(query[:6], "SELECT")
+}
+
+// explain runs EXPLAIN of query and returns the plan rows
+func explain(querier sqlQuerier, query string, params []interface{}) ([]map[string]string, error) {
+	rows, err := querier.Query("EXPLAIN "+query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	plan := []map[string]string{}
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, column := range columns {
+			if values[i] != nil {
+				row[column] = asString(values[i])
+			}
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
+
+// countList returns the length of *[]T
+func countList(destList interface{}) int64 {
+	v := reflect.ValueOf(destList)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		return int64(v.Elem().Len())
+	}
+	return 0
+}
+
+var (
+	insertColumnsRegexp = regexp.MustCompile("(?is)^\\s*(?:INSERT|REPLACE)\\b.*?\\(([^)]*)\\)\\s*VALUES\\s*")
+	// the column compared with a placeholder, such as `a` = ?, a IN (?, ? and a BETWEEN ? AND ?
+	paramColumnRegexps = []*regexp.Regexp{
+		regexp.MustCompile("(?i)`?(\\w+)`?\\s*(?:=|<>|!=|<=>|<=|>=|<|>|\\bNOT\\s+LIKE|\\bLIKE)\\s*$"),
+		regexp.MustCompile("(?i)`?(\\w+)`?\\s+(?:NOT\\s+)?IN\\s*\\(\\s*(?:\\?\\s*,\\s*)*$"),
+		regexp.MustCompile("(?i)`?(\\w+)`?\\s+(?:NOT\\s+)?BETWEEN\\s+(?:\\?\\s+AND\\s+)?$"),
+	}
+)
+
+// redactParams replaces the params of columns with REDACTED,
+// the params whose columns are unknown are also redacted, so that no secret is logged by mistake
+func redactParams(query string, params []interface{}, columns []string) []interface{} {
+	if len(columns) == 0 || len(params) == 0 {
+		return params
+	}
+	ret := make([]interface{}, len(params))
+	copy(ret, params)
+	paramColumns := paramColumns(query)
+	for i := range ret {
+		if i >= len(paramColumns) || paramColumns[i] == "" {
+			ret[i] = REDACTED
+			continue
+		}
+		for _, redact := range columns {
+			if strings.EqualFold(paramColumns[i], redact) {
+				ret[i] = REDACTED
+			}
+		}
+	}
+	return ret
+}
+
+// paramColumns returns the column of every placeholder in query, which is empty if it is unknown.
+// The placeholders of INSERT VALUES are mapped to the columns by position,
+// a placeholder in an expression, such as MD5(?), is unknown.
+func paramColumns(query string) []string {
+	columns := []string{}
+	names := []string{}
+	valuesStart := len(query)
+	if match := insertColumnsRegexp.FindStringSubmatchIndex(query); match != nil {
+		for _, name := range strings.Split(query[match[2]:match[3]], ",") {
+			names = append(names, strings.Trim(strings.TrimSpace(name), "`"))
+		}
+		valuesStart = match[1]
+	}
+	inValues := valuesStart < len(query)
+	// depth, position and the placeholders of current position in VALUES tuples
+	depth, position, positionStart := 0, 0, 0
+	positionParams := []int{}
+	finishPosition := func(end int) {
+		if len(positionParams) == 1 && position < len(names) && strings.TrimSpace(query[positionStart:end]) == "?" {
+			columns[positionParams[0]] = names[position]
+		}
+		positionParams = positionParams[:0]
+	}
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' || c == '`' {
+			quote = c
+			continue
+		}
+		if inValues && i >= valuesStart {
+			switch {
+			case c == '(':
+				depth++
+				if depth == 1 {
+					position, positionStart = 0, i+1
+				}
+				continue
+			case c == ',' && depth == 1:
+				finishPosition(i)
+				position, positionStart = position+1, i+1
+				continue
+			case c == ')' && depth > 0:
+				if depth == 1 {
+					finishPosition(i)
+				}
+				depth--
+				continue
+			case c == '?' && depth > 0:
+				positionParams = append(positionParams, len(columns))
+				columns = append(columns, "")
+				continue
+			case depth == 0 && !strings.ContainsRune(" \t\r\n,", rune(c)):
+				// the tail after VALUES, such as ON DUPLICATE KEY UPDATE
+				inValues = false
+			}
+		}
+		if c == '?' {
+			columns = append(columns, paramColumn(query[:i]))
+		}
+	}
+	return columns
+}
+
+// paramColumn returns the column compared with the placeholder after prefix
+func paramColumn(prefix string) string {
+	for _, re := range paramColumnRegexps {
+		if match := re.FindStringSubmatch(prefix); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
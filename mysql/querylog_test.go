@@ -0,0 +1,155 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLog(t *testing.T) {
+	d := &countDriver{columns: []string{"id", "type"}, rows: [][]driver.Value{{int64(1), "ALL"}}}
+	sql.Register("kelp_querylog", d)
+	conn, _ := sql.Open("kelp_querylog", "")
+	conn.SetMaxOpenConns(2)
+	testDB := &db{name: "test", conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}
+	Add("querylog", testDB)
+	logs := []*QueryLog{}
+	SetQueryLogOption("querylog", &QueryLogOption{
+		RedactColumns: []string{"password"},
+		Handler:       func(log *QueryLog) { logs = append(logs, log) },
+	})
+
+	list := []*struct {
+		Id   int64  `json:"id"`
+		Type string `json:"type"`
+	}{}
+	ctx := WithTraceId(context.Background(), "trace-1")
+	traced := GetContext(ctx, "querylog")
+	traced.Query(&list, "SELECT * FROM user WHERE name = ? AND password = ?", "a", "secret")
+	traced.Execute("UPDATE user SET `password`=? WHERE id IN (?, ?)", "secret", 1, 2)
+	WithTx(traced, func(tx Connector) error {
+		_, err := tx.Insert("INSERT INTO user (name, password) VALUES (?, ?), (?, ?)", "a", "s1", "b", "s2")
+		return err
+	})
+	rows, _ := testDB.QueryRows("SELECT 1")
+	rows.Close()
+	if len(logs) != 4 {
+		t.Fatal("wrong logs", logs)
+	}
+	if logs[0].TraceId != "trace-1" || logs[0].Name != "test" || logs[0].Method != "query" || logs[0].Rows != 1 || logs[0].Slow {
+		t.Error("wrong query log", logs[0])
+	}
+	if logs[0].Params[0] != "a" || logs[0].Params[1] != REDACTED {
+		t.Error("password should be redacted", logs[0].Params)
+	}
+	if logs[1].Params[0] != REDACTED || logs[1].Params[1] != 1 {
+		t.Error("password should be redacted", logs[1].Params)
+	}
+	if logs[2].TraceId != "trace-1" || !strings.HasPrefix(logs[2].Name, "test-") || logs[2].Method != "insert" ||
+		logs[2].Params[0] != "a" || logs[2].Params[1] != REDACTED || logs[2].Params[2] != "b" || logs[2].Params[3] != REDACTED {
+		t.Error("wrong transaction log", logs[2])
+	}
+	if logs[3].TraceId != "" || logs[3].Rows != -1 {
+		t.Error("wrong queryrows log", logs[3])
+	}
+	if testDB.traceId != "" {
+		t.Error("trace id should not change db in pool")
+	}
+
+	// slow query with explain
+	logs = logs[:0]
+	SetQueryLogOption("querylog", &QueryLogOption{
+		SlowThreshold: time.Nanosecond,
+		Explain:       true,
+		Handler:       func(log *QueryLog) { logs = append(logs, log) },
+	})
+	testDB.QueryOne(list[0], "SELECT * FROM user WHERE id = ?", 1)
+	testDB.Execute("DELETE FROM user WHERE id = ?", 1)
+	txConn, _ := testDB.Begin()
+	if rows, err := txConn.(*tx).QueryRows("SELECT * FROM user"); err == nil {
+		rows.Close()
+	}
+	txConn.Commit()
+	if len(logs) != 3 || !logs[0].Slow || len(logs[0].Plan) != 1 || logs[0].Plan[0]["type"] != "ALL" {
+		t.Fatal("slow select should be explained", logs)
+	}
+	explained := []string{}
+	for _, query := range d.queries {
+		if strings.HasPrefix(query, "EXPLAIN ") {
+			explained = append(explained, query)
+		}
+	}
+	if len(explained) != 1 || explained[0] != "EXPLAIN SELECT * FROM user WHERE id = ?" {
+		t.Error("wrong explain", d.queries)
+	}
+	if !logs[1].Slow || logs[1].Plan != nil {
+		t.Error("only select should be explained", logs[1])
+	}
+	if !logs[2].Slow || logs[2].Plan != nil {
+		t.Error("queryrows should not be explained", logs[2])
+	}
+}
+
+func TestQueryLogString(t *testing.T) {
+	entry := &QueryLog{
+		Name:     "test",
+		Method:   "execute",
+		Sql:      "UPDATE user SET name = ?",
+		Params:   []interface{}{"a"},
+		Duration: time.Second,
+		Rows:     2,
+		Slow:     true,
+		Err:      errors.New("failed"),
+	}
+	expect := `name=test trace=- method=execute duration=1s rows=2 sql="UPDATE user SET name = ?" params=[a] slow=true err="failed"`
+	if entry.String() != expect {
+		t.Error("wrong string", entry.String())
+	}
+}
+
+func TestParamColumns(t *testing.T) {
+	for query, expect := range map[string]string{
+		"SELECT * FROM user WHERE `user`.`password` = ? AND name LIKE ?":                       "password,name",
+		"SELECT * FROM user WHERE id NOT IN (?, ?) AND age BETWEEN ? AND ?":                    "id,id,age,age",
+		"SELECT * FROM user WHERE name = '?' AND note = 'it\\'s ?' AND token<>? LIMIT ?":       "token,",
+		"INSERT INTO `user` (`name`, `password`) VALUES (?, ?), (?, ?)":                        "name,password,name,password",
+		"UPDATE user SET password = ?, updated_at = NOW() WHERE id >= ?":                       "password,id",
+		"INSERT INTO user (name, created_at, password) VALUES (?, NOW(), ?)":                   "name,password",
+		"INSERT INTO user (name, password) VALUES (?, ?) ON DUPLICATE KEY UPDATE password = ?": "name,password,password",
+		"UPDATE user SET password = MD5(?) WHERE id = ?":                                       ",id",
+		"INSERT INTO user (name, password) VALUES (?, CONCAT(?, ?))":                           "name,,",
+	} {
+		if columns := paramColumns(query); strings.Join(columns, ",") != expect {
+			t.Error("wrong columns of", query, columns)
+		}
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	redact := []string{"password"}
+	for query, params := range map[string][]interface{}{
+		"INSERT INTO user (name, created_at, password) VALUES (?, NOW(), ?)":                   {"bob", REDACTED},
+		"INSERT INTO user (name, password) VALUES (?, ?) ON DUPLICATE KEY UPDATE password = ?": {"bob", REDACTED, REDACTED},
+		"UPDATE user SET password = MD5(?) WHERE id = ?":                                       {REDACTED, 1},
+		"SELECT * FROM user WHERE name = ? LIMIT ?":                                            {"bob", REDACTED},
+	} {
+		input := make([]interface{}, len(params))
+		for i, param := range params {
+			input[i] = param
+			if param == REDACTED {
+				input[i] = "secret"
+			}
+		}
+		if ret := redactParams(query, input, redact); fmt.Sprint(ret) != fmt.Sprint(params) {
+			t.Error("wrong params of", query, ret)
+		}
+	}
+	if ret := redactParams("SELECT ?", []interface{}{"a"}, nil); ret[0] != "a" {
+		t.Error("should not redact without columns", ret)
+	}
+}
@@ -0,0 +1,362 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mapleque/kelp/mysql/query"
+)
+
+var (
+	NO_PRIMARY_KEY      = errors.New("kelp.mysql: table has no primary key")
+	PRIMARY_KEY_INVALID = errors.New("kelp.mysql: count of key values does not match primary key")
+	UNIQUE_KEY_INVALID  = errors.New("kelp.mysql: no such unique index or count of values does not match it")
+)
+
+// Repo is a typed repository of model T built from Table.
+//
+// The primary key comes from Table, a column declared AUTO_INCREMENT
+// is generated by database when its value is zero.
+// If Table.SetSoftDelete is set, rows are marked deleted instead of deleted,
+// and deleted rows are not found.
+type Repo[T any] struct {
+	conn  Connector
+	table *Table
+}
+
+// NewRepo creates a repository of T on conn.
+// If table is nil, it is built from T, the table can also be one added into a Schema.
+func NewRepo[T any](conn Connector, table *Table) *Repo[T] {
+	if table == nil {
+		table = NewTable(new(T))
+	}
+	if table.modelType != reflect.TypeOf((*T)(nil)).Elem() {
+		panic(fmt.Sprintf("table model should be %s but %s", reflect.TypeOf((*T)(nil)).Elem(), table.modelType))
+	}
+	return &Repo[T]{conn: conn, table: table}
+}
+
+// Table returns the table of repository.
+func (this *Repo[T]) Table() *Table {
+	return this.table
+}
+
+// WithConn returns a repository on another connector, such as a transaction.
+func (this *Repo[T]) WithConn(conn Connector) *Repo[T] {
+	return &Repo[T]{conn: conn, table: this.table}
+}
+
+// Select returns a select builder of all columns,
+// which excludes soft deleted rows, used for custom queries:
+//
+//	list := []*User{}
+//	err := repo.Select().Where(query.Gt("age", 18)).OrderBy("name", false).Query(conn, &list)
+func (this *Repo[T]) Select() *query.SelectBuilder {
+	columns := []interface{}{}
+	for _, field := range this.table.fields {
+		columns = append(columns, field.name)
+	}
+	builder := query.Select(columns...).From(this.table.name)
+	if this.table.softDelete != "" {
+		builder.Where(query.IsNull(this.table.softDelete))
+	}
+	return builder
+}
+
+// Find finds a row by primary key, the key values are in the order of primary key columns.
+// It returns NO_DATA_TO_BIND if the row is not found.
+func (this *Repo[T]) Find(keys ...interface{}) (*T, error) {
+	cond, err := this.keyCond(keys)
+	if err != nil {
+		return nil, err
+	}
+	return this.FindOneBy(cond)
+}
+
+// FindByUnique finds a row by unique index of name, the values are in the order of index columns.
+// It returns NO_DATA_TO_BIND if the row is not found.
+func (this *Repo[T]) FindByUnique(name string, values ...interface{}) (*T, error) {
+	index := this.table.Index(name)
+	if index == nil || !index.Unique || len(values) != len(index.Columns) {
+		return nil, UNIQUE_KEY_INVALID
+	}
+	conds := []query.Expr{}
+	for i, column := range index.Columns {
+		conds = append(conds, query.Eq(column, values[i]))
+	}
+	return this.FindOneBy(conds...)
+}
+
+// FindBy finds rows matching all conds.
+func (this *Repo[T]) FindBy(conds ...query.Expr) ([]*T, error) {
+	list := []*T{}
+	err := this.Select().Where(conds...).Query(this.conn, &list)
+	return list, err
+}
+
+// FindOneBy finds the first row matching all conds.
+// It returns NO_DATA_TO_BIND if no row is found.
+func (this *Repo[T]) FindOneBy(conds ...query.Expr) (*T, error) {
+	model := new(T)
+	if err := this.Select().Where(conds...).Limit(1).QueryOne(this.conn, model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Count counts rows matching all conds.
+func (this *Repo[T]) Count(conds ...query.Expr) (int64, error) {
+	builder := query.Select(query.Raw("COUNT(*) AS total")).From(this.table.name).Where(conds...)
+	if this.table.softDelete != "" {
+		builder.Where(query.IsNull(this.table.softDelete))
+	}
+	t := &struct {
+		Total int64 `json:"total"`
+	}{}
+	err := builder.QueryOne(this.conn, t)
+	return t.Total, err
+}
+
+// PageAfter finds at most size rows after last in the order of primary key,
+// which is keyset pagination. If last is nil, it finds the first page.
+func (this *Repo[T]) PageAfter(last *T, size int64, conds ...query.Expr) ([]*T, error) {
+	if len(this.table.primaryKey) == 0 {
+		return nil, NO_PRIMARY_KEY
+	}
+	builder := this.Select().Where(conds...).Limit(size)
+	if last != nil {
+		// (k1, k2) > (v1, v2) is k1 > v1 OR (k1 = v1 AND k2 > v2)
+		keys := this.keyValues(last)
+		after := []query.Expr{}
+		for i, column := range this.table.primaryKey {
+			and := []query.Expr{}
+			for j := 0; j < i; j++ {
+				and = append(and, query.Eq(this.table.primaryKey[j], keys[j]))
+			}
+			after = append(after, query.And(append(and, query.Gt(column, keys[i]))...))
+		}
+		builder.Where(query.Or(after...))
+	}
+	for _, column := range this.table.primaryKey {
+		builder.OrderBy(column, false)
+	}
+	list := []*T{}
+	err := builder.Query(this.conn, &list)
+	return list, err
+}
+
+// Insert inserts models in one statement.
+// If only one model is inserted, its AUTO_INCREMENT field is set to the last insert id,
+// for batch insert, the generated ids are not set.
+func (this *Repo[T]) Insert(models ...*T) error {
+	if len(models) == 0 {
+		return nil
+	}
+	builder, autoIncrement := this.insertBuilder(models)
+	lastId, err := builder.Insert(this.conn)
+	if err != nil {
+		return err
+	}
+	if len(models) == 1 && autoIncrement != nil {
+		field := reflect.ValueOf(models[0]).Elem().Field(autoIncrement.propIndex)
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(lastId)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.SetUint(uint64(lastId))
+		}
+	}
+	return nil
+}
+
+// Upsert inserts models, and updates all columns except primary key and unique index columns
+// when a primary or unique key conflicts, the existing row is kept if there is no other column.
+func (this *Repo[T]) Upsert(models ...*T) error {
+	if len(models) == 0 {
+		return nil
+	}
+	builder, _ := this.insertBuilder(models)
+	updates := []string{}
+	for _, field := range this.table.fields {
+		if !this.isKey(field.name) && !this.isUnique(field.name) && field.name != this.table.softDelete {
+			updates = append(updates, field.name)
+		}
+	}
+	if len(updates) == 0 {
+		// all columns are keys, such as a join table, the existing row is kept
+		keep := this.table.fields[0].name
+		if len(this.table.primaryKey) > 0 {
+			keep = this.table.primaryKey[0]
+		}
+		builder.OnDuplicateKeyKeep(keep)
+	}
+	_, err := builder.OnDuplicateKeyUpdate(updates...).Insert(this.conn)
+	return err
+}
+
+// insertBuilder returns the insert builder of models, and the AUTO_INCREMENT field
+// which is generated by database, which is nil if any model has a value on it
+func (this *Repo[T]) insertBuilder(models []*T) (*query.InsertBuilder, *TableField) {
+	var autoIncrement *TableField
+	fields := []*TableField{}
+	for _, field := range this.table.fields {
+		// soft delete column is NULL when inserting
+		if field.name == this.table.softDelete {
+			continue
+		}
+		if field.autoIncrement && this.allZero(models, field) {
+			autoIncrement = field
+			continue
+		}
+		fields = append(fields, field)
+	}
+	columns := []string{}
+	for _, field := range fields {
+		columns = append(columns, field.name)
+	}
+	builder := query.Insert(this.table.name).Columns(columns...)
+	for _, model := range models {
+		v := reflect.ValueOf(model).Elem()
+		row := []interface{}{}
+		for _, field := range fields {
+			row = append(row, columnValue(v.Field(field.propIndex)))
+		}
+		builder.Values(row...)
+	}
+	return builder, autoIncrement
+}
+
+func (this *Repo[T]) allZero(models []*T, field *TableField) bool {
+	for _, model := range models {
+		if !reflect.ValueOf(model).Elem().Field(field.propIndex).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Update updates columns of model by its primary key, and returns affected rows.
+// If no column is given, all columns except primary key are updated.
+func (this *Repo[T]) Update(model *T, columns ...string) (int64, error) {
+	v := reflect.ValueOf(model).Elem()
+	values := map[string]interface{}{}
+	for _, field := range this.table.fields {
+		if this.isKey(field.name) || field.name == this.table.softDelete {
+			continue
+		}
+		if len(columns) == 0 || contains(columns, field.name) {
+			values[field.name] = columnValue(v.Field(field.propIndex))
+		}
+	}
+	return this.update(this.keyValues(model), values)
+}
+
+// UpdateChanged updates the columns of model which are different from origin,
+// origin is the model found before changing. It does nothing if no column is changed.
+func (this *Repo[T]) UpdateChanged(origin, model *T) (int64, error) {
+	originValue := reflect.ValueOf(origin).Elem()
+	v := reflect.ValueOf(model).Elem()
+	values := map[string]interface{}{}
+	for _, field := range this.table.fields {
+		if this.isKey(field.name) || field.name == this.table.softDelete {
+			continue
+		}
+		value := v.Field(field.propIndex)
+		if !reflect.DeepEqual(originValue.Field(field.propIndex).Interface(), value.Interface()) {
+			values[field.name] = columnValue(value)
+		}
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return this.update(this.keyValues(origin), values)
+}
+
+func (this *Repo[T]) update(keys []interface{}, values map[string]interface{}) (int64, error) {
+	cond, err := this.keyCond(keys)
+	if err != nil {
+		return 0, err
+	}
+	builder := query.Update(this.table.name).SetMap(values).Where(cond)
+	if this.table.softDelete != "" {
+		builder.Where(query.IsNull(this.table.softDelete))
+	}
+	return builder.Execute(this.conn)
+}
+
+// Delete deletes a row by primary key, and returns affected rows.
+// If the table has a soft delete column, the row is marked deleted.
+func (this *Repo[T]) Delete(keys ...interface{}) (int64, error) {
+	if this.table.softDelete == "" {
+		return this.ForceDelete(keys...)
+	}
+	cond, err := this.keyCond(keys)
+	if err != nil {
+		return 0, err
+	}
+	return query.Update(this.table.name).
+		Set(this.table.softDelete, time.Now()).
+		Where(cond, query.IsNull(this.table.softDelete)).
+		Execute(this.conn)
+}
+
+// ForceDelete deletes a row by primary key even if the table has a soft delete column.
+func (this *Repo[T]) ForceDelete(keys ...interface{}) (int64, error) {
+	cond, err := this.keyCond(keys)
+	if err != nil {
+		return 0, err
+	}
+	return query.Delete(this.table.name).Where(cond).Execute(this.conn)
+}
+
+func (this *Repo[T]) keyCond(keys []interface{}) (query.Expr, error) {
+	if len(this.table.primaryKey) == 0 {
+		return nil, NO_PRIMARY_KEY
+	}
+	if len(keys) != len(this.table.primaryKey) {
+		return nil, PRIMARY_KEY_INVALID
+	}
+	conds := []query.Expr{}
+	for i, column := range this.table.primaryKey {
+		conds = append(conds, query.Eq(column, keys[i]))
+	}
+	return query.And(conds...), nil
+}
+
+func (this *Repo[T]) keyValues(model *T) []interface{} {
+	v := reflect.ValueOf(model).Elem()
+	ret := []interface{}{}
+	for _, column := range this.table.primaryKey {
+		for _, field := range this.table.fields {
+			if field.name == column {
+				ret = append(ret, v.Field(field.propIndex).Interface())
+			}
+		}
+	}
+	return ret
+}
+
+func (this *Repo[T]) isKey(column string) bool {
+	return contains(this.table.primaryKey, column)
+}
+
+// isUnique returns whether column is in a unique index
+func (this *Repo[T]) isUnique(column string) bool {
+	for _, index := range this.table.indexes {
+		if index.Unique && contains(index.Columns, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
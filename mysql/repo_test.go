@@ -0,0 +1,174 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mapleque/kelp/mysql/query"
+)
+
+type RepoUser struct {
+	Id        int64      `json:"id" column_schema:"BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT"`
+	Name      string     `json:"name" column_schema:"VARCHAR(32) NOT NULL"`
+	Age       int        `json:"age" column_schema:"INT NOT NULL"`
+	DeletedAt *time.Time `json:"deleted_at" column_schema:"DATETIME NULL"`
+}
+
+type RepoMember struct {
+	GroupId int64  `json:"group_id" column_schema:"BIGINT NOT NULL"`
+	UserId  int64  `json:"user_id" column_schema:"BIGINT NOT NULL"`
+	Role    string `json:"role" column_schema:"VARCHAR(16) NOT NULL"`
+}
+
+type statement struct {
+	sql  string
+	args []interface{}
+}
+
+// recordConnector records the executed statements
+type recordConnector struct {
+	TestDB
+	statements []statement
+}
+
+func (this *recordConnector) record(sql string, params []interface{}) {
+	this.statements = append(this.statements, statement{sql, params})
+}
+
+func (this *recordConnector) Query(destList interface{}, sql string, params ...interface{}) error {
+	this.record(sql, params)
+	return nil
+}
+
+func (this *recordConnector) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
+	this.record(sql, params)
+	return nil
+}
+
+func (this *recordConnector) Insert(sql string, params ...interface{}) (int64, error) {
+	this.record(sql, params)
+	return 7, nil
+}
+
+func (this *recordConnector) Execute(sql string, params ...interface{}) (int64, error) {
+	this.record(sql, params)
+	return 1, nil
+}
+
+func (this *recordConnector) assert(t *testing.T, sql string, args ...interface{}) {
+	t.Helper()
+	if len(this.statements) == 0 {
+		t.Error("no statement executed, expect", sql)
+		return
+	}
+	last := this.statements[len(this.statements)-1]
+	if last.sql != sql || !reflect.DeepEqual(last.args, args) {
+		t.Error("statement should be", sql, args, "but", last.sql, last.args)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	conn := &recordConnector{}
+	repo := NewRepo[RepoUser](conn, nil)
+	repo.Table().SetSoftDelete("deleted_at")
+	columns := "SELECT `id`, `name`, `age`, `deleted_at` FROM `repo_user` "
+
+	repo.Find(int64(1))
+	conn.assert(t, columns+"WHERE `deleted_at` IS NULL AND `id` = ? LIMIT 1", int64(1))
+
+	repo.FindBy(query.Gt("age", 18), query.Like("name", "k%"))
+	conn.assert(t, columns+"WHERE `deleted_at` IS NULL AND `age` > ? AND `name` LIKE ?", 18, "k%")
+
+	repo.Count(query.Gt("age", 18))
+	conn.assert(t, "SELECT COUNT(*) AS total FROM `repo_user` WHERE `age` > ? AND `deleted_at` IS NULL", 18)
+
+	user := &RepoUser{Name: "kelp", Age: 1}
+	if err := repo.Insert(user); err != nil || user.Id != 7 {
+		t.Error("insert should set id but", user.Id, err)
+	}
+	conn.assert(t, "INSERT INTO `repo_user` (`name`, `age`) VALUES (?, ?)", "kelp", 1)
+
+	repo.Insert(&RepoUser{Name: "a"}, &RepoUser{Id: 9, Name: "b"})
+	conn.assert(t, "INSERT INTO `repo_user` (`id`, `name`, `age`) VALUES (?, ?, ?), (?, ?, ?)", int64(0), "a", 0, int64(9), "b", 0)
+
+	repo.Upsert(&RepoUser{Id: 9, Name: "b"})
+	conn.assert(t, "INSERT INTO `repo_user` (`id`, `name`, `age`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `age` = VALUES(`age`)", int64(9), "b", 0)
+
+	repo.Update(&RepoUser{Id: 9, Name: "b", Age: 2}, "age")
+	conn.assert(t, "UPDATE `repo_user` SET `age` = ? WHERE `id` = ? AND `deleted_at` IS NULL", 2, int64(9))
+
+	origin := &RepoUser{Id: 9, Name: "b", Age: 2}
+	changed := *origin
+	changed.Name = "c"
+	repo.UpdateChanged(origin, &changed)
+	conn.assert(t, "UPDATE `repo_user` SET `name` = ? WHERE `id` = ? AND `deleted_at` IS NULL", "c", int64(9))
+	count := len(conn.statements)
+	if n, err := repo.UpdateChanged(origin, origin); n != 0 || err != nil || len(conn.statements) != count {
+		t.Error("update without change should do nothing")
+	}
+
+	repo.Delete(int64(9))
+	last := conn.statements[len(conn.statements)-1]
+	if last.sql != "UPDATE `repo_user` SET `deleted_at` = ? WHERE `id` = ? AND `deleted_at` IS NULL" || len(last.args) != 2 {
+		t.Error("soft delete should update deleted_at but", last.sql, last.args)
+	}
+	repo.ForceDelete(int64(9))
+	conn.assert(t, "DELETE FROM `repo_user` WHERE `id` = ?", int64(9))
+
+	repo.PageAfter(&RepoUser{Id: 10}, 20)
+	conn.assert(t, columns+"WHERE `deleted_at` IS NULL AND `id` > ? ORDER BY `id` ASC LIMIT 20", int64(10))
+
+	if _, err := repo.Find(1, 2); err != PRIMARY_KEY_INVALID {
+		t.Error("find with wrong keys should fail but", err)
+	}
+}
+
+func TestRepoCompositeKey(t *testing.T) {
+	conn := &recordConnector{}
+	table := NewTable(RepoMember{}).SetPrimaryKey("group_id", "user_id")
+	repo := NewRepo[RepoMember](conn, table)
+	columns := "SELECT `group_id`, `user_id`, `role` FROM `repo_member` "
+
+	repo.Find(int64(1), int64(2))
+	conn.assert(t, columns+"WHERE `group_id` = ? AND `user_id` = ? LIMIT 1", int64(1), int64(2))
+
+	repo.Update(&RepoMember{1, 2, "admin"})
+	conn.assert(t, "UPDATE `repo_member` SET `role` = ? WHERE `group_id` = ? AND `user_id` = ?", "admin", int64(1), int64(2))
+
+	repo.Delete(int64(1), int64(2))
+	conn.assert(t, "DELETE FROM `repo_member` WHERE `group_id` = ? AND `user_id` = ?", int64(1), int64(2))
+
+	repo.PageAfter(&RepoMember{GroupId: 1, UserId: 2}, 10, query.Eq("role", "admin"))
+	conn.assert(t, columns+"WHERE `role` = ? AND (`group_id` > ? OR (`group_id` = ? AND `user_id` > ?)) ORDER BY `group_id` ASC, `user_id` ASC LIMIT 10",
+		"admin", int64(1), int64(1), int64(2))
+
+	if sql := table.getCreateTableSql(); !strings.Contains(sql, "\tPRIMARY KEY (`group_id`, `user_id`)") {
+		t.Error("create table sql should have primary key", sql)
+	}
+}
+
+type RepoTag struct {
+	PostId int64  `json:"post_id" column_schema:"BIGINT NOT NULL" primary_key:""`
+	Tag    string `json:"tag" column_schema:"VARCHAR(32) NOT NULL" primary_key:""`
+}
+
+func TestRepoUpsertKeysOnly(t *testing.T) {
+	conn := &recordConnector{}
+	repo := NewRepo[RepoTag](conn, nil)
+	if err := repo.Upsert(&RepoTag{1, "go"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.assert(t, "INSERT INTO `repo_tag` (`post_id`, `tag`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `post_id` = `post_id`", int64(1), "go")
+}
+
+func TestCRUDOption(t *testing.T) {
+	crud := CRUD(RepoMember{}, "R", &recordConnector{})
+	if err := crud.Create(&RepoMember{}); err == nil {
+		t.Error("create should not be supported")
+	}
+	if _, _, err := crud.Retrieve(10, 0); err != nil {
+		t.Error("retrieve should be supported but", err)
+	}
+}
@@ -0,0 +1,208 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var (
+	// STOP_ITERATION is returned by the callback of Each to stop iterating without error
+	STOP_ITERATION = errors.New("kelp.mysql: stop iteration")
+)
+
+// RowsQuerier is implemented by connectors which can stream rows, such as db and tx
+type RowsQuerier interface {
+	QueryRows(sql string, params ...interface{}) (*Rows, error)
+}
+
+// Rows is a cursor of query result, which scans one row at a time,
+// used for large result sets which can not be loaded into memory.
+// Rows should be closed after using, it is closed automatically when Next returns false.
+type Rows struct {
+	rows     *sql.Rows
+	release  func()
+	closed   bool
+	columns  []string
+	scanners map[reflect.Type]*rowScanner
+	raw      *rowScanner
+}
+
+func newRows(rows *sql.Rows, release func()) (*Rows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		release()
+		return nil, err
+	}
+	return &Rows{
+		rows:     rows,
+		release:  release,
+		columns:  columns,
+		scanners: map[reflect.Type]*rowScanner{},
+	}, nil
+}
+
+// QueryRows queries rows on conn for iterating,
+// it returns METHOD_NOT_ALLOW if conn can not stream rows.
+func QueryRows(conn Connector, sql string, params ...interface{}) (*Rows, error) {
+	if querier, ok := conn.(RowsQuerier); ok {
+		return querier.QueryRows(sql, params...)
+	}
+	return nil, METHOD_NOT_ALLOW
+}
+
+// Columns returns the column names.
+func (this *Rows) Columns() []string {
+	return this.columns
+}
+
+// Next prepares the next row for Scan, it returns false and closes rows
+// if there is no more row or an error occurs, which is returned by Err.
+func (this *Rows) Next() bool {
+	if this.closed {
+		return false
+	}
+	if this.rows.Next() {
+		return true
+	}
+	this.Close()
+	return false
+}
+
+// Scan scans current row into dest, which should be a *struct.
+func (this *Rows) Scan(dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("kelp.db.mysql: target should be a *struct but %T", dest)
+	}
+	eleType := destValue.Elem().Type()
+	scanner, exist := this.scanners[eleType]
+	if !exist {
+		scanner = newRowScanner(eleType, this.columns)
+		this.scanners[eleType] = scanner
+	}
+	return scanner.scan(this.rows, destValue.Elem())
+}
+
+// Values returns the raw values of current row, which are nil, int64, float64,
+// bool, []byte, string or time.Time. The values are only valid before next Scan.
+func (this *Rows) Values() ([]interface{}, error) {
+	if this.raw == nil {
+		this.raw = newRowScanner(reflect.TypeOf(struct{}{}), this.columns)
+	}
+	if err := this.raw.scan(this.rows, reflect.Value{}); err != nil {
+		return nil, err
+	}
+	return this.raw.values, nil
+}
+
+// Err returns the error occurred during iteration.
+func (this *Rows) Err() error {
+	return this.rows.Err()
+}
+
+// Close closes rows, it can be called many times.
+func (this *Rows) Close() error {
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	defer this.release()
+	return this.rows.Close()
+}
+
+// Each queries rows and calls fn with every row one by one.
+// If fn returns STOP_ITERATION, it stops and returns nil,
+// if fn returns other errors, it stops and returns the error.
+//
+//	err := mysql.Each(conn, func(user *User) error {
+//		return process(user)
+//	}, "SELECT * FROM user WHERE status = ?", 1)
+func Each[T any](conn Connector, fn func(*T) error, sql string, params ...interface{}) error {
+	rows, err := QueryRows(conn, sql, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		model := new(T)
+		if err := rows.Scan(model); err != nil {
+			return err
+		}
+		if err := fn(model); err != nil {
+			if err == STOP_ITERATION {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WriteJsonArray scans every row into T and writes them into w as a JSON array,
+// and returns the count of rows. Rows is closed after writing.
+func WriteJsonArray[T any](w io.Writer, rows *Rows) (int, error) {
+	defer rows.Close()
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+	count := 0
+	for rows.Next() {
+		model := new(T)
+		if err := rows.Scan(model); err != nil {
+			return count, err
+		}
+		data, err := json.Marshal(model)
+		if err != nil {
+			return count, err
+		}
+		if count > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	_, err := io.WriteString(w, "]")
+	return count, err
+}
+
+// WriteCsv writes every row into w as a csv record, the first record is the columns if header is true,
+// NULL is written as an empty string. It returns the count of rows, rows is closed after writing.
+func WriteCsv(w *csv.Writer, rows *Rows, header bool) (int, error) {
+	defer rows.Close()
+	if header {
+		if err := w.Write(rows.Columns()); err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	record := make([]string, len(rows.Columns()))
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return count, err
+		}
+		for i, value := range values {
+			record[i] = asString(value)
+		}
+		if err := w.Write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	w.Flush()
+	return count, w.Error()
+}
@@ -0,0 +1,76 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"errors"
+	"testing"
+)
+
+type RowsUser struct {
+	Id   int64   `json:"id"`
+	Name *string `json:"name"`
+}
+
+func newRowsDB() (*db, *countDriver) {
+	d := &countDriver{
+		columns: []string{"id", "name"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("a")},
+			{int64(2), nil},
+			{int64(3), []byte("c,d")},
+		},
+	}
+	sql.Register("kelp_rows", d)
+	conn, _ := sql.Open("kelp_rows", "")
+	return &db{name: "test", conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}, d
+}
+
+func TestRows(t *testing.T) {
+	testDB, d := newRowsDB()
+
+	ids := []int64{}
+	err := Each(testDB, func(user *RowsUser) error {
+		ids = append(ids, user.Id)
+		if user.Id == 2 {
+			return STOP_ITERATION
+		}
+		return nil
+	}, "SELECT")
+	if err != nil || len(ids) != 2 || d.rowsClosed != 1 {
+		t.Error("each should stop early and close rows", ids, err, d.rowsClosed)
+	}
+	fail := errors.New("fail")
+	if err := Each(testDB, func(user *RowsUser) error { return fail }, "SELECT"); err != fail || d.rowsClosed != 2 {
+		t.Error("each should return error of callback", err, d.rowsClosed)
+	}
+	if err := Each(&recordConnector{}, func(user *RowsUser) error { return nil }, "SELECT"); err != METHOD_NOT_ALLOW {
+		t.Error("connector without QueryRows should not be supported", err)
+	}
+
+	rows, err := QueryRows(testDB, "SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if count, err := WriteJsonArray[RowsUser](buf, rows); err != nil || count != 3 {
+		t.Error("write json failed", count, err)
+	}
+	if buf.String() != `[{"id":1,"name":"a"},{"id":2,"name":null},{"id":3,"name":"c,d"}]` {
+		t.Error("wrong json", buf.String())
+	}
+	if rows.Next() || d.rowsClosed != 3 {
+		t.Error("rows should be closed", d.rowsClosed)
+	}
+
+	rows, _ = testDB.QueryRows("SELECT")
+	buf.Reset()
+	if count, err := WriteCsv(csv.NewWriter(buf), rows, true); err != nil || count != 3 {
+		t.Error("write csv failed", count, err)
+	}
+	if buf.String() != "id,name\n1,a\n2,\n3,\"c,d\"\n" {
+		t.Error("wrong csv", buf.String())
+	}
+}
@@ -0,0 +1,671 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// TIME_LAYOUTS are the layouts of DATETIME, TIMESTAMP and DATE columns,
+// which are returned as []byte if parseTime is not set in dsn
+var TIME_LAYOUTS = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// rowsSource is the rows scanned into structs, which is *sql.Rows or the rows of FakeDB
+type rowsSource interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// scanQueryRows scans all rows into dest, which is a *[]struct or a *[]*struct
+func scanQueryRows(dest interface{}, rows rowsSource) error {
+	defer rows.Close()
+	// dest 必须是 ptr
+	destType := reflect.TypeOf(dest)
+	if destType == nil || destType.Kind() != reflect.Ptr {
+		return fmt.Errorf("kelp.db.mysql: dest should be a ptr but %v", destType)
+	}
+	destValue := reflect.ValueOf(dest).Elem()
+	if !destValue.CanSet() {
+		return fmt.Errorf("kelp.db.mysql: dest can not set")
+	}
+	listType := destType.Elem()
+
+	// list必须是slice
+	if listType.Kind() != reflect.Slice {
+		return fmt.Errorf("kelp.db.mysql: target should be a slice but %s %s", listType.Kind(), listType)
+	}
+	// 获取list的元素类型
+	eleType := listType.Elem()
+	isPointer := false
+	// 如果是指针类型，就再取真实类型
+	if eleType.Kind() == reflect.Ptr {
+		eleType = eleType.Elem()
+		isPointer = true
+	}
+
+	// 必须要是struct类型
+	if eleType.Kind() != reflect.Struct {
+		return fmt.Errorf("kelp.db.mysql: target should be a []struct or a []*struct but []%s", eleType.Kind())
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	scanner := newRowScanner(eleType, columns)
+	for rows.Next() {
+		// 新建一个元素实例
+		ele := reflect.New(eleType).Elem()
+		if err := scanner.scan(rows, ele); err != nil {
+			return err
+		}
+		if isPointer {
+			// 元素是指针，要往slice里append指针
+			destValue.Set(reflect.Append(destValue, ele.Addr()))
+		} else {
+			destValue.Set(reflect.Append(destValue, ele))
+		}
+	}
+	return rows.Err()
+}
+
+// scanQueryOne scans the first row into dest, which is a *struct
+func scanQueryOne(dest interface{}, rows rowsSource) error {
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return NO_DATA_TO_BIND
+	}
+	if dest == nil {
+		return nil
+	}
+	// dest 必须是 ptr
+	destType := reflect.TypeOf(dest)
+	if destType.Kind() != reflect.Ptr {
+		return fmt.Errorf("kelp.db.mysql: dest should be a ptr but %s", destType.Kind())
+	}
+	destValue := reflect.ValueOf(dest).Elem()
+	if !destValue.CanSet() {
+		return fmt.Errorf("kelp.db.mysql: dest can not set")
+	}
+	eleType := destType.Elem()
+	// 必须要是struct类型
+	if eleType.Kind() != reflect.Struct {
+		return fmt.Errorf("kelp.db.mysql: target should be a *struct but *%s", eleType.Kind())
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := newRowScanner(eleType, columns).scan(rows, destValue); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// scanPlans caches *scanPlan by scanPlanKey
+var scanPlans sync.Map
+
+type scanPlanKey struct {
+	t reflect.Type
+	// columns are joined by \x00
+	columns string
+}
+
+// scanPlan maps the columns of a query to the fields of a struct type,
+// it is built once for every struct type and column set.
+type scanPlan struct {
+	columns []string
+	// fields are the fields of columns, which is nil if the column has no field,
+	// a column is set into every field with the same column name
+	fields [][]*scanField
+}
+
+type scanField struct {
+	index []int
+	// direct is true if the field is a sql.Scanner, which is scanned by rows.Scan
+	// if it is the only field of column
+	direct bool
+	set    fieldSetter
+}
+
+// fieldSetter converts src scanned from driver and sets it into field
+type fieldSetter func(field reflect.Value, src interface{}) error
+
+// getScanPlan returns the cached plan of struct type t and columns
+func getScanPlan(t reflect.Type, columns []string) *scanPlan {
+	key := scanPlanKey{t, strings.Join(columns, "\x00")}
+	if plan, exist := scanPlans.Load(key); exist {
+		return plan.(*scanPlan)
+	}
+	plan, _ := scanPlans.LoadOrStore(key, newScanPlan(t, columns))
+	return plan.(*scanPlan)
+}
+
+// newScanPlan maps columns to fields of struct type t.
+// The column name of field follows the same rules as Table, see getColumnName,
+// untagged fields also match columns case insensitively.
+// Fields of embedded structs without tag are also mapped,
+// which are shadowed by the fields of outer struct with the same name.
+func newScanPlan(t reflect.Type, columns []string) *scanPlan {
+	fields, untagged := collectFields(t, nil)
+	plan := &scanPlan{
+		columns: columns,
+		fields:  make([][]*scanField, len(columns)),
+	}
+	for i, column := range columns {
+		indexes := fields[column]
+		for _, index := range untagged[strings.ToLower(column)] {
+			if !containsIndex(indexes, index) {
+				indexes = append(indexes, index)
+			}
+		}
+		for _, index := range indexes {
+			fieldType := t.FieldByIndex(index).Type
+			plan.fields[i] = append(plan.fields[i], &scanField{
+				index: index,
+				// sql.NullTime can not scan DATETIME as []byte
+				direct: reflect.PtrTo(fieldType).Implements(scannerType) && fieldType != nullTimeType,
+				set:    setterOf(fieldType),
+			})
+		}
+	}
+	return plan
+}
+
+// collectFields returns the field indexes of column names and lower case names of untagged fields
+func collectFields(t reflect.Type, parent []int) (map[string][][]int, map[string][][]int) {
+	fields := map[string][][]int{}
+	untagged := map[string][][]int{}
+	embedded := [][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		name := getColumnName(field)
+		tagged := name != field.Name
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && !tagged && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			embedded = append(embedded, index)
+			continue
+		}
+		// unexported fields can not be set
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		fields[name] = append(fields[name], index)
+		if !tagged {
+			untagged[strings.ToLower(name)] = append(untagged[strings.ToLower(name)], index)
+		}
+	}
+	// the fields of embedded structs are merged after the outer fields, which shadow them
+	innerFields := map[string][][]int{}
+	innerUntagged := map[string][][]int{}
+	for _, index := range embedded {
+		fieldType := t.Field(index[len(index)-1]).Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		subFields, subUntagged := collectFields(fieldType, index)
+		for name, indexes := range subFields {
+			if _, exist := fields[name]; !exist {
+				innerFields[name] = append(innerFields[name], indexes...)
+			}
+		}
+		for name, indexes := range subUntagged {
+			if _, exist := untagged[name]; !exist {
+				innerUntagged[name] = append(innerUntagged[name], indexes...)
+			}
+		}
+	}
+	for name, indexes := range innerFields {
+		fields[name] = indexes
+	}
+	for name, indexes := range innerUntagged {
+		untagged[name] = indexes
+	}
+	return fields, untagged
+}
+
+func containsIndex(indexes [][]int, index []int) bool {
+	for _, item := range indexes {
+		if reflect.DeepEqual(item, index) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowScanner scans rows of a query with a plan, the buffers are reused by every row
+type rowScanner struct {
+	plan     *scanPlan
+	values   []interface{}
+	scanArgs []interface{}
+}
+
+func newRowScanner(t reflect.Type, columns []string) *rowScanner {
+	return &rowScanner{
+		plan:     getScanPlan(t, columns),
+		values:   make([]interface{}, len(columns)),
+		scanArgs: make([]interface{}, len(columns)),
+	}
+}
+
+// scan scans current row into ele
+func (this *rowScanner) scan(rows rowsSource, ele reflect.Value) error {
+	for i, fields := range this.plan.fields {
+		if len(fields) == 1 && fields[0].direct {
+			this.scanArgs[i] = fieldByIndex(ele, fields[0].index).Addr().Interface()
+		} else {
+			this.scanArgs[i] = &this.values[i]
+		}
+	}
+	if err := rows.Scan(this.scanArgs...); err != nil {
+		return err
+	}
+	for i, fields := range this.plan.fields {
+		if len(fields) == 1 && fields[0].direct {
+			continue
+		}
+		for _, field := range fields {
+			var err error
+			if field.direct {
+				err = fieldByIndex(ele, field.index).Addr().Interface().(sql.Scanner).Scan(this.values[i])
+			} else {
+				err = field.set(fieldByIndex(ele, field.index), this.values[i])
+			}
+			if err != nil {
+				return fmt.Errorf("kelp.db.mysql: scan column %s failed: %v", this.plan.columns[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the nested field, nil embedded pointers are allocated
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// setterOf returns the setter of type t.
+//
+// NULL sets pointer fields to nil and other fields to zero value,
+// use pointer or sql.Null* fields to tell NULL from zero.
+// Fields implement sql.Scanner scan src by themselves,
+// struct, map and slice fields are decoded from JSON.
+func setterOf(t reflect.Type) fieldSetter {
+	if t.Kind() == reflect.Ptr {
+		set := setterOf(t.Elem())
+		return func(field reflect.Value, src interface{}) error {
+			if src == nil {
+				field.Set(reflect.Zero(t))
+				return nil
+			}
+			value := reflect.New(t.Elem())
+			if err := set(value.Elem(), src); err != nil {
+				return err
+			}
+			field.Set(value)
+			return nil
+		}
+	}
+	var set fieldSetter
+	switch {
+	case t == timeType:
+		set = setTime
+	case t == nullTimeType:
+		set = setNullTime
+	case reflect.PtrTo(t).Implements(scannerType):
+		// scanners handle NULL by themselves
+		return setScanner
+	default:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			set = setInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			set = setUint
+		case reflect.Float32, reflect.Float64:
+			set = setFloat
+		case reflect.String:
+			set = setString
+		case reflect.Bool:
+			set = setBool
+		case reflect.Interface:
+			set = setInterface
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 {
+				set = setBytes
+			} else {
+				set = setJson
+			}
+		case reflect.Struct, reflect.Map, reflect.Array:
+			set = setJson
+		default:
+			return func(field reflect.Value, src interface{}) error {
+				return fmt.Errorf("unsupported type %s", t)
+			}
+		}
+	}
+	return func(field reflect.Value, src interface{}) error {
+		if src == nil {
+			field.Set(reflect.Zero(t))
+			return nil
+		}
+		return set(field, src)
+	}
+}
+
+func setScanner(field reflect.Value, src interface{}) error {
+	return field.Addr().Interface().(sql.Scanner).Scan(src)
+}
+
+func setTime(field reflect.Value, src interface{}) error {
+	t, err := asTime(src)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func setNullTime(field reflect.Value, src interface{}) error {
+	t, err := asTime(src)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: true}))
+	return nil
+}
+
+func setInt(field reflect.Value, src interface{}) error {
+	i, err := asInt64(src)
+	if err != nil {
+		return err
+	}
+	if field.OverflowInt(i) {
+		return fmt.Errorf("%d overflows %s", i, field.Type())
+	}
+	field.SetInt(i)
+	return nil
+}
+
+func setUint(field reflect.Value, src interface{}) error {
+	u, err := asUint64(src)
+	if err != nil {
+		return err
+	}
+	if field.OverflowUint(u) {
+		return fmt.Errorf("%d overflows %s", u, field.Type())
+	}
+	field.SetUint(u)
+	return nil
+}
+
+func setFloat(field reflect.Value, src interface{}) error {
+	f, err := asFloat64(src)
+	if err != nil {
+		return err
+	}
+	if field.OverflowFloat(f) {
+		return fmt.Errorf("%v overflows %s", f, field.Type())
+	}
+	field.SetFloat(f)
+	return nil
+}
+
+func setString(field reflect.Value, src interface{}) error {
+	field.SetString(asString(src))
+	return nil
+}
+
+func setBool(field reflect.Value, src interface{}) error {
+	b, err := asBool(src)
+	if err != nil {
+		return err
+	}
+	field.SetBool(b)
+	return nil
+}
+
+func setInterface(field reflect.Value, src interface{}) error {
+	if b, ok := src.([]byte); ok {
+		// the buffer of driver is reused by next row
+		src = append([]byte{}, b...)
+	}
+	value := reflect.ValueOf(src)
+	if !value.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("can not assign %T to %s", src, field.Type())
+	}
+	field.Set(value)
+	return nil
+}
+
+func setBytes(field reflect.Value, src interface{}) error {
+	if b, ok := src.([]byte); ok {
+		field.SetBytes(append([]byte{}, b...))
+	} else {
+		field.SetBytes([]byte(asString(src)))
+	}
+	return nil
+}
+
+// setJson decodes JSON column into field
+func setJson(field reflect.Value, src interface{}) error {
+	var data []byte
+	switch value := src.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return fmt.Errorf("can not decode %T into %s", src, field.Type())
+	}
+	value := reflect.New(field.Type())
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return err
+	}
+	field.Set(value.Elem())
+	return nil
+}
+
+func asInt64(src interface{}) (int64, error) {
+	switch value := src.(type) {
+	case int64:
+		return value, nil
+	case uint64:
+		if value > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int", value)
+		}
+		return int64(value), nil
+	case float64:
+		return floatToInt64(value)
+	case float32:
+		return floatToInt64(float64(value))
+	case bool:
+		if value {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		return strconv.ParseInt(string(value), 10, 64)
+	case string:
+		return strconv.ParseInt(value, 10, 64)
+	}
+	return 0, fmt.Errorf("can not convert %T to int", src)
+}
+
+// floatToInt64 converts a float without fraction to int
+func floatToInt64(value float64) (int64, error) {
+	if value != math.Trunc(value) {
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	if value < math.MinInt64 || value >= math.MaxInt64 {
+		return 0, fmt.Errorf("%v overflows int", value)
+	}
+	return int64(value), nil
+}
+
+func asUint64(src interface{}) (uint64, error) {
+	switch value := src.(type) {
+	case int64:
+		if value < 0 {
+			return 0, fmt.Errorf("%d overflows uint", value)
+		}
+		return uint64(value), nil
+	case uint64:
+		return value, nil
+	case bool:
+		if value {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		return strconv.ParseUint(string(value), 10, 64)
+	case string:
+		return strconv.ParseUint(value, 10, 64)
+	}
+	return 0, fmt.Errorf("can not convert %T to uint", src)
+}
+
+func asFloat64(src interface{}) (float64, error) {
+	switch value := src.(type) {
+	case float64:
+		return value, nil
+	case float32:
+		return float64(value), nil
+	case int64:
+		return float64(value), nil
+	case uint64:
+		return float64(value), nil
+	case []byte:
+		return strconv.ParseFloat(string(value), 64)
+	case string:
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("can not convert %T to float", src)
+}
+
+func asBool(src interface{}) (bool, error) {
+	switch value := src.(type) {
+	case bool:
+		return value, nil
+	case int64:
+		return value != 0, nil
+	case []byte:
+		return strconv.ParseBool(string(value))
+	case string:
+		return strconv.ParseBool(value)
+	}
+	return false, fmt.Errorf("can not convert %T to bool", src)
+}
+
+func asString(src interface{}) string {
+	switch value := src.(type) {
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05")
+	}
+	return ToString(src)
+}
+
+// asTime converts DATETIME, TIMESTAMP and DATE columns to time,
+// the zero date 0000-00-00 is converted to zero time
+func asTime(src interface{}) (time.Time, error) {
+	var s string
+	switch value := src.(type) {
+	case time.Time:
+		return value, nil
+	case []byte:
+		s = string(value)
+	case string:
+		s = value
+	default:
+		return time.Time{}, fmt.Errorf("can not convert %T to time", src)
+	}
+	if strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	for _, layout := range TIME_LAYOUTS {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can not parse time %q", s)
+}
+
+// columnValue returns the value of field used as a statement argument,
+// struct, map and slice fields which are not driver.Valuer are encoded as JSON
+func columnValue(field reflect.Value) interface{} {
+	value := field.Interface()
+	if field.Type().Implements(valuerType) {
+		return value
+	}
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return value
+		}
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			return value
+		}
+	case reflect.Map, reflect.Array:
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+	default:
+		return value
+	}
+	return jsonValue{value}
+}
+
+// jsonValue is a driver.Valuer encodes value as JSON
+type jsonValue struct {
+	value interface{}
+}
+
+func (this jsonValue) Value() (driver.Value, error) {
+	data, err := json.Marshal(this.value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,259 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type ScanBase struct {
+	Id        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ScanProfile struct {
+	City string   `json:"city"`
+	Tags []string `json:"tags"`
+}
+
+type ScanUser struct {
+	ScanBase
+	Name    string            `json:"name"`
+	Age     int8              `json:"age"`
+	Score   float32           `json:"score"`
+	Active  bool              `json:"active"`
+	Avatar  []byte            `json:"avatar"`
+	Email   *string           `json:"email"`
+	Phone   sql.NullString    `json:"phone"`
+	LoginAt sql.NullTime      `json:"login_at"`
+	Profile ScanProfile       `json:"profile"`
+	Extra   map[string]string `json:"extra"`
+	Raw     interface{}       `json:"raw"`
+	secret  string
+}
+
+func TestScanQueryRows(t *testing.T) {
+	d := &countDriver{
+		columns: []string{"id", "created_at", "name", "age", "score", "active", "avatar", "email", "phone", "login_at", "profile", "extra", "raw", "secret", "unknown"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("2020-01-02 03:04:05"), []byte("kelp"), int64(18), []byte("1.5"), int64(1), []byte{1, 2},
+				[]byte("a@b.c"), []byte("123"), []byte("2020-01-02 03:04:05.123"), []byte(`{"city":"bj","tags":["a"]}`), []byte(`{"k":"v"}`), int64(3), []byte("s"), []byte("u")},
+			{int64(2), []byte("0000-00-00 00:00:00"), []byte(""), nil, nil, nil, nil,
+				nil, nil, nil, nil, nil, nil, nil, nil},
+		},
+	}
+	sql.Register("kelp_scan", d)
+	conn, _ := sql.Open("kelp_scan", "")
+	testDB := &db{name: "test", conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}
+
+	list := []*ScanUser{}
+	if err := testDB.Query(&list, "SELECT"); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatal("should scan 2 rows but", len(list))
+	}
+	user := list[0]
+	email := "a@b.c"
+	expect := &ScanUser{
+		ScanBase: ScanBase{1, time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)},
+		Name:     "kelp",
+		Age:      18,
+		Score:    1.5,
+		Active:   true,
+		Avatar:   []byte{1, 2},
+		Email:    &email,
+		Phone:    sql.NullString{String: "123", Valid: true},
+		LoginAt:  sql.NullTime{Time: time.Date(2020, 1, 2, 3, 4, 5, 123000000, time.Local), Valid: true},
+		Profile:  ScanProfile{"bj", []string{"a"}},
+		Extra:    map[string]string{"k": "v"},
+		Raw:      int64(3),
+	}
+	if !reflect.DeepEqual(user, expect) {
+		t.Errorf("wrong scanned row\n%+v\n%+v", user, expect)
+	}
+	null := list[1]
+	if null.Email != nil || null.Phone.Valid || null.LoginAt.Valid || null.Extra != nil || null.Age != 0 || !null.CreatedAt.IsZero() {
+		t.Errorf("NULL should be scanned as nil or zero %+v", null)
+	}
+
+	one := &ScanUser{}
+	if err := testDB.QueryOne(one, "SELECT"); err != nil || one.Id != 1 {
+		t.Error("query one failed", one.Id, err)
+	}
+
+	// conversion failures
+	d.columns = []string{"age"}
+	d.rows = [][]driver.Value{{int64(300)}}
+	if err := testDB.QueryOne(one, "SELECT"); err == nil {
+		t.Error("overflow should fail")
+	}
+	d.rows = [][]driver.Value{{[]byte("abc")}}
+	if err := testDB.QueryOne(one, "SELECT"); err == nil {
+		t.Error("invalid int should fail")
+	}
+	d.columns = []string{"profile"}
+	d.rows = [][]driver.Value{{[]byte("{")}}
+	if err := testDB.QueryOne(one, "SELECT"); err == nil {
+		t.Error("invalid json should fail")
+	}
+}
+
+func TestColumnValue(t *testing.T) {
+	user := ScanUser{Profile: ScanProfile{City: "bj"}, Avatar: []byte{1}}
+	v := reflect.ValueOf(user)
+	value, err := columnValue(v.FieldByName("Profile")).(driver.Valuer).Value()
+	if err != nil || value != `{"city":"bj","tags":null}` {
+		t.Error("struct should be encoded as json", value, err)
+	}
+	if _, ok := columnValue(v.FieldByName("Avatar")).([]byte); !ok {
+		t.Error("bytes should not be encoded")
+	}
+	if _, ok := columnValue(v.FieldByName("Phone")).(sql.NullString); !ok {
+		t.Error("valuer should not be encoded")
+	}
+	if _, ok := columnValue(v.FieldByName("CreatedAt")).(time.Time); !ok {
+		t.Error("time should not be encoded")
+	}
+}
+
+func TestConvertNumber(t *testing.T) {
+	for _, src := range []interface{}{3.7, float32(-0.5), uint64(math.MaxUint64), 1e19} {
+		if value, err := asInt64(src); err == nil {
+			t.Error("should fail to convert", src, value)
+		}
+	}
+	for src, expect := range map[interface{}]int64{3.0: 3, float32(-2): -2, uint64(7): 7} {
+		if value, err := asInt64(src); err != nil || value != expect {
+			t.Error("wrong int of", src, value, err)
+		}
+	}
+	if value, err := asFloat64(uint64(5)); err != nil || value != 5 {
+		t.Error("wrong float of uint64", value, err)
+	}
+}
+
+func TestScanPlan(t *testing.T) {
+	type Plan struct {
+		Id       int64
+		UserName string `json:"user_name,omitempty"`
+		Ignored  string `json:"-"`
+		*ScanBase
+	}
+	planType := reflect.TypeOf(Plan{})
+	columns := []string{"ID", "user_name", "Ignored", "created_at", "UserName"}
+	plan := getScanPlan(planType, columns)
+	if plan != getScanPlan(planType, columns) {
+		t.Error("plan should be cached")
+	}
+	if plan == getScanPlan(planType, columns[:2]) {
+		t.Error("plan of other columns should not be shared")
+	}
+	expect := [][]int{{0}, {1}, nil, {3, 1}, nil}
+	for i, fields := range plan.fields {
+		if len(fields) == 0 && expect[i] != nil || len(fields) > 0 && (len(fields) != 1 || !reflect.DeepEqual(fields[0].index, expect[i])) {
+			t.Error("wrong fields of column", columns[i], fields)
+		}
+	}
+	// the column names are the same as Table
+	for i := 0; i < planType.NumField()-1; i++ {
+		if name := getColumnName(planType.Field(i)); name != []string{"Id", "user_name", "-"}[i] {
+			t.Error("wrong column name", name)
+		}
+	}
+}
+
+func TestScanSameColumn(t *testing.T) {
+	type Model struct {
+		Str   string
+		Dt    sql.NullString
+		Tsr   string `column:"dt"`
+		Extra string `column:"str"`
+	}
+	fake := NewFakeDB()
+	fake.ExpectQuery("SELECT").WillReturnRows(map[string]interface{}{"str": "str", "dt": "2020-01-02 03:04:05"})
+	list := []*Model{}
+	if err := fake.Query(&list, "SELECT * FROM model"); err != nil || len(list) != 1 {
+		t.Fatal(list, err)
+	}
+	expect := Model{"str", sql.NullString{String: "2020-01-02 03:04:05", Valid: true}, "2020-01-02 03:04:05", "str"}
+	if *list[0] != expect {
+		t.Errorf("column should be set into every field of the same name %+v", list[0])
+	}
+}
+
+type ScanWide struct {
+	ScanBase
+	C00, C01, C02, C03, C04, C05, C06, C07, C08, C09 string
+	I00, I01, I02, I03, I04, I05, I06, I07, I08, I09 int64
+	F00, F01, F02, F03, F04, F05, F06, F07, F08, F09 float64
+	N00, N01, N02, N03, N04, N05, N06, N07, N08, N09 sql.NullString
+	P00, P01, P02, P03, P04, P05, P06, P07, P08, P09 *int
+}
+
+// wideDBs caches the db of benchmarks, which are run many times
+var wideDBs = map[string]*db{}
+
+// newWideDB returns a db queries rows of ScanWide
+func newWideDB(name string, count int) *db {
+	if testDB, exist := wideDBs[name]; exist {
+		return testDB
+	}
+	d := &countDriver{columns: []string{"id", "created_at"}}
+	for _, prefix := range []string{"c", "i", "f", "n", "p"} {
+		for i := 0; i < 10; i++ {
+			d.columns = append(d.columns, prefix+"0"+strconv.Itoa(i))
+		}
+	}
+	row := []driver.Value{int64(1), []byte("2020-01-02 03:04:05")}
+	for i := 0; i < 10; i++ {
+		row = append(row, []byte("kelp"))
+	}
+	for i := 0; i < 10; i++ {
+		row = append(row, int64(i))
+	}
+	for i := 0; i < 10; i++ {
+		row = append(row, []byte("1.5"))
+	}
+	for i := 0; i < 10; i++ {
+		row = append(row, []byte("kelp"))
+	}
+	for i := 0; i < 10; i++ {
+		row = append(row, nil)
+	}
+	for i := 0; i < count; i++ {
+		d.rows = append(d.rows, row)
+	}
+	sql.Register(name, d)
+	conn, _ := sql.Open(name, "")
+	wideDBs[name] = &db{name: name, conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}
+	return wideDBs[name]
+}
+
+func BenchmarkScanWideRows(b *testing.B) {
+	testDB := newWideDB("kelp_bench_rows", 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list := []*ScanWide{}
+		if err := testDB.Query(&list, "SELECT"); err != nil || len(list) != 1000 {
+			b.Fatal(len(list), err)
+		}
+	}
+}
+
+func BenchmarkScanWideOne(b *testing.B) {
+	testDB := newWideDB("kelp_bench_one", 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		one := &ScanWide{}
+		if err := testDB.QueryOne(one, "SELECT"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
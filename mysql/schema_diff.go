@@ -0,0 +1,410 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SchemaChange is a change from the live database to the table definitions
+type SchemaChange struct {
+	Table string
+	// Up is the statement applies the change,
+	// destructive statements such as dropping a column are commented out for review
+	Up string
+	// Down is the statement reverts the change, which is empty if it can not be reverted
+	Down string
+}
+
+// informationColumn is a row of information_schema.COLUMNS
+type informationColumn struct {
+	TableName     string  `json:"table_name"`
+	ColumnName    string  `json:"column_name"`
+	ColumnType    string  `json:"column_type"`
+	IsNullable    string  `json:"is_nullable"`
+	ColumnDefault *string `json:"column_default"`
+	Extra         string  `json:"extra"`
+	ColumnComment string  `json:"column_comment"`
+}
+
+// queryInformationColumns queries the columns of all tables in current database
+func queryInformationColumns(conn Connector) ([]*informationColumn, error) {
+	columns := []*informationColumn{}
+	err := conn.Query(
+		&columns,
+		"SELECT TABLE_NAME AS table_name, COLUMN_NAME AS column_name, COLUMN_TYPE AS column_type, "+
+			"IS_NULLABLE AS is_nullable, COLUMN_DEFAULT AS column_default, EXTRA AS extra, COLUMN_COMMENT AS column_comment "+
+			"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION",
+	)
+	return columns, err
+}
+
+// informationIndex is a row of information_schema.STATISTICS
+type informationIndex struct {
+	TableName  string `json:"table_name"`
+	IndexName  string `json:"index_name"`
+	NonUnique  int    `json:"non_unique"`
+	ColumnName string `json:"column_name"`
+}
+
+// queryInformationIndexes queries the index columns of all tables in current database
+func queryInformationIndexes(conn Connector) ([]*informationIndex, error) {
+	indexes := []*informationIndex{}
+	err := conn.Query(
+		&indexes,
+		"SELECT TABLE_NAME AS table_name, INDEX_NAME AS index_name, NON_UNIQUE AS non_unique, COLUMN_NAME AS column_name "+
+			"FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX",
+	)
+	return indexes, err
+}
+
+// informationForeignKey is a row of information_schema.KEY_COLUMN_USAGE of foreign keys
+type informationForeignKey struct {
+	TableName            string `json:"table_name"`
+	ConstraintName       string `json:"constraint_name"`
+	ColumnName           string `json:"column_name"`
+	ReferencedTableName  string `json:"referenced_table_name"`
+	ReferencedColumnName string `json:"referenced_column_name"`
+}
+
+// queryInformationForeignKeys queries the foreign key columns of all tables in current database
+func queryInformationForeignKeys(conn Connector) ([]*informationForeignKey, error) {
+	foreignKeys := []*informationForeignKey{}
+	err := conn.Query(
+		&foreignKeys,
+		"SELECT TABLE_NAME AS table_name, CONSTRAINT_NAME AS constraint_name, COLUMN_NAME AS column_name, "+
+			"REFERENCED_TABLE_NAME AS referenced_table_name, REFERENCED_COLUMN_NAME AS referenced_column_name "+
+			"FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL "+
+			"ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION",
+	)
+	return foreignKeys, err
+}
+
+// liveTable is a table in live database
+type liveTable struct {
+	columns []*informationColumn
+	// indexes are ordered by name, the primary key is named PRIMARY
+	indexes     []*Index
+	foreignKeys []*ForeignKey
+}
+
+func (this *liveTable) index(name string) *Index {
+	for _, index := range this.indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// Plan compares the tables in live database with the tables in schema,
+// and returns the changes to migrate the database to the schema:
+//   - a missing table is created
+//   - a missing column is added
+//   - a column whose type or nullability is different is modified
+//   - a primary key or index whose columns or uniqueness is different is rebuilt
+//   - a missing index or foreign key is added
+//   - a column, index or foreign key not in schema is dropped, the statement is commented out
+//
+// Foreign keys are added after all tables are created, so tables can be added into schema in any order.
+// Defaults, comments, table options, the columns of an existing foreign key
+// and tables not in schema are not compared.
+func (this *Schema) Plan(conn Connector) ([]*SchemaChange, error) {
+	columns, err := queryInformationColumns(conn)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := queryInformationIndexes(conn)
+	if err != nil {
+		return nil, err
+	}
+	foreignKeys, err := queryInformationForeignKeys(conn)
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]*liveTable{}
+	getLive := func(name string) *liveTable {
+		if _, exist := live[name]; !exist {
+			live[name] = &liveTable{}
+		}
+		return live[name]
+	}
+	for _, column := range columns {
+		table := getLive(column.TableName)
+		table.columns = append(table.columns, column)
+	}
+	for _, row := range indexes {
+		table := getLive(row.TableName)
+		if index := table.index(row.IndexName); index != nil {
+			index.Columns = append(index.Columns, row.ColumnName)
+			continue
+		}
+		table.indexes = append(table.indexes, &Index{Name: row.IndexName, Columns: []string{row.ColumnName}, Unique: row.NonUnique == 0})
+	}
+	for _, row := range foreignKeys {
+		table := getLive(row.TableName)
+		if n := len(table.foreignKeys); n > 0 && table.foreignKeys[n-1].Name == row.ConstraintName {
+			table.foreignKeys[n-1].Columns = append(table.foreignKeys[n-1].Columns, row.ColumnName)
+			table.foreignKeys[n-1].RefColumns = append(table.foreignKeys[n-1].RefColumns, row.ReferencedColumnName)
+			continue
+		}
+		table.foreignKeys = append(table.foreignKeys, &ForeignKey{
+			Name:       row.ConstraintName,
+			Columns:    []string{row.ColumnName},
+			RefTable:   row.ReferencedTableName,
+			RefColumns: []string{row.ReferencedColumnName},
+		})
+	}
+	changes := []*SchemaChange{}
+	foreignKeyChanges := []*SchemaChange{}
+	for _, table := range this.tables {
+		changes = append(changes, table.plan(getLive(table.name))...)
+		foreignKeyChanges = append(foreignKeyChanges, table.planForeignKeys(getLive(table.name))...)
+	}
+	return append(changes, foreignKeyChanges...), nil
+}
+
+func (this *Table) plan(liveTable *liveTable) []*SchemaChange {
+	live := liveTable.columns
+	if len(live) == 0 {
+		create := this.getCreateSql(false)
+		if strings.TrimSpace(this.additional) != "" {
+			create += ";\n" + strings.TrimRight(strings.TrimSpace(this.additional), ";")
+		}
+		return []*SchemaChange{{
+			Table: this.name,
+			Up:    create,
+			Down:  fmt.Sprintf("DROP TABLE `%s`", this.name),
+		}}
+	}
+	liveColumns := map[string]*informationColumn{}
+	for _, column := range live {
+		liveColumns[column.ColumnName] = column
+	}
+	changes := []*SchemaChange{}
+	for i, field := range this.fields {
+		column, exist := liveColumns[field.name]
+		if !exist {
+			position := "FIRST"
+			if i > 0 {
+				position = fmt.Sprintf("AFTER `%s`", this.fields[i-1].name)
+			}
+			changes = append(changes, &SchemaChange{
+				Table: this.name,
+				Up:    fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s %s", this.name, field.name, field.schema, position),
+				Down:  fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", this.name, field.name),
+			})
+			continue
+		}
+		delete(liveColumns, field.name)
+		if normalizeColumnType(declaredColumnType(field.schema)) == normalizeColumnType(column.ColumnType) &&
+			declaredNullable(field.schema) == (column.IsNullable == "YES") {
+			continue
+		}
+		changes = append(changes, &SchemaChange{
+			Table: this.name,
+			Up:    fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s", this.name, field.name, withoutPrimaryKey(field.schema)),
+			Down:  fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s", this.name, field.name, column.definition()),
+		})
+	}
+	// keep the order of live columns
+	for _, column := range live {
+		if _, exist := liveColumns[column.ColumnName]; exist {
+			changes = append(changes, &SchemaChange{
+				Table: this.name,
+				Up:    fmt.Sprintf("-- ALTER TABLE `%s` DROP COLUMN `%s`", this.name, column.ColumnName),
+				Down:  "",
+			})
+		}
+	}
+	return append(changes, this.planIndexes(liveTable)...)
+}
+
+// planIndexes compares the primary key and indexes
+func (this *Table) planIndexes(live *liveTable) []*SchemaChange {
+	changes := []*SchemaChange{}
+	livePrimary := live.index("PRIMARY")
+	if len(this.primaryKey) > 0 && this.hasLiveColumns(live, this.primaryKey) &&
+		(livePrimary == nil || !sameColumns(livePrimary.Columns, this.primaryKey)) {
+		change := &SchemaChange{
+			Table: this.name,
+			Up:    fmt.Sprintf("ALTER TABLE `%s` ADD PRIMARY KEY %s", this.name, quoteColumns(this.primaryKey)),
+			Down:  fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY", this.name),
+		}
+		if livePrimary != nil {
+			change.Up = fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY %s", this.name, quoteColumns(this.primaryKey))
+			change.Down = fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY %s", this.name, quoteColumns(livePrimary.Columns))
+		}
+		changes = append(changes, change)
+	}
+	for _, index := range this.indexes {
+		liveIndex := live.index(index.Name)
+		if liveIndex == nil {
+			changes = append(changes, &SchemaChange{
+				Table: this.name,
+				Up:    fmt.Sprintf("ALTER TABLE `%s` ADD %s", this.name, index.definition()),
+				Down:  fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`", this.name, index.Name),
+			})
+			continue
+		}
+		if liveIndex.Unique == index.Unique && sameColumns(liveIndex.Columns, index.Columns) {
+			continue
+		}
+		changes = append(changes, &SchemaChange{
+			Table: this.name,
+			Up:    fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`, ADD %s", this.name, index.Name, index.definition()),
+			Down:  fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`, ADD %s", this.name, index.Name, liveIndex.definition()),
+		})
+	}
+	for _, liveIndex := range live.indexes {
+		// the index created by mysql for a foreign key is named as the constraint
+		if liveIndex.Name == "PRIMARY" || this.Index(liveIndex.Name) != nil || this.foreignKey(liveIndex.Name) != nil {
+			continue
+		}
+		changes = append(changes, &SchemaChange{
+			Table: this.name,
+			Up:    fmt.Sprintf("-- ALTER TABLE `%s` DROP INDEX `%s`", this.name, liveIndex.Name),
+			Down:  "",
+		})
+	}
+	return changes
+}
+
+// planForeignKeys compares the foreign keys by name
+func (this *Table) planForeignKeys(live *liveTable) []*SchemaChange {
+	changes := []*SchemaChange{}
+	liveNames := map[string]bool{}
+	for _, foreignKey := range live.foreignKeys {
+		liveNames[foreignKey.Name] = true
+	}
+	for _, foreignKey := range this.foreignKeys {
+		name := this.foreignKeyName(foreignKey)
+		if liveNames[name] {
+			continue
+		}
+		changes = append(changes, &SchemaChange{
+			Table: this.name,
+			Up:    fmt.Sprintf("ALTER TABLE `%s` ADD %s", this.name, this.foreignKeyDefinition(foreignKey)),
+			Down:  fmt.Sprintf("ALTER TABLE `%s` DROP FOREIGN KEY `%s`", this.name, name),
+		})
+	}
+	for _, foreignKey := range live.foreignKeys {
+		if this.foreignKey(foreignKey.Name) == nil {
+			changes = append(changes, &SchemaChange{
+				Table: this.name,
+				Up:    fmt.Sprintf("-- ALTER TABLE `%s` DROP FOREIGN KEY `%s`", this.name, foreignKey.Name),
+				Down:  "",
+			})
+		}
+	}
+	return changes
+}
+
+// foreignKey returns the foreign key of name
+func (this *Table) foreignKey(name string) *ForeignKey {
+	for _, foreignKey := range this.foreignKeys {
+		if this.foreignKeyName(foreignKey) == name {
+			return foreignKey
+		}
+	}
+	return nil
+}
+
+// hasLiveColumns returns whether all columns exist in live table
+func (this *Table) hasLiveColumns(live *liveTable, columns []string) bool {
+	for _, name := range columns {
+		found := false
+		for _, column := range live.columns {
+			if column.ColumnName == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// definition returns the column definition used by ALTER TABLE
+func (this *informationColumn) definition() string {
+	definition := this.ColumnType
+	if this.IsNullable == "NO" {
+		definition += " NOT NULL"
+	} else {
+		definition += " NULL"
+	}
+	if this.ColumnDefault != nil {
+		value := *this.ColumnDefault
+		if strings.HasPrefix(strings.ToUpper(value), "CURRENT_TIMESTAMP") {
+			definition += " DEFAULT " + value
+		} else {
+			definition += " DEFAULT " + quoteString(value)
+		}
+	}
+	// DEFAULT_GENERATED is set by mysql 8.0 for expression defaults
+	extra := strings.TrimSpace(strings.Replace(strings.ToUpper(this.Extra), "DEFAULT_GENERATED", "", 1))
+	if extra != "" {
+		definition += " " + extra
+	}
+	if this.ColumnComment != "" {
+		definition += " COMMENT " + quoteString(this.ColumnComment)
+	}
+	return definition
+}
+
+var (
+	// columnAttributeRegexp matches the first keyword after the type in column definition
+	columnAttributeRegexp = regexp.MustCompile(`(?i)\s+(NOT\s+NULL|NULL|DEFAULT|PRIMARY|UNIQUE|KEY|AUTO_INCREMENT|COMMENT|CHARACTER|CHARSET|COLLATE|ON\s+UPDATE|GENERATED|AS|REFERENCES|CHECK|INVISIBLE|VISIBLE)\b`)
+	integerWidthRegexp    = regexp.MustCompile(`\b(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	parenthesesRegexp     = regexp.MustCompile(`\(\s*([^)]*?)\s*\)`)
+	primaryKeyRegexp      = regexp.MustCompile(`(?i)\bPRIMARY\s+KEY\b`)
+)
+
+// declaredColumnType returns the type part of column_schema
+func declaredColumnType(schema string) string {
+	schema = strings.TrimSpace(schema)
+	if loc := columnAttributeRegexp.FindStringIndex(schema); loc != nil {
+		return schema[:loc[0]]
+	}
+	return schema
+}
+
+// declaredNullable returns whether column_schema allows NULL
+func declaredNullable(schema string) bool {
+	upper := strings.ToUpper(schema)
+	return !strings.Contains(upper, "NOT NULL") && !strings.Contains(upper, "PRIMARY KEY")
+}
+
+// normalizeColumnType normalizes the column type for comparing,
+// the display width of integers is removed, which is deprecated since mysql 8.0.17
+func normalizeColumnType(columnType string) string {
+	t := strings.ToLower(strings.Join(strings.Fields(columnType), " "))
+	t = parenthesesRegexp.ReplaceAllStringFunc(t, func(s string) string {
+		return strings.Replace(strings.Replace(s, " ", "", -1), "\t", "", -1)
+	})
+	switch t {
+	case "bool", "boolean":
+		return "tinyint"
+	}
+	t = strings.Replace(t, "integer", "int", -1)
+	return integerWidthRegexp.ReplaceAllString(t, "$1")
+}
+
+// withoutPrimaryKey removes PRIMARY KEY from column_schema, which can not be used in MODIFY COLUMN
+func withoutPrimaryKey(schema string) string {
+	return strings.Join(strings.Fields(primaryKeyRegexp.ReplaceAllString(schema, "")), " ")
+}
@@ -0,0 +1,169 @@
+package mysql
+
+import (
+	"testing"
+)
+
+type DiffUser struct {
+	Id      int64  `json:"id" column_schema:"INT UNSIGNED NOT NULL PRIMARY KEY AUTO_INCREMENT"`
+	Name    string `json:"name" column_schema:"VARCHAR(64) NOT NULL" index:""`
+	Age     int    `json:"age" column_schema:"INT NOT NULL DEFAULT 0" index:"idx_age_email"`
+	Email   string `json:"email" column_schema:"VARCHAR(128)" unique:"" index:"idx_age_email"`
+	Enabled bool   `json:"enabled" column_schema:"BOOLEAN NOT NULL DEFAULT 1"`
+}
+
+type DiffLog struct {
+	Id      int64  `json:"id" column_schema:"BIGINT NOT NULL PRIMARY KEY"`
+	UserId  int64  `json:"user_id" column_schema:"INT UNSIGNED NOT NULL" references:"diff_user(id)" on_delete:"CASCADE"`
+	Content string `json:"content" column_schema:"TEXT"`
+}
+
+// informationConnector returns the rows of information_schema
+type informationConnector struct {
+	TestDB
+	tables      []*informationTable
+	columns     []*informationColumn
+	indexes     []*informationIndex
+	foreignKeys []*informationForeignKey
+}
+
+func (this *informationConnector) Query(destList interface{}, sql string, params ...interface{}) error {
+	switch dest := destList.(type) {
+	case *[]*informationTable:
+		*dest = this.tables
+	case *[]*informationColumn:
+		*dest = this.columns
+	case *[]*informationIndex:
+		*dest = this.indexes
+	case *[]*informationForeignKey:
+		*dest = this.foreignKeys
+	}
+	return nil
+}
+
+func TestSchemaPlan(t *testing.T) {
+	def := "0"
+	conn := &informationConnector{columns: []*informationColumn{
+		{TableName: "diff_user", ColumnName: "id", ColumnType: "int(10) unsigned", IsNullable: "NO", Extra: "auto_increment"},
+		{TableName: "diff_user", ColumnName: "name", ColumnType: "varchar(32)", IsNullable: "NO", ColumnComment: "user's name"},
+		{TableName: "diff_user", ColumnName: "email", ColumnType: "varchar(128)", IsNullable: "YES"},
+		{TableName: "diff_user", ColumnName: "enabled", ColumnType: "tinyint(1)", IsNullable: "NO", ColumnDefault: &def},
+		{TableName: "diff_user", ColumnName: "nickname", ColumnType: "varchar(64)", IsNullable: "YES"},
+		{TableName: "other", ColumnName: "id", ColumnType: "int", IsNullable: "NO"},
+	}, indexes: []*informationIndex{
+		{TableName: "diff_user", IndexName: "PRIMARY", ColumnName: "id"},
+		{TableName: "diff_user", IndexName: "idx_name", NonUnique: 1, ColumnName: "name"},
+		{TableName: "diff_user", IndexName: "uk_email", NonUnique: 1, ColumnName: "email"},
+		{TableName: "diff_user", IndexName: "idx_nickname", NonUnique: 1, ColumnName: "nickname"},
+	}, foreignKeys: []*informationForeignKey{
+		{TableName: "diff_user", ConstraintName: "fk_old", ColumnName: "id", ReferencedTableName: "other", ReferencedColumnName: "id"},
+	}}
+	schema := NewSchema()
+	schema.Add(DiffUser{})
+	schema.Add(DiffLog{}).SetCharset("utf8mb4")
+	changes, err := schema.Plan(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []SchemaChange{
+		{
+			"diff_user",
+			"ALTER TABLE `diff_user` MODIFY COLUMN `name` VARCHAR(64) NOT NULL",
+			"ALTER TABLE `diff_user` MODIFY COLUMN `name` varchar(32) NOT NULL COMMENT 'user\\'s name'",
+		},
+		{
+			"diff_user",
+			"ALTER TABLE `diff_user` ADD COLUMN `age` INT NOT NULL DEFAULT 0 AFTER `name`",
+			"ALTER TABLE `diff_user` DROP COLUMN `age`",
+		},
+		{
+			"diff_user",
+			"-- ALTER TABLE `diff_user` DROP COLUMN `nickname`",
+			"",
+		},
+		{
+			"diff_user",
+			"ALTER TABLE `diff_user` ADD KEY `idx_age_email` (`age`, `email`)",
+			"ALTER TABLE `diff_user` DROP INDEX `idx_age_email`",
+		},
+		{
+			"diff_user",
+			"ALTER TABLE `diff_user` DROP INDEX `uk_email`, ADD UNIQUE KEY `uk_email` (`email`)",
+			"ALTER TABLE `diff_user` DROP INDEX `uk_email`, ADD KEY `uk_email` (`email`)",
+		},
+		{
+			"diff_user",
+			"-- ALTER TABLE `diff_user` DROP INDEX `idx_nickname`",
+			"",
+		},
+		{
+			"diff_log",
+			"CREATE TABLE `diff_log` (\n\t`id` BIGINT NOT NULL PRIMARY KEY,\n\t`user_id` INT UNSIGNED NOT NULL,\n\t`content` TEXT\n) DEFAULT CHARSET=utf8mb4",
+			"DROP TABLE `diff_log`",
+		},
+		{
+			"diff_user",
+			"-- ALTER TABLE `diff_user` DROP FOREIGN KEY `fk_old`",
+			"",
+		},
+		{
+			"diff_log",
+			"ALTER TABLE `diff_log` ADD CONSTRAINT `fk_diff_log_user_id` FOREIGN KEY (`user_id`) REFERENCES `diff_user` (`id`) ON DELETE CASCADE",
+			"ALTER TABLE `diff_log` DROP FOREIGN KEY `fk_diff_log_user_id`",
+		},
+	}
+	if len(changes) != len(expects) {
+		t.Fatal("wrong changes", len(changes))
+	}
+	for i, expect := range expects {
+		if *changes[i] != expect {
+			t.Errorf("change %d should be\n%#v\nbut\n%#v", i, expect, *changes[i])
+		}
+	}
+}
+
+func TestNormalizeColumnType(t *testing.T) {
+	for declared, live := range map[string]string{
+		"INT UNSIGNED":   "int(10) unsigned",
+		"INTEGER":        "int(11)",
+		"BOOL":           "tinyint(1)",
+		"DECIMAL(10, 2)": "decimal(10,2)",
+		"ENUM('a', 'b')": "enum('a','b')",
+		"DATETIME":       "datetime",
+		"VARCHAR( 32 )":  "varchar(32)",
+	} {
+		if normalizeColumnType(declared) != normalizeColumnType(live) {
+			t.Error(declared, "should equal", live, normalizeColumnType(declared), normalizeColumnType(live))
+		}
+	}
+	if declaredColumnType("VARCHAR(64) NOT NULL DEFAULT ''") != "VARCHAR(64)" {
+		t.Error("wrong declared type")
+	}
+}
+
+type DiffMember struct {
+	GroupId int64  `json:"group_id" column_schema:"INT NOT NULL" primary_key:""`
+	UserId  int64  `json:"user_id" column_schema:"INT NOT NULL" primary_key:""`
+	Role    string `json:"role" column_schema:"VARCHAR(16) NOT NULL"`
+}
+
+func TestSchemaPlanPrimaryKey(t *testing.T) {
+	conn := &informationConnector{columns: []*informationColumn{
+		{TableName: "diff_member", ColumnName: "group_id", ColumnType: "int", IsNullable: "NO"},
+		{TableName: "diff_member", ColumnName: "user_id", ColumnType: "int", IsNullable: "NO"},
+		{TableName: "diff_member", ColumnName: "role", ColumnType: "varchar(16)", IsNullable: "NO"},
+	}, indexes: []*informationIndex{
+		{TableName: "diff_member", IndexName: "PRIMARY", ColumnName: "group_id"},
+	}}
+	schema := NewSchema()
+	schema.Add(DiffMember{})
+	changes, err := schema.Plan(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 ||
+		changes[0].Up != "ALTER TABLE `diff_member` DROP PRIMARY KEY, ADD PRIMARY KEY (`group_id`, `user_id`)" ||
+		changes[0].Down != "ALTER TABLE `diff_member` DROP PRIMARY KEY, ADD PRIMARY KEY (`group_id`)" {
+		t.Error("wrong changes", changes)
+	}
+}
@@ -0,0 +1,242 @@
+package mysql
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// DEFAULT_STMT_CACHE_SIZE is the default count of prepared statements cached in a db
+const DEFAULT_STMT_CACHE_SIZE = 64
+
+// stmtCache is a LRU cache of prepared statements, the key is the sql.
+// A sql.Stmt is prepared on every connection of the pool when it is used,
+// and is re-prepared by database/sql when the connection is reset.
+type stmtCache struct {
+	mux      sync.Mutex
+	capacity int
+	list     *list.List
+	items    map[string]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// stmtEntry is a cached stmt, which is closed after it is removed and released by all holders
+type stmtEntry struct {
+	query string
+	stmt  *sql.Stmt
+	// refs is the count of queries holding the stmt
+	refs    int
+	removed bool
+}
+
+// StmtStats is the statistics of prepared statement cache of a db
+type StmtStats struct {
+	Size      int
+	Capacity  int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// HitRate returns hits / (hits + misses), which is 0 if there is no query
+func (this *StmtStats) HitRate() float64 {
+	if this.Hits+this.Misses == 0 {
+		return 0
+	}
+	return float64(this.Hits) / float64(this.Hits+this.Misses)
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		list:     list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (this *stmtCache) enabled() bool {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.capacity > 0
+}
+
+// get returns the cached stmt of query and a function to release it after using
+func (this *stmtCache) get(query string) (*sql.Stmt, func(), bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if elem, exist := this.items[query]; exist {
+		this.list.MoveToFront(elem)
+		atomic.AddUint64(&this.hits, 1)
+		entry := elem.Value.(*stmtEntry)
+		return entry.stmt, this.hold(entry), true
+	}
+	atomic.AddUint64(&this.misses, 1)
+	return nil, nil, false
+}
+
+// put stores stmt and returns the cached one with a function to release it after using,
+// if another stmt of query is stored concurrently, stmt is closed and the stored one is returned
+func (this *stmtCache) put(query string, stmt *sql.Stmt) (*sql.Stmt, func()) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if elem, exist := this.items[query]; exist {
+		stmt.Close()
+		this.list.MoveToFront(elem)
+		entry := elem.Value.(*stmtEntry)
+		return entry.stmt, this.hold(entry)
+	}
+	entry := &stmtEntry{query: query, stmt: stmt}
+	this.items[query] = this.list.PushFront(entry)
+	release := this.hold(entry)
+	this.trim()
+	return stmt, release
+}
+
+// hold counts a holder of entry, and returns the function to release it,
+// the stmt of a removed entry is closed by the last holder
+func (this *stmtCache) hold(entry *stmtEntry) func() {
+	entry.refs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			this.mux.Lock()
+			defer this.mux.Unlock()
+			entry.refs--
+			if entry.removed && entry.refs == 0 {
+				entry.stmt.Close()
+			}
+		})
+	}
+}
+
+// remove removes the stmt of query, which is closed after it is released
+func (this *stmtCache) remove(query string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if elem, exist := this.items[query]; exist {
+		this.removeElement(elem)
+	}
+}
+
+// clear removes all stmts, which are closed after they are released
+func (this *stmtCache) clear() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for this.list.Len() > 0 {
+		this.removeElement(this.list.Back())
+	}
+}
+
+// resize changes the capacity, the cache is disabled if capacity is not positive
+func (this *stmtCache) resize(capacity int) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.capacity = capacity
+	this.trim()
+}
+
+// trim removes the least recently used stmts over capacity
+func (this *stmtCache) trim() {
+	for this.list.Len() > 0 && this.list.Len() > this.capacity {
+		this.removeElement(this.list.Back())
+		atomic.AddUint64(&this.evictions, 1)
+	}
+}
+
+func (this *stmtCache) removeElement(elem *list.Element) {
+	entry := this.list.Remove(elem).(*stmtEntry)
+	delete(this.items, entry.query)
+	entry.removed = true
+	// the stmt in use is closed when it is released
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+func (this *stmtCache) stats() *StmtStats {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return &StmtStats{
+		Size:      this.list.Len(),
+		Capacity:  this.capacity,
+		Hits:      atomic.LoadUint64(&this.hits),
+		Misses:    atomic.LoadUint64(&this.misses),
+		Evictions: atomic.LoadUint64(&this.evictions),
+	}
+}
+
+// SetStmtCacheSize sets the count of prepared statements cached in db added by AddDB,
+// or in every database of cluster added by AddCluster,
+// 0 disables the cache, which prepares and closes statement on every query.
+func SetStmtCacheSize(name string, size int) {
+	switch conn := p.store[name].(type) {
+	case *db:
+		conn.stmts.resize(size)
+	case *cluster:
+		conn.primary.stmts.resize(size)
+		for _, replica := range conn.replicas {
+			replica.stmts.resize(size)
+		}
+	}
+}
+
+// GetStmtStats returns the statistics of prepared statement cache of db added by AddDB,
+// it returns nil if there is no such db.
+func GetStmtStats(name string) *StmtStats {
+	if d, ok := p.store[name].(*db); ok {
+		return d.stmts.stats()
+	}
+	return nil
+}
+
+// statementPreparer is implemented by db and tx
+type statementPreparer interface {
+	// prepare returns a stmt and a function to release it after using
+	prepare(query string) (*sql.Stmt, func(), error)
+	// evict removes the cached stmt of query
+	evict(query string)
+}
+
+// queryRows queries rows with a prepared statement,
+// if the statement is invalid on server, such as the table has been altered,
+// it is prepared again and queried once more.
+// The release function should be called after rows are closed.
+func queryRows(preparer statementPreparer, query string, params []interface{}) (*sql.Rows, func(), error) {
+	stmt, release, err := preparer.prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := stmt.Query(params...)
+	if err != nil && needReprepare(err) {
+		log.Warn("re-prepare on", err)
+		release()
+		preparer.evict(query)
+		if stmt, release, err = preparer.prepare(query); err != nil {
+			return nil, nil, err
+		}
+		rows, err = stmt.Query(params...)
+	}
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return rows, release, nil
+}
+
+// needReprepare returns whether the prepared statement should be prepared again
+func needReprepare(err error) bool {
+	if mysqlErr, ok := err.(*driver.MySQLError); ok {
+		switch mysqlErr.Number {
+		case 1243, // ER_UNKNOWN_STMT_HANDLER
+			1615: // ER_NEED_REPREPARE
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countDriver is a driver counts prepared and closed statements,
+// and returns columns and rows for every query
+type countDriver struct {
+	prepared   int
+	closed     int
+	rowsClosed int
+	queries    []string
+	committed  int
+	rolledBack int
+	txOptions  driver.TxOptions
+	// down makes Ping fail, hang makes Ping wait until ctx is done
+	down     bool
+	hang     bool
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	// execErr is returned by every exec, which counts execs
+	execErr error
+	execs   int
+}
+
+type countConn struct{ d *countDriver }
+type countStmt struct{ d *countDriver }
+type countRows struct {
+	d    *countDriver
+	next int
+}
+
+func (this *countDriver) Open(name string) (driver.Conn, error) { return &countConn{this}, nil }
+
+func (this *countConn) Prepare(query string) (driver.Stmt, error) {
+	this.d.prepared++
+	this.d.queries = append(this.d.queries, query)
+	return &countStmt{this.d}, nil
+}
+func (this *countConn) Close() error { return nil }
+func (this *countConn) Ping(ctx context.Context) error {
+	if this.d.down {
+		return driver.ErrBadConn
+	}
+	if this.d.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+func (this *countConn) Begin() (driver.Tx, error) { return this, nil }
+func (this *countConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	this.d.txOptions = opts
+	return this, nil
+}
+func (this *countConn) Commit() error {
+	this.d.committed++
+	return nil
+}
+func (this *countConn) Rollback() error {
+	this.d.rolledBack++
+	return nil
+}
+
+func (this *countStmt) Close() error {
+	this.d.closed++
+	return nil
+}
+func (this *countStmt) NumInput() int { return -1 }
+func (this *countStmt) Exec(args []driver.Value) (driver.Result, error) {
+	this.d.execs++
+	if this.d.execErr != nil {
+		return nil, this.d.execErr
+	}
+	return countResult{this.d.affected}, nil
+}
+
+// countResult returns affected rows and 0 as last insert id
+type countResult struct{ affected int64 }
+
+func (this countResult) LastInsertId() (int64, error) { return 0, nil }
+func (this countResult) RowsAffected() (int64, error) { return this.affected, nil }
+func (this *countStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &countRows{d: this.d}, nil
+}
+
+func (this *countRows) Columns() []string { return this.d.columns }
+func (this *countRows) Close() error {
+	this.d.rowsClosed++
+	return nil
+}
+func (this *countRows) Next(dest []driver.Value) error {
+	if this.next >= len(this.d.rows) {
+		return io.EOF
+	}
+	copy(dest, this.d.rows[this.next])
+	this.next++
+	return nil
+}
+
+func TestStmtCache(t *testing.T) {
+	d := &countDriver{}
+	sql.Register("kelp_count", d)
+	conn, _ := sql.Open("kelp_count", "")
+	conn.SetMaxOpenConns(1)
+	testDB := &db{name: "test", conn: conn, stmts: newStmtCache(2)}
+	list := []*struct{}{}
+
+	for _, query := range []string{"a", "b", "a", "c", "a"} {
+		if err := testDB.Query(&list, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a b a(hit) c(evict b) a(hit)
+	stats := testDB.stmts.stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Evictions != 1 || stats.Size != 2 {
+		t.Error("wrong stats", stats)
+	}
+	if stats.HitRate() != 0.4 {
+		t.Error("wrong hit rate", stats.HitRate())
+	}
+	if d.prepared != 3 || d.closed != 1 {
+		t.Error("cached statements should not be prepared again", d.prepared, d.closed)
+	}
+
+	// transaction reuses statement of db
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Query(&list, "a"); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if testDB.stmts.stats().Hits != 3 || d.prepared != 3 {
+		t.Error("transaction should reuse cached statement", testDB.stmts.stats(), d.prepared)
+	}
+
+	// disable cache
+	testDB.stmts.resize(0)
+	if d.closed != 3 {
+		t.Error("resize should close evicted statements", d.closed)
+	}
+	testDB.Query(&list, "a")
+	if d.prepared != 4 || d.closed != 4 || testDB.stmts.stats().Size != 0 {
+		t.Error("statement should be closed without cache", d.prepared, d.closed)
+	}
+}
+
+// nopDriver is a stateless driver which is safe for concurrent use
+type nopDriver struct{}
+type nopConn struct{}
+type nopStmt struct{}
+type nopRows struct{}
+
+func (nopDriver) Open(name string) (driver.Conn, error)         { return nopConn{}, nil }
+func (nopConn) Prepare(query string) (driver.Stmt, error)       { return nopStmt{}, nil }
+func (nopConn) Close() error                                    { return nil }
+func (nopConn) Begin() (driver.Tx, error)                       { return nil, driver.ErrSkip }
+func (nopStmt) Close() error                                    { return nil }
+func (nopStmt) NumInput() int                                   { return -1 }
+func (nopStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (nopStmt) Query(args []driver.Value) (driver.Rows, error)  { return nopRows{}, nil }
+func (nopRows) Columns() []string                               { return []string{"id"} }
+func (nopRows) Close() error                                    { return nil }
+func (nopRows) Next(dest []driver.Value) error                  { return io.EOF }
+
+func TestStmtCacheConcurrentEviction(t *testing.T) {
+	sql.Register("kelp_nop", nopDriver{})
+	conn, _ := sql.Open("kelp_nop", "")
+	// the cache is smaller than the working set, so stmts are evicted while in use
+	testDB := &db{name: "test", conn: conn, stmts: newStmtCache(1)}
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			list := []*struct {
+				Id int64 `json:"id"`
+			}{}
+			for j := 0; j < 1000; j++ {
+				if err := testDB.Query(&list, fmt.Sprintf("SELECT %d", (i+j)%7)); err != nil {
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if failed != 0 {
+		t.Error("queries should not fail on evicted statements", failed)
+	}
+	if stats := testDB.stmts.stats(); stats.Size != 1 || stats.Evictions == 0 {
+		t.Error("wrong stats", stats)
+	}
+}
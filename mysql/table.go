@@ -11,10 +11,20 @@ type Table struct {
 	model     interface{}
 	modelType reflect.Type
 
-	name       string
-	charset    string
-	additional string
-	fields     []*TableField
+	name        string
+	charset     string
+	collation   string
+	engine      string
+	comment     string
+	additional  string
+	fields      []*TableField
+	indexes     []*Index
+	foreignKeys []*ForeignKey
+	// primaryKey is set by SetPrimaryKey or primary_key tag, or the columns declared PRIMARY KEY in schema
+	primaryKey []string
+	// primaryKeySet whether the primary key is set by SetPrimaryKey
+	primaryKeySet bool
+	softDelete    string
 }
 
 type TableField struct {
@@ -23,6 +33,29 @@ type TableField struct {
 
 	name   string
 	schema string
+	// autoIncrement whether the column is declared AUTO_INCREMENT
+	autoIncrement bool
+}
+
+// Index is an index of table, declared by index or unique tag,
+// or added by AddIndex and AddUniqueIndex.
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ForeignKey is a foreign key constraint of table, declared by references tag,
+// or added by AddForeignKey.
+type ForeignKey struct {
+	// Name is the constraint name, the default is fk_<table>_<columns>
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	// OnDelete and OnUpdate are the reference options, such as CASCADE, SET NULL
+	OnDelete string
+	OnUpdate string
 }
 
 func NewTable(model interface{}) *Table {
@@ -43,6 +76,9 @@ func NewTable(model interface{}) *Table {
 	table.modelType = modelValue.Type()
 	table.name = getTableNameFromTypeName(modelValue.Type().Name())
 
+	// tagged is the columns with primary_key tag
+	tagged := []string{}
+
 	for i := 0; i < modelValue.NumField(); i++ {
 		fieldType := modelValue.Type().Field(i)
 		columnName := getColumnName(fieldType)
@@ -53,25 +89,169 @@ func NewTable(model interface{}) *Table {
 		if !exist {
 			panic("column field has no schema tag")
 		}
+		upperSchema := strings.ToUpper(fieldSchema)
 		table.fields = append(table.fields, &TableField{
-			propName: fieldType.Name,
-			name:     columnName,
-			schema:   fieldSchema,
+			propName:      fieldType.Name,
+			propIndex:     i,
+			name:          columnName,
+			schema:        fieldSchema,
+			autoIncrement: strings.Contains(upperSchema, "AUTO_INCREMENT"),
 		})
+		if strings.Contains(upperSchema, "PRIMARY KEY") {
+			table.primaryKey = append(table.primaryKey, columnName)
+		}
+		if _, exist := fieldType.Tag.Lookup("primary_key"); exist {
+			tagged = append(tagged, columnName)
+		}
+		if tag, exist := fieldType.Tag.Lookup("index"); exist {
+			table.addIndexColumn(tag, "idx_", columnName, false)
+		}
+		if tag, exist := fieldType.Tag.Lookup("unique"); exist {
+			table.addIndexColumn(tag, "uk_", columnName, true)
+		}
+		if tag, exist := fieldType.Tag.Lookup("references"); exist {
+			table.foreignKeys = append(table.foreignKeys, parseReferences(
+				columnName,
+				tag,
+				fieldType.Tag.Get("on_delete"),
+				fieldType.Tag.Get("on_update"),
+			))
+		}
+	}
+	if len(tagged) > 0 {
+		table.SetPrimaryKey(tagged...)
 	}
 	return table
 }
 
+// addIndexColumn adds column into the indexes named in tag, which are separated by comma,
+// an empty tag means an index of the column named with prefix.
+// The columns of a composite index are in the order of fields.
+func (this *Table) addIndexColumn(tag, prefix, column string, unique bool) {
+	for _, name := range strings.Split(tag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = prefix + column
+		}
+		if index := this.Index(name); index != nil {
+			index.Columns = append(index.Columns, column)
+			continue
+		}
+		this.indexes = append(this.indexes, &Index{Name: name, Columns: []string{column}, Unique: unique})
+	}
+}
+
+var referencesRegexp = regexp.MustCompile(`^\s*(\w+)\s*\(\s*(\w+)\s*\)\s*$`)
+
+// parseReferences parses references tag such as user(id)
+func parseReferences(column, tag, onDelete, onUpdate string) *ForeignKey {
+	match := referencesRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		panic("references tag should be table(column), but " + tag)
+	}
+	return &ForeignKey{
+		Columns:    []string{column},
+		RefTable:   match[1],
+		RefColumns: []string{match[2]},
+		OnDelete:   onDelete,
+		OnUpdate:   onUpdate,
+	}
+}
+
 func (this *Table) SetCharset(charset string) *Table {
 	this.charset = charset
 	return this
 }
 
+// SetCollation sets the default collation of table, such as utf8mb4_bin.
+func (this *Table) SetCollation(collation string) *Table {
+	this.collation = collation
+	return this
+}
+
+// SetEngine sets the storage engine of table, such as InnoDB.
+func (this *Table) SetEngine(engine string) *Table {
+	this.engine = engine
+	return this
+}
+
+// SetComment sets the comment of table.
+func (this *Table) SetComment(comment string) *Table {
+	this.comment = comment
+	return this
+}
+
 func (this *Table) SetName(name string) *Table {
 	this.name = name
 	return this
 }
 
+// SetPrimaryKey sets the primary key columns, which is used for composite primary key,
+// and adds a PRIMARY KEY definition into the create table sql.
+// By default, the primary key is the columns with primary_key tag in the order of fields,
+// or the column declared PRIMARY KEY in column_schema.
+func (this *Table) SetPrimaryKey(columns ...string) *Table {
+	this.primaryKey = columns
+	this.primaryKeySet = true
+	return this
+}
+
+// PrimaryKey returns the primary key columns.
+func (this *Table) PrimaryKey() []string {
+	return this.primaryKey
+}
+
+// AddIndex adds a secondary index of columns.
+func (this *Table) AddIndex(name string, columns ...string) *Table {
+	this.indexes = append(this.indexes, &Index{Name: name, Columns: columns})
+	return this
+}
+
+// AddUniqueIndex adds a unique index of columns.
+func (this *Table) AddUniqueIndex(name string, columns ...string) *Table {
+	this.indexes = append(this.indexes, &Index{Name: name, Columns: columns, Unique: true})
+	return this
+}
+
+// AddForeignKey adds a foreign key constraint.
+func (this *Table) AddForeignKey(foreignKey *ForeignKey) *Table {
+	this.foreignKeys = append(this.foreignKeys, foreignKey)
+	return this
+}
+
+// Index returns the index of name, it returns nil if there is no such index.
+func (this *Table) Index(name string) *Index {
+	for _, index := range this.indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// Indexes returns the secondary and unique indexes.
+func (this *Table) Indexes() []*Index {
+	return this.indexes
+}
+
+// ForeignKeys returns the foreign key constraints.
+func (this *Table) ForeignKeys() []*ForeignKey {
+	return this.foreignKeys
+}
+
+// SetSoftDelete sets the column marks a row deleted, such as deleted_at DATETIME NULL.
+// Repo sets the column to now instead of deleting the row,
+// and only finds the rows whose column is NULL.
+func (this *Table) SetSoftDelete(column string) *Table {
+	this.softDelete = column
+	return this
+}
+
+// Name returns the table name.
+func (this *Table) Name() string {
+	return this.name
+}
+
 func (this *Table) Append(additional string) *Table {
 	this.additional += additional
 	return this
@@ -82,25 +262,91 @@ func (this *Table) getSqlFilename() string {
 }
 
 func (this *Table) getCreateTableSql() string {
-	fields := this.getFieldsSql()
 	sql := ""
 	sql += fmt.Sprintf("DROP TABLE IF EXISTS `%s`;\n", this.name)
-	sql += fmt.Sprintf("CREATE TABLE `%s` (\n", this.name)
-	sql += strings.Join(fields, ",\n")
-	sql += fmt.Sprintf("\n) DEFAULT CHARSET=%s;\n", this.charset)
+	sql += this.getCreateSql(true) + ";\n"
 	sql += fmt.Sprintf("%s\n", this.additional)
 	return sql
 }
 
-func (this *Table) getFieldsSql() []string {
+// getCreateSql returns the CREATE TABLE statement without semicolon,
+// the foreign keys are added later by ALTER TABLE if withForeignKeys is false
+func (this *Table) getCreateSql(withForeignKeys bool) string {
+	sql := fmt.Sprintf("CREATE TABLE `%s` (\n", this.name)
+	sql += strings.Join(this.getFieldsSql(withForeignKeys), ",\n")
+	sql += "\n)"
+	if this.engine != "" {
+		sql += " ENGINE=" + this.engine
+	}
+	sql += " DEFAULT CHARSET=" + this.charset
+	if this.collation != "" {
+		sql += " COLLATE=" + this.collation
+	}
+	if this.comment != "" {
+		sql += " COMMENT=" + quoteString(this.comment)
+	}
+	return sql
+}
+
+func (this *Table) getFieldsSql(withForeignKeys bool) []string {
 	fields := []string{}
 	for _, field := range this.fields {
 		fields = append(fields, fmt.Sprintf("\t`%s` %s", field.name, field.schema))
 	}
+	if this.primaryKeySet && len(this.primaryKey) > 0 {
+		fields = append(fields, "\tPRIMARY KEY "+quoteColumns(this.primaryKey))
+	}
+	for _, index := range this.indexes {
+		fields = append(fields, "\t"+index.definition())
+	}
+	if withForeignKeys {
+		for _, foreignKey := range this.foreignKeys {
+			fields = append(fields, "\t"+this.foreignKeyDefinition(foreignKey))
+		}
+	}
 
 	return fields
 }
 
+// definition returns the index definition used in CREATE TABLE and ALTER TABLE
+func (this *Index) definition() string {
+	if this.Unique {
+		return fmt.Sprintf("UNIQUE KEY `%s` %s", this.Name, quoteColumns(this.Columns))
+	}
+	return fmt.Sprintf("KEY `%s` %s", this.Name, quoteColumns(this.Columns))
+}
+
+// foreignKeyName returns the name of foreign key, or the default name if it is not set
+func (this *Table) foreignKeyName(foreignKey *ForeignKey) string {
+	if foreignKey.Name != "" {
+		return foreignKey.Name
+	}
+	return "fk_" + this.name + "_" + strings.Join(foreignKey.Columns, "_")
+}
+
+// foreignKeyDefinition returns the constraint definition used in CREATE TABLE and ALTER TABLE
+func (this *Table) foreignKeyDefinition(foreignKey *ForeignKey) string {
+	sql := fmt.Sprintf(
+		"CONSTRAINT `%s` FOREIGN KEY %s REFERENCES `%s` %s",
+		this.foreignKeyName(foreignKey),
+		quoteColumns(foreignKey.Columns),
+		foreignKey.RefTable,
+		quoteColumns(foreignKey.RefColumns),
+	)
+	if foreignKey.OnDelete != "" {
+		sql += " ON DELETE " + foreignKey.OnDelete
+	}
+	if foreignKey.OnUpdate != "" {
+		sql += " ON UPDATE " + foreignKey.OnUpdate
+	}
+	return sql
+}
+
+// quoteColumns returns (`a`, `b`)
+func quoteColumns(columns []string) string {
+	return "(`" + strings.Join(columns, "`, `") + "`)"
+}
+
 func (this *Table) bind(data interface{}) []interface{} {
 	ret := []interface{}{}
 	v := reflect.ValueOf(data).Elem()
@@ -169,12 +415,16 @@ func (this *Table) getRetrieveSql(limit, offset int64) string {
 	)
 }
 
+// getColumnName returns the column name of field, which is the column tag,
+// the name in json tag or the field name. It is shared by Table and the row scanner.
 func getColumnName(fieldType reflect.StructField) string {
 	if tag, exist := fieldType.Tag.Lookup("column"); exist && len(tag) > 0 {
 		return tag
 	}
-	if tag, exist := fieldType.Tag.Lookup("json"); exist && len(tag) > 0 {
-		return strings.Split(tag, ",")[0]
+	if tag, exist := fieldType.Tag.Lookup("json"); exist {
+		if name := strings.Split(tag, ",")[0]; len(name) > 0 {
+			return name
+		}
 	}
 	return fieldType.Name
 }
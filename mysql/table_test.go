@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"testing"
+)
+
+type TableOrder struct {
+	ShopId  int64  `json:"shop_id" column_schema:"INT UNSIGNED NOT NULL" primary_key:"" references:"shop(id)" on_delete:"CASCADE"`
+	OrderNo string `json:"order_no" column_schema:"VARCHAR(32) NOT NULL" primary_key:""`
+	UserId  int64  `json:"user_id" column_schema:"INT UNSIGNED NOT NULL" index:"idx_user_time"`
+	Email   string `json:"email" column_schema:"VARCHAR(128) NOT NULL" unique:""`
+	Created string `json:"created_at" column_schema:"DATETIME NOT NULL" index:"idx_user_time,idx_created"`
+}
+
+func TestTableKeys(t *testing.T) {
+	table := NewTable(TableOrder{}).
+		SetCharset("utf8mb4").
+		SetCollation("utf8mb4_bin").
+		SetEngine("InnoDB").
+		SetComment("orders of shop").
+		AddUniqueIndex("uk_shop_email", "shop_id", "email").
+		AddForeignKey(&ForeignKey{
+			Name:       "fk_order_user",
+			Columns:    []string{"user_id"},
+			RefTable:   "user",
+			RefColumns: []string{"id"},
+			OnDelete:   "SET NULL",
+			OnUpdate:   "CASCADE",
+		})
+	if pk := table.PrimaryKey(); len(pk) != 2 || pk[0] != "shop_id" || pk[1] != "order_no" {
+		t.Error("wrong primary key", pk)
+	}
+	expect := "DROP TABLE IF EXISTS `table_order`;\n" +
+		"CREATE TABLE `table_order` (\n" +
+		"\t`shop_id` INT UNSIGNED NOT NULL,\n" +
+		"\t`order_no` VARCHAR(32) NOT NULL,\n" +
+		"\t`user_id` INT UNSIGNED NOT NULL,\n" +
+		"\t`email` VARCHAR(128) NOT NULL,\n" +
+		"\t`created_at` DATETIME NOT NULL,\n" +
+		"\tPRIMARY KEY (`shop_id`, `order_no`),\n" +
+		"\tKEY `idx_user_time` (`user_id`, `created_at`),\n" +
+		"\tUNIQUE KEY `uk_email` (`email`),\n" +
+		"\tKEY `idx_created` (`created_at`),\n" +
+		"\tUNIQUE KEY `uk_shop_email` (`shop_id`, `email`),\n" +
+		"\tCONSTRAINT `fk_table_order_shop_id` FOREIGN KEY (`shop_id`) REFERENCES `shop` (`id`) ON DELETE CASCADE,\n" +
+		"\tCONSTRAINT `fk_order_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE SET NULL ON UPDATE CASCADE\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='orders of shop';\n\n"
+	if sql := table.getCreateTableSql(); sql != expect {
+		t.Errorf("create table sql should be\n%s\nbut\n%s", expect, sql)
+	}
+}
+
+func TestRepoFindByUnique(t *testing.T) {
+	conn := &recordConnector{}
+	repo := NewRepo[TableOrder](conn, nil)
+	repo.FindByUnique("uk_email", "a@b.c")
+	conn.assert(t, "SELECT `shop_id`, `order_no`, `user_id`, `email`, `created_at` FROM `table_order` WHERE `email` = ? LIMIT 1", "a@b.c")
+	if _, err := repo.FindByUnique("idx_created", "2020-01-01"); err != UNIQUE_KEY_INVALID {
+		t.Error("should be invalid on non unique index", err)
+	}
+
+	repo.Upsert(&TableOrder{ShopId: 1, OrderNo: "a", UserId: 2, Email: "a@b.c"})
+	conn.assert(t, "INSERT INTO `table_order` (`shop_id`, `order_no`, `user_id`, `email`, `created_at`) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `user_id` = VALUES(`user_id`), `created_at` = VALUES(`created_at`)", int64(1), "a", int64(2), "a@b.c", "")
+}
@@ -0,0 +1,184 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// TxOption is the option of a transaction started by WithTxOption
+type TxOption struct {
+	// Isolation is the isolation level, the default is the level of database,
+	// which is ignored by nested transactions
+	Isolation sql.IsolationLevel
+	// ReadOnly starts a read only transaction, which is ignored by nested transactions
+	ReadOnly bool
+	// Retry is the retry policy, the default is DEFAULT_RETRY_POLICY
+	Retry *RetryPolicy
+}
+
+// RetryPolicy decides whether to run a transaction again after it fails
+type RetryPolicy struct {
+	// MaxRetries is the max count of retries, 0 means no retry
+	MaxRetries int
+	// Backoff is the wait time before the first retry, which is doubled for every retry
+	Backoff time.Duration
+	// Retryable returns whether the error can be retried, the default is IsDeadlock
+	Retryable func(err error) bool
+}
+
+// DEFAULT_RETRY_POLICY retries a transaction 3 times on deadlock
+var DEFAULT_RETRY_POLICY = &RetryPolicy{
+	MaxRetries: 3,
+	Backoff:    10 * time.Millisecond,
+	Retryable:  IsDeadlock,
+}
+
+// TxBeginner is implemented by connectors which can start a transaction with option, such as db
+type TxBeginner interface {
+	BeginTx(option *TxOption) (Connector, error)
+}
+
+// IsDeadlock returns whether err is a deadlock error (1213),
+// the whole transaction has been rolled back by server and can be run again.
+func IsDeadlock(err error) bool {
+	if mysqlErr, ok := err.(*driver.MySQLError); ok {
+		return mysqlErr.Number == 1213
+	}
+	return false
+}
+
+// WithTx runs fn in a transaction, see WithTxOption.
+//
+//	err := mysql.WithTx(conn, func(tx mysql.Connector) error {
+//		if _, err := tx.Execute("UPDATE account SET balance = balance - ? WHERE id = ?", 10, 1); err != nil {
+//			return err
+//		}
+//		_, err := tx.Execute("UPDATE account SET balance = balance + ? WHERE id = ?", 10, 2)
+//		return err
+//	})
+func WithTx(conn Connector, fn func(tx Connector) error) error {
+	return WithTxOption(conn, nil, fn)
+}
+
+// WithTxOption runs fn in a transaction, which is committed if fn returns nil,
+// and is rolled back if fn returns an error or panics, the panic is raised again after rollback.
+//
+// If conn is already a transaction, fn runs in a savepoint,
+// which is released on success and rolled back to on error,
+// the outer transaction is not affected.
+//
+// If the transaction fails with a retryable error, such as deadlock,
+// it is run again by option.Retry, so fn should have no side effect out of the transaction.
+// Nested transactions are not retried, since the outer one is rolled back by server.
+func WithTxOption(conn Connector, option *TxOption, fn func(tx Connector) error) error {
+	if option == nil {
+		option = &TxOption{}
+	}
+	retry := option.Retry
+	if retry == nil {
+		retry = DEFAULT_RETRY_POLICY
+	}
+	retryable := retry.Retryable
+	if retryable == nil {
+		retryable = IsDeadlock
+	}
+	_, nested := conn.(*tx)
+	if _, ok := conn.(*savepoint); ok {
+		nested = true
+	}
+	backoff := retry.Backoff
+	for attempt := 0; ; attempt++ {
+		err := runTx(conn, option, fn)
+		if err == nil || nested || attempt >= retry.MaxRetries || !retryable(err) {
+			return err
+		}
+		log.Warn("retry transaction", attempt+1, "on", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func runTx(conn Connector, option *TxOption, fn func(tx Connector) error) error {
+	var tx Connector
+	var err error
+	if beginner, ok := conn.(TxBeginner); ok {
+		tx, err = beginner.BeginTx(option)
+	} else {
+		tx, err = conn.Begin()
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// BeginTx starts a transaction with option, option.Retry is ignored.
+func (this *db) BeginTx(option *TxOption) (Connector, error) {
+	if option == nil {
+		option = &TxOption{}
+	}
+	name := this.name + "-" + token()
+	log.Debug(this.name, "begin", name, option.Isolation, option.ReadOnly)
+	conn, err := this.conn.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: option.Isolation,
+		ReadOnly:  option.ReadOnly,
+	})
+	if err != nil {
+		log.Error(this.name, "begin", err)
+		return nil, err
+	}
+	return this.newTx(name, conn), nil
+}
+
+// savepoint is a nested transaction in tx
+type savepoint struct {
+	*tx
+	point string
+}
+
+// Begin creates a savepoint in the transaction, which is a nested transaction.
+// The savepoint is committed by RELEASE SAVEPOINT, and rolled back by ROLLBACK TO SAVEPOINT.
+func (this *tx) Begin() (Connector, error) {
+	this.savepoints++
+	point := fmt.Sprintf("kelp_sp_%d", this.savepoints)
+	log.Debug(this.name, "savepoint", point)
+	if _, err := this.conn.Exec("SAVEPOINT " + point); err != nil {
+		log.Error(this.name, "savepoint", err)
+		return nil, err
+	}
+	return &savepoint{tx: this, point: point}, nil
+}
+
+// Commit releases the savepoint, the changes are committed with the outer transaction.
+func (this *savepoint) Commit() error {
+	log.Debug(this.name, "release savepoint", this.point)
+	if _, err := this.conn.Exec("RELEASE SAVEPOINT " + this.point); err != nil {
+		log.Error(this.name, "release savepoint", err)
+		return err
+	}
+	return nil
+}
+
+// Rollback rolls back the changes after the savepoint.
+func (this *savepoint) Rollback() error {
+	log.Debug(this.name, "rollback to savepoint", this.point)
+	if _, err := this.conn.Exec("ROLLBACK TO SAVEPOINT " + this.point); err != nil {
+		log.Error(this.name, "rollback to savepoint", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+func TestWithTx(t *testing.T) {
+	d := &countDriver{}
+	sql.Register("kelp_tx", d)
+	conn, _ := sql.Open("kelp_tx", "")
+	testDB := &db{name: "test", conn: conn, stmts: newStmtCache(DEFAULT_STMT_CACHE_SIZE)}
+
+	fail := errors.New("fail")
+	err := WithTxOption(testDB, &TxOption{Isolation: sql.LevelSerializable, ReadOnly: true}, func(tx Connector) error {
+		tx.Execute("UPDATE a")
+		// nested transaction fails and rolls back to savepoint
+		if err := WithTx(tx, func(tx Connector) error {
+			tx.Execute("UPDATE b")
+			return fail
+		}); err != fail {
+			t.Error("nested transaction should return error", err)
+		}
+		return WithTx(tx, func(tx Connector) error {
+			_, err := tx.Execute("UPDATE c")
+			return err
+		})
+	})
+	if err != nil || d.committed != 1 || d.rolledBack != 0 {
+		t.Error("transaction should be committed", err, d.committed, d.rolledBack)
+	}
+	if d.txOptions.Isolation != driver.IsolationLevel(sql.LevelSerializable) || !d.txOptions.ReadOnly {
+		t.Error("wrong transaction options", d.txOptions)
+	}
+	expect := []string{
+		"UPDATE a",
+		"SAVEPOINT kelp_sp_1", "UPDATE b", "ROLLBACK TO SAVEPOINT kelp_sp_1",
+		"SAVEPOINT kelp_sp_2", "UPDATE c", "RELEASE SAVEPOINT kelp_sp_2",
+	}
+	if !reflect.DeepEqual(d.queries, expect) {
+		t.Error("wrong queries", d.queries)
+	}
+
+	// panic rolls back
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Error("panic should be raised again", r)
+			}
+		}()
+		WithTx(testDB, func(tx Connector) error {
+			panic("boom")
+		})
+	}()
+	if d.rolledBack != 1 {
+		t.Error("panic should roll back", d.rolledBack)
+	}
+
+	// retry on deadlock
+	attempts := 0
+	deadlock := &mysqlDriver.MySQLError{Number: 1213, Message: "Deadlock found"}
+	err = WithTxOption(testDB, &TxOption{Retry: &RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}}, func(tx Connector) error {
+		attempts++
+		return deadlock
+	})
+	if err != deadlock || attempts != 3 || d.rolledBack != 4 {
+		t.Error("deadlock should be retried", err, attempts, d.rolledBack)
+	}
+	attempts = 0
+	WithTx(testDB, func(tx Connector) error {
+		attempts++
+		return fail
+	})
+	if attempts != 1 {
+		t.Error("other errors should not be retried", attempts)
+	}
+}
@@ -0,0 +1,54 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Translator 翻译函数，用于生成可读的校验说明
+// key是消息id，例如doc.required，args替换消息中的{0}，{1}...
+type Translator func(key string, args ...string) string
+
+// Describe 将字段的valid，valid_elem和valid_key tag转换成可读的校验说明，用于生成文档
+// 使用的消息id是doc.<rule>，doc.elem和doc.key是元素和key的前缀
+func Describe(fieldType reflect.StructField, tr Translator) string {
+	ret := []string{}
+	for _, item := range []struct {
+		tag    string
+		prefix string
+		t      func() reflect.Type
+	}{
+		{"valid", "", func() reflect.Type { return fieldType.Type }},
+		{"valid_elem", tr("doc.elem"), func() reflect.Type {
+			if t := derefType(fieldType.Type); t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+				return t.Elem()
+			}
+			return fieldType.Type
+		}},
+		{"valid_key", tr("doc.key"), func() reflect.Type {
+			if t := derefType(fieldType.Type); t.Kind() == reflect.Map {
+				return t.Key()
+			}
+			return fieldType.Type
+		}},
+	} {
+		tag, exist := fieldType.Tag.Lookup(item.tag)
+		if !exist {
+			continue
+		}
+		if ruleGroup, err := validParse(tag); err != nil {
+			// tag定义有问题，就直接输出
+			ret = append(ret, item.prefix+tag)
+		} else {
+			ret = append(ret, item.prefix+ruleGroup.describe(item.t(), tr))
+		}
+	}
+	return strings.Join(ret, "; ")
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
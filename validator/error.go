@@ -0,0 +1,57 @@
+package validator
+
+import (
+	"strings"
+)
+
+// ValidError 一个字段的校验错误
+type ValidError struct {
+	// Path 字段的json pointer路径，例如：/list/0/name
+	Path string `json:"path"`
+	// Rule 未通过的规则：required, regexp, range, func, type
+	Rule string `json:"rule"`
+	// Params 规则的参数，例如正则表达式，范围，函数名
+	Params []string `json:"params"`
+	// Message valid tag中定义的message，如果没有定义则是默认的提示信息
+	Message string `json:"message"`
+
+	// field 字段名，用于翻译默认的提示信息
+	field string
+	// custom 是否是valid tag中定义的message
+	custom bool
+}
+
+func (this *ValidError) Error() string {
+	return this.Message
+}
+
+// Field 返回字段名，用于翻译默认的提示信息
+func (this *ValidError) Field() string {
+	return this.field
+}
+
+// Custom 返回Message是否是valid tag中定义的message
+// 如果是，翻译时应该把Message作为消息id
+func (this *ValidError) Custom() bool {
+	return this.custom
+}
+
+// ValidErrors 收集到的所有字段的校验错误
+// 通过ValidAll或者BindAndValidJsonAll得到
+type ValidErrors []*ValidError
+
+func (this ValidErrors) Error() string {
+	messages := []string{}
+	for _, err := range this {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// jsonPointer 在json pointer后面拼接一级路径
+// 其中~和/需要转义
+func jsonPointer(path, key string) string {
+	key = strings.Replace(key, "~", "~0", -1)
+	key = strings.Replace(key, "/", "~1", -1)
+	return path + "/" + key
+}
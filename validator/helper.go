@@ -1,4 +1,4 @@
-package http
+package validator
 
 import (
 	"encoding/json"
@@ -9,8 +9,10 @@ import (
 // ValidRegWrapper 正则表达式校验包装器
 // 当正则表达式中含有reflect tag中不允许的字符时，可以使用本方法生成一个校验函数
 // 例如：
-//  http.RegisterValidFunc("date", http.ValidRegexpWrapper(`^\d{4}-\d{2}-\d{2} \d{2}\:\d{2}\:\d{2}$`))
+//
+//	validator.RegisterValidFunc("date", validator.ValidRegexpWrapper(`^\d{4}-\d{2}-\d{2} \d{2}\:\d{2}\:\d{2}$`))
 func ValidRegexpWrapper(reg string) ValidFunc {
+	compiled := regexp.MustCompile(reg)
 	return func(
 		fieldType reflect.StructField,
 		destSource []byte,
@@ -23,6 +25,6 @@ func ValidRegexpWrapper(reg string) ValidFunc {
 		if val > 2 && str[0] == '"' && str[val-1] == '"' {
 			str = str[1 : val-1]
 		}
-		return regexp.MustCompile(reg).MatchString(str)
+		return compiled.MatchString(str)
 	}
 }
@@ -0,0 +1,243 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+var (
+	// validPlanCache 缓存每个struct类型编译后的校验计划，key是reflect.Type
+	validPlanCache = new(sync.Map)
+	// registeredRules 通过RegisterRules注册的规则，key是reflect.Type，value是map[string]*FieldRule
+	registeredRules = new(sync.Map)
+)
+
+// FieldRule 一个字段的校验规则，写法与valid，valid_elem和valid_key tag相同
+type FieldRule struct {
+	Valid string
+	Elem  string
+	Key   string
+}
+
+// RegisterRules 为dest的类型注册校验规则，key是字段的json名
+// 用于无法修改tag的类型，例如protoc生成的message
+// 注册的规则会替换字段上的valid，valid_elem和valid_key tag
+// 重复注册会替换之前注册的规则，规则有问题时返回错误
+func RegisterRules(dest interface{}, rules map[string]*FieldRule) error {
+	t := derefType(reflect.TypeOf(dest))
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("dest should be a struct but %s", t.Kind())
+	}
+	for name, rule := range rules {
+		if _, exist := findFieldByName(t, name); !exist {
+			return fmt.Errorf("field %s not found in %s", name, t)
+		}
+		for _, tag := range []string{rule.Valid, rule.Elem, rule.Key} {
+			if tag == "" {
+				continue
+			}
+			if _, err := validParse(tag); err != nil {
+				return err
+			}
+		}
+	}
+	registeredRules.Store(t, rules)
+	// 已经编译的校验计划可能引用了这个类型，全部重新编译
+	validPlanCache.Range(func(key, value interface{}) bool {
+		validPlanCache.Delete(key)
+		return true
+	})
+	return nil
+}
+
+// withRegisteredRules 如果字段注册了规则，返回使用注册规则作为tag的字段
+func withRegisteredRules(t reflect.Type, fieldType reflect.StructField) reflect.StructField {
+	rules, exist := registeredRules.Load(t)
+	if !exist {
+		return fieldType
+	}
+	rule, exist := rules.(map[string]*FieldRule)[getFieldName(fieldType)]
+	if !exist {
+		return fieldType
+	}
+	tag := ""
+	if jsonTag, exist := fieldType.Tag.Lookup("json"); exist {
+		tag += "json:" + strconv.Quote(jsonTag)
+	}
+	for _, item := range []struct{ name, value string }{
+		{"valid", rule.Valid},
+		{"valid_elem", rule.Elem},
+		{"valid_key", rule.Key},
+	} {
+		if item.value != "" {
+			tag += " " + item.name + ":" + strconv.Quote(item.value)
+		}
+	}
+	fieldType.Tag = reflect.StructTag(tag)
+	return fieldType
+}
+
+// validPlan struct类型编译后的校验计划
+// 编译完成后不会被修改，可以被并发使用
+type validPlan struct {
+	fields []*validFieldPlan
+}
+
+// validFieldPlan 一个字段的校验计划
+type validFieldPlan struct {
+	name      string
+	fieldType reflect.StructField
+	// rules 字段的valid tag，没有定义时为nil
+	rules *validRuleGroup
+	// node 字段内部的校验计划，内部不需要校验时为nil
+	node *validNode
+}
+
+// validNode 一个值内部的校验计划
+type validNode struct {
+	// kind 是Ptr，Struct，Slice或者Map，其中array也是Slice
+	kind reflect.Kind
+	// plan kind为Struct时的校验计划
+	plan *validPlan
+
+	// elem kind为Ptr时指向的值，kind为Slice或Map时元素内部的校验计划
+	elem *validNode
+	// elemType 元素的类型，用于传给rule和ValidFunc
+	elemType  reflect.StructField
+	elemRules *validRuleGroup
+	keyType   reflect.StructField
+	keyRules  *validRuleGroup
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// getValidPlan 获取struct类型的校验计划，如果没有就编译
+func getValidPlan(t reflect.Type) (*validPlan, error) {
+	if plan, exist := validPlanCache.Load(t); exist {
+		return plan.(*validPlan), nil
+	}
+	plan, err := buildValidPlan(t, map[reflect.Type]*validPlan{})
+	if err != nil {
+		return nil, err
+	}
+	// 并发编译时，使用先存进去的那个
+	actual, _ := validPlanCache.LoadOrStore(t, plan)
+	return actual.(*validPlan), nil
+}
+
+// buildValidPlan 编译struct类型的校验计划
+// building记录正在编译的类型，用于处理递归定义的类型
+func buildValidPlan(t reflect.Type, building map[reflect.Type]*validPlan) (*validPlan, error) {
+	if plan, exist := building[t]; exist {
+		return plan, nil
+	}
+	plan := &validPlan{fields: []*validFieldPlan{}}
+	building[t] = plan
+	for i := 0; i < t.NumField(); i++ {
+		fieldType := t.Field(i)
+		// 没有导出的字段和json:"-"的字段不会被绑定
+		if (fieldType.PkgPath != "" && !fieldType.Anonymous) || fieldType.Tag.Get("json") == "-" {
+			continue
+		}
+		fieldType = withRegisteredRules(t, fieldType)
+		field := &validFieldPlan{
+			name:      getFieldName(fieldType),
+			fieldType: fieldType,
+		}
+		if fieldTags, exist := fieldType.Tag.Lookup("valid"); exist {
+			rules, err := validParse(fieldTags)
+			if err != nil {
+				// 这里要出错，说明定义valid tag的有问题
+				return nil, err
+			}
+			field.rules = rules
+		}
+		node, err := buildValidNode(fieldType, true, building)
+		if err != nil {
+			return nil, err
+		}
+		field.node = node
+		if field.rules != nil || field.node != nil {
+			plan.fields = append(plan.fields, field)
+		}
+	}
+	return plan, nil
+}
+
+// buildValidNode 编译字段内部的校验计划
+// 元素使用valid_elem tag校验，map的key使用valid_key tag校验，withTags为false时忽略这些tag
+// 内部不需要校验时返回nil
+func buildValidNode(
+	fieldType reflect.StructField,
+	withTags bool,
+	building map[reflect.Type]*validPlan,
+) (*validNode, error) {
+	t := fieldType.Type
+	// 实现了json.Unmarshaler的类型，例如time.Time，不需要递归
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil, nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := buildValidNode(withFieldType(fieldType, t.Elem()), withTags, building)
+		if err != nil || elem == nil {
+			return nil, err
+		}
+		return &validNode{kind: reflect.Ptr, elem: elem}, nil
+	case reflect.Struct:
+		plan, err := buildValidPlan(t, building)
+		if err != nil {
+			return nil, err
+		}
+		return &validNode{kind: reflect.Struct, plan: plan}, nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		// []byte在json中是base64字符串
+		if t.Kind() != reflect.Map && t.Elem().Kind() == reflect.Uint8 {
+			return nil, nil
+		}
+		node := &validNode{
+			kind:     reflect.Slice,
+			elemType: withFieldType(fieldType, t.Elem()),
+		}
+		if t.Kind() == reflect.Map {
+			node.kind = reflect.Map
+			node.keyType = withFieldType(fieldType, t.Key())
+		}
+		if withTags {
+			if tags, exist := fieldType.Tag.Lookup("valid_elem"); exist {
+				rules, err := validParse(tags)
+				if err != nil {
+					return nil, err
+				}
+				node.elemRules = rules
+			}
+			if tags, exist := fieldType.Tag.Lookup("valid_key"); exist && node.kind == reflect.Map {
+				rules, err := validParse(tags)
+				if err != nil {
+					return nil, err
+				}
+				node.keyRules = rules
+			}
+		}
+		elem, err := buildValidNode(node.elemType, false, building)
+		if err != nil {
+			return nil, err
+		}
+		node.elem = elem
+		if node.elem == nil && node.elemRules == nil && node.keyRules == nil {
+			return nil, nil
+		}
+		return node, nil
+	}
+	return nil, nil
+}
+
+// withFieldType 复制字段，并替换类型
+// 用于校验元素的时候，把元素类型传给rule和ValidFunc
+func withFieldType(fieldType reflect.StructField, t reflect.Type) reflect.StructField {
+	fieldType.Type = t
+	return fieldType
+}
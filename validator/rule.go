@@ -0,0 +1,336 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内置的日期格式
+const (
+	_DATE_LAYOUT     = "2006-01-02"
+	_DATETIME_LAYOUT = "2006-01-02 15:04:05"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// newBuiltinRule 根据名字和参数创建内置的rule
+// 例如：in:a|b|c，email，date:2006-01-02，eqfield:password
+// 如果不是内置的rule，返回nil
+func newBuiltinRule(name, param string) (rule, error) {
+	switch name {
+	case "in":
+		if param == "" {
+			return nil, fmt.Errorf("rule in needs values")
+		}
+		return &inRule{strings.Split(param, "|")}, nil
+	case "email":
+		return &formatRule{name, func(str string) bool {
+			addr, err := mail.ParseAddress(str)
+			return err == nil && addr.Address == str
+		}}, nil
+	case "url":
+		return &formatRule{name, func(str string) bool {
+			u, err := url.ParseRequestURI(str)
+			return err == nil && u.Scheme != "" && u.Host != ""
+		}}, nil
+	case "ip":
+		return &formatRule{name, func(str string) bool {
+			return net.ParseIP(str) != nil
+		}}, nil
+	case "ipv4":
+		return &formatRule{name, func(str string) bool {
+			ip := net.ParseIP(str)
+			return ip != nil && ip.To4() != nil && !strings.Contains(str, ":")
+		}}, nil
+	case "ipv6":
+		return &formatRule{name, func(str string) bool {
+			return net.ParseIP(str) != nil && strings.Contains(str, ":")
+		}}, nil
+	case "cidr":
+		return &formatRule{name, func(str string) bool {
+			_, _, err := net.ParseCIDR(str)
+			return err == nil
+		}}, nil
+	case "uuid":
+		return &formatRule{name, uuidRegexp.MatchString}, nil
+	case "date":
+		if param == "" {
+			param = _DATE_LAYOUT
+		}
+		return &dateRule{param}, nil
+	case "datetime":
+		return &dateRule{_DATETIME_LAYOUT}, nil
+	case "uint":
+		return &uintRule{}, nil
+	case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+		if param == "" {
+			return nil, fmt.Errorf("rule %s needs a field", name)
+		}
+		return &fieldRule{name, param}, nil
+	}
+	return nil, nil
+}
+
+// sourceString 返回json字符串的值
+// 如果不是字符串，返回false
+func sourceString(destSource []byte) (string, bool) {
+	if len(destSource) < 2 || destSource[0] != '"' {
+		return "", false
+	}
+	str := ""
+	if err := json.Unmarshal(destSource, &str); err != nil {
+		return "", false
+	}
+	return str, true
+}
+
+// sourceValue 返回json值的字符串形式，字符串会去掉引号
+func sourceValue(destSource []byte) string {
+	if str, ok := sourceString(destSource); ok {
+		return str
+	}
+	return string(destSource)
+}
+
+// inRule 枚举，值必须是其中之一
+type inRule struct {
+	values []string
+}
+
+func (this *inRule) value() string {
+	return strings.Join(this.values, "|")
+}
+
+func (this *inRule) name() string {
+	return "in"
+}
+
+func (this *inRule) params() []string {
+	return this.values
+}
+
+func (this *inRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc.in", strings.Join(this.values, "|"))
+}
+
+func (this *inRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	val := sourceValue(destSource)
+	for _, v := range this.values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRule 字符串格式，例如email，url，ip
+type formatRule struct {
+	format string
+	check  func(str string) bool
+}
+
+func (this *formatRule) value() string {
+	return this.format
+}
+
+func (this *formatRule) name() string {
+	return this.format
+}
+
+func (this *formatRule) params() []string {
+	return []string{}
+}
+
+func (this *formatRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc." + this.format)
+}
+
+func (this *formatRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	str, ok := sourceString(destSource)
+	return ok && this.check(str)
+}
+
+// dateRule 日期时间，使用time包的layout
+type dateRule struct {
+	layout string
+}
+
+func (this *dateRule) value() string {
+	return this.layout
+}
+
+func (this *dateRule) name() string {
+	return "date"
+}
+
+func (this *dateRule) params() []string {
+	return []string{this.layout}
+}
+
+func (this *dateRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc.date", this.layout)
+}
+
+func (this *dateRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	str, ok := sourceString(destSource)
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(this.layout, str)
+	return err == nil
+}
+
+// uintRule 非负整数
+type uintRule struct{}
+
+func (this *uintRule) value() string {
+	return "uint"
+}
+
+func (this *uintRule) name() string {
+	return "uint"
+}
+
+func (this *uintRule) params() []string {
+	return []string{}
+}
+
+func (this *uintRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc.uint")
+}
+
+func (this *uintRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	_, err := strconv.ParseUint(string(destSource), 10, 64)
+	return err == nil
+}
+
+// fieldRule 与同级字段比较
+// 数字按照大小比较，字符串按照字典序比较
+type fieldRule struct {
+	op    string
+	field string
+}
+
+func (this *fieldRule) value() string {
+	return this.op + ":" + this.field
+}
+
+func (this *fieldRule) name() string {
+	return this.op
+}
+
+func (this *fieldRule) params() []string {
+	return []string{this.field}
+}
+
+func (this *fieldRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc."+this.op, this.field)
+}
+
+func (this *fieldRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	other, exist := parentSource[this.field]
+	if !exist {
+		return false
+	}
+	switch this.op {
+	case "eqfield":
+		return jsonEqual(destSource, other)
+	case "nefield":
+		return !jsonEqual(destSource, other)
+	}
+	c, ok := compareJson(destSource, other)
+	if !ok {
+		return false
+	}
+	switch this.op {
+	case "gtfield":
+		return c > 0
+	case "gtefield":
+		return c >= 0
+	case "ltfield":
+		return c < 0
+	default:
+		return c <= 0
+	}
+}
+
+func jsonEqual(a, b []byte) bool {
+	bufA, bufB := &bytes.Buffer{}, &bytes.Buffer{}
+	if json.Compact(bufA, a) != nil || json.Compact(bufB, b) != nil {
+		return false
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
+// compareJson 比较两个json值，只能比较两个数字或者两个字符串
+func compareJson(a, b []byte) (int, bool) {
+	if strA, ok := sourceString(a); ok {
+		strB, ok := sourceString(b)
+		return strings.Compare(strA, strB), ok
+	}
+	numA, err := strconv.ParseFloat(string(a), 64)
+	if err != nil {
+		return 0, false
+	}
+	numB, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case numA < numB:
+		return -1, true
+	case numA > numB:
+		return 1, true
+	}
+	return 0, true
+}
+
+// requiredIf 当同级字段等于某个值时，字段必填
+type requiredIf struct {
+	field string
+	value string
+}
+
+func (this *requiredIf) match(parentSource map[string]json.RawMessage) bool {
+	other, exist := parentSource[this.field]
+	return exist && sourceValue(other) == this.value
+}
@@ -0,0 +1,865 @@
+// Package validator 根据valid tag校验json数据
+// http和grpc使用同一套校验规则，规则的写法参考http/doc/validator.md
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidFunc 校验函数类型
+// valid tag中使用的函数必须是这个类型的
+type ValidFunc func(
+	fieldType reflect.StructField,
+	destSource []byte,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool
+
+var (
+	funcMap    = map[string]ValidFunc{}
+	funcMapMux = new(sync.RWMutex)
+	// validRuleCache 缓存解析后的valid tag，key是tag，value是*validRuleGroup
+	validRuleCache = new(sync.Map)
+)
+
+// RegisterValidFunc 注册一个校验函数
+// 只有注册后的函数才能够在valid tag中使用
+// 如果使用了没有注册的函数，则该校验始终返回false
+// 可以在运行时注册或者替换校验函数，并发安全
+func RegisterValidFunc(key string, f ValidFunc) {
+	funcMapMux.Lock()
+	defer funcMapMux.Unlock()
+	funcMap[key] = f
+}
+
+func getValidFunc(key string) (ValidFunc, bool) {
+	funcMapMux.RLock()
+	defer funcMapMux.RUnlock()
+	f, exist := funcMap[key]
+	return f, exist
+}
+
+// Valid 校验一个json source是否满足目标dest struct中声明的valid tag要求
+// 遇到第一个校验不通过的字段就返回，返回的错误是*ValidError
+func Valid(dest interface{}, source []byte) error {
+	return validSource(dest, source, false)
+}
+
+// ValidAll 与Valid相同，但是会校验所有字段
+// 如果有校验不通过的字段，返回的错误是ValidErrors，包含了所有校验不通过的字段
+func ValidAll(dest interface{}, source []byte) error {
+	return validSource(dest, source, true)
+}
+
+func validSource(dest interface{}, source []byte, all bool) error {
+	// 获取目标类型
+	rootType := reflect.TypeOf(dest)
+	// 如果该类型不是指针，就直接返回错误
+	// 因为不是指针的实体无法被绑定数据
+	if rootType.Kind() != reflect.Ptr {
+		return fmt.Errorf("[this is a system error should be fixed by developer] dest should be a ptr but %s", rootType.Kind())
+	}
+	// 只有struct才有valid tag
+	if rootType.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	// 获取目标实体的校验计划，每个类型只编译一次
+	plan, err := getValidPlan(rootType.Elem())
+	if err != nil {
+		return err
+	}
+	// 获取目标实体
+	rootValue := reflect.ValueOf(dest).Elem()
+
+	// 将source绑定到map上
+	sourceValue := map[string]json.RawMessage{}
+	if err := json.Unmarshal(source, &sourceValue); err != nil {
+		return err
+	}
+	state := &validState{
+		root:       rootValue,
+		rootSource: sourceValue,
+		all:        all,
+	}
+	if err := state.valid(plan, sourceValue, ""); err != nil {
+		return err
+	}
+	if len(state.errs) > 0 {
+		return state.errs
+	}
+	return nil
+}
+
+// validState 一次校验过程中的状态
+type validState struct {
+	root       reflect.Value
+	rootSource map[string]json.RawMessage
+	// all 是否收集所有错误，否则在第一个错误时返回
+	all  bool
+	errs ValidErrors
+}
+
+// fail 记录一个校验错误
+// 如果不需要收集所有错误，就返回这个错误，用来中止校验
+func (this *validState) fail(err *ValidError) error {
+	if !this.all {
+		return err
+	}
+	this.errs = append(this.errs, err)
+	return nil
+}
+
+// valid 按照plan校验struct的所有字段，path是struct的json pointer
+// 返回的error不为nil时，表示需要中止校验
+func (this *validState) valid(
+	plan *validPlan,
+	destSource map[string]json.RawMessage,
+	path string,
+) error {
+	for _, field := range plan.fields {
+		fieldPath := jsonPointer(path, field.name)
+		source, exist := destSource[field.name]
+		if field.rules != nil {
+			// 如果有校验标记，则进行校验
+			if err := this.validValue(field.fieldType, field.rules, field.name, source, exist, destSource, fieldPath); err != nil {
+				return err
+			}
+		}
+		if field.node == nil {
+			continue
+		}
+		if !exist {
+			// 如果目标数据不存在这个struct，就把nil继续传递下去
+			// 这样struct内部的必选字段都会校验不通过
+			source = json.RawMessage("null")
+		}
+		// 继续递归，因为字段内部可能还有valid
+		if err := this.validNode(field.node, field.name, source, destSource, fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validNode 校验字段内部的元素，包括：
+// struct的字段，指针指向的struct，slice和array的元素，map的key和value
+// parentSource是字段所在对象的数据，元素的同级字段就是集合的同级字段
+func (this *validState) validNode(
+	node *validNode,
+	fieldName string,
+	source json.RawMessage,
+	parentSource map[string]json.RawMessage,
+	path string,
+) error {
+	isNull := string(source) == "null"
+	switch node.kind {
+	case reflect.Ptr:
+		// 指针可以为null，此时不再校验内部
+		if isNull {
+			return nil
+		}
+		return this.validNode(node.elem, fieldName, source, parentSource, path)
+	case reflect.Struct:
+		var src map[string]json.RawMessage
+		if !isNull {
+			// 这里因为确定这层必须是struct，所以把source再转成map
+			// 如果在转换的时候出错，说明数据类型对不上，报错
+			if err := json.Unmarshal(source, &src); err != nil {
+				return err
+			}
+		}
+		return this.valid(node.plan, src, path)
+	case reflect.Slice:
+		if isNull {
+			return nil
+		}
+		elems := []json.RawMessage{}
+		if err := json.Unmarshal(source, &elems); err != nil {
+			return err
+		}
+		for i, elem := range elems {
+			elemName := fmt.Sprintf("%s[%d]", fieldName, i)
+			elemPath := jsonPointer(path, strconv.Itoa(i))
+			if err := this.validElem(node, elemName, elem, parentSource, elemPath); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if isNull {
+			return nil
+		}
+		elems := map[string]json.RawMessage{}
+		if err := json.Unmarshal(source, &elems); err != nil {
+			return err
+		}
+		keys := []string{}
+		for key := range elems {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			elemName := fmt.Sprintf("%s[%s]", fieldName, key)
+			elemPath := jsonPointer(path, key)
+			if node.keyRules != nil {
+				// json中的key都是字符串，如果key不是string类型，就用原始值校验
+				keySource, _ := json.Marshal(key)
+				if node.keyType.Type.Kind() != reflect.String {
+					keySource = []byte(key)
+				}
+				if err := this.validValue(node.keyType, node.keyRules, elemName, keySource, true, parentSource, elemPath); err != nil {
+					return err
+				}
+			}
+			if err := this.validElem(node, elemName, elems[key], parentSource, elemPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validElem 校验集合中的一个元素，并继续递归
+// 元素是null时，视为不存在
+func (this *validState) validElem(
+	node *validNode,
+	elemName string,
+	source json.RawMessage,
+	parentSource map[string]json.RawMessage,
+	path string,
+) error {
+	if node.elemRules != nil {
+		if err := this.validValue(node.elemType, node.elemRules, elemName, source, string(source) != "null", parentSource, path); err != nil {
+			return err
+		}
+	}
+	if node.elem == nil {
+		return nil
+	}
+	return this.validNode(node.elem, elemName, source, parentSource, path)
+}
+
+func getFieldName(fieldType reflect.StructField) string {
+	if jsonTag, exist := fieldType.Tag.Lookup("json"); exist {
+		if name := strings.Split(jsonTag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return fieldType.Name
+}
+
+// validValue 使用rules校验一个值，exist表示这个值是否存在
+func (this *validState) validValue(
+	fieldType reflect.StructField,
+	ruleGroup *validRuleGroup,
+	fieldName string,
+	source json.RawMessage,
+	exist bool,
+	parentSource map[string]json.RawMessage,
+	path string,
+) error {
+	// 先看值是否存在，如果没有，就可以根据optional标记直接返回了
+	if !exist {
+		if !ruleGroup.required(parentSource) {
+			return nil
+		}
+		return this.fail(ruleGroup.err(fieldName, path, nil))
+	}
+	// 再看是否满足其他要求，将所有rule都过一遍即可
+	// 每个字段只记录第一个未通过的rule
+	for _, rule := range ruleGroup.rules {
+		if !rule.valid(fieldType, source, parentSource, this.root, this.rootSource) {
+			return this.fail(ruleGroup.err(fieldName, path, rule))
+		}
+	}
+	return nil
+}
+
+type validRuleGroup struct {
+	rules    []rule
+	optional bool
+	message  string
+	// requiredIf 如果定义了required_if，字段只在条件满足时必填
+	requiredIf *requiredIf
+}
+
+// required 返回字段是否必填
+func (this *validRuleGroup) required(parentSource map[string]json.RawMessage) bool {
+	if this.requiredIf != nil {
+		return this.requiredIf.match(parentSource)
+	}
+	return !this.optional
+}
+
+// err 生成校验错误，rule为nil表示字段不存在
+func (this *validRuleGroup) err(fieldName, path string, failRule rule) *ValidError {
+	ret := &ValidError{
+		Path:    path,
+		Rule:    "required",
+		Params:  []string{},
+		Message: this.message,
+		field:   fieldName,
+		custom:  this.message != "",
+	}
+	if failRule != nil {
+		ret.Rule = failRule.name()
+		ret.Params = failRule.params()
+	} else if this.requiredIf != nil {
+		ret.Rule = "required_if"
+		ret.Params = []string{this.requiredIf.field, this.requiredIf.value}
+	}
+	if ret.Message == "" {
+		ret.Message = fmt.Sprintf("%s valid faild", fieldName)
+	}
+	return ret
+}
+
+// describe 返回可读的校验说明，用于生成文档
+func (this *validRuleGroup) describe(t reflect.Type, tr Translator) string {
+	ret := []string{}
+	switch {
+	case this.requiredIf != nil:
+		ret = append(ret, tr("doc.required_if", this.requiredIf.field, this.requiredIf.value))
+	case this.optional:
+		ret = append(ret, tr("doc.optional"))
+	default:
+		ret = append(ret, tr("doc.required"))
+	}
+	for _, rule := range this.rules {
+		ret = append(ret, rule.describe(t, tr))
+	}
+	return strings.Join(ret, ", ")
+}
+
+type rule interface {
+	// 返回是否通过校验
+	// parentSource是字段所在对象的数据，用于和同级字段比较
+	valid(
+		fieldType reflect.StructField,
+		destSource []byte,
+		parentSource map[string]json.RawMessage,
+		root reflect.Value,
+		rootSource map[string]json.RawMessage,
+	) bool
+	// 返回是哪种rule
+	value() string
+	// 返回rule的名字，用于校验错误
+	name() string
+	// 返回rule的参数，用于校验错误
+	params() []string
+	// 返回可读的说明，用于生成文档，t是字段的类型
+	describe(t reflect.Type, tr Translator) string
+}
+
+const (
+	_RANGE_MODE_EXEC = `^(rune)?([\[\(])(-{0,1}\d*),(-{0,1}\d*)([\]\)])$`
+	_FUNC_MODE_EXEC  = `^@([a-zA-Z_]+[0-9a-zA-Z_]*)$`
+	_OPTIONAL_MODE   = "optional"
+	_MESSAGE_MODE    = "message="
+)
+
+var (
+	rangeModeRegexp = regexp.MustCompile(_RANGE_MODE_EXEC)
+	funcModeRegexp  = regexp.MustCompile(_FUNC_MODE_EXEC)
+)
+
+func validParse(tagsField string) (*validRuleGroup, error) {
+	if cacheRuleGroup, exist := validRuleCache.Load(tagsField); exist {
+		return cacheRuleGroup.(*validRuleGroup), nil
+	}
+
+	ret := &validRuleGroup{
+		rules:    []rule{},
+		optional: false,
+		message:  "",
+	}
+	// 如果valid tag是空字符串，那么就只验证存在性
+	// 因为这里optional默认是false,rules默认是空数组
+	tokens, err := splitValidTag(tagsField)
+	if err != nil {
+		return nil, err
+	}
+
+	// 遍历所有规则，构造validRuleGroup
+	for _, token := range tokens {
+		switch {
+		case token == _OPTIONAL_MODE:
+			ret.optional = true
+		case strings.HasPrefix(token, _MESSAGE_MODE):
+			ret.message = token[len(_MESSAGE_MODE):]
+		case token[0] == '/':
+			r, err := newRegRule(token[1 : len(token)-1])
+			if err != nil {
+				return nil, fmt.Errorf("kelp.validator: invalid valid tag `%s`: %v", tagsField, err)
+			}
+			ret.rules = append(ret.rules, r)
+		case rangeModeRegexp.MatchString(token):
+			ele := rangeModeRegexp.FindStringSubmatch(token)
+			r := newRangeRule(ele[3], ele[4], ele[2] == "[", ele[5] == "]")
+			r.runes = ele[1] == "rune"
+			ret.rules = append(ret.rules, r)
+		case funcModeRegexp.MatchString(token):
+			ret.rules = append(ret.rules, newFuncRule(token[1:]))
+		default:
+			name, param := token, ""
+			if i := strings.Index(token, ":"); i > 0 {
+				name, param = token[:i], token[i+1:]
+			}
+			if name == "required_if" {
+				field, value := param, ""
+				if i := strings.Index(param, "="); i > 0 {
+					field, value = param[:i], param[i+1:]
+				}
+				ret.requiredIf = &requiredIf{field, value}
+				continue
+			}
+			r, err := newBuiltinRule(name, param)
+			if err != nil {
+				return nil, fmt.Errorf("kelp.validator: invalid valid tag `%s`: %v", tagsField, err)
+			}
+			if r == nil {
+				// 兼容旧的valid tag，未知的规则只是忽略
+				log.Printf("[WARN] kelp.validator: unknown rule `%s` in valid tag `%s` is ignored", name, tagsField)
+				continue
+			}
+			ret.rules = append(ret.rules, r)
+		}
+	}
+
+	// 解析后的rule不会被修改，所以可以被并发使用
+	validRuleCache.Store(tagsField, ret)
+	return ret, nil
+}
+
+// splitValidTag 将valid tag按照逗号拆分成多个规则
+// 其中正则表达式和范围中可能有逗号，message总是到结尾
+// 其他规则的参数中有逗号或者括号时，可以用单引号括起来，例如：date:'Jan 2, 2006'
+func splitValidTag(tag string) ([]string, error) {
+	ret := []string{}
+	for tag != "" {
+		if tag[0] == ',' || tag[0] == ' ' {
+			tag = tag[1:]
+			continue
+		}
+		end := -1
+		token := ""
+		switch {
+		case strings.HasPrefix(tag, _MESSAGE_MODE):
+			end = len(tag)
+			token = tag
+		case tag[0] == '/':
+			// 正则表达式到后面是逗号或者结尾的/为止
+			for i := 1; i < len(tag); i++ {
+				if tag[i] == '/' && (i == len(tag)-1 || tag[i+1] == ',') {
+					end = i + 1
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("kelp.validator: regexp in valid tag `%s` is not closed", tag)
+			}
+			token = tag[:end]
+		case strings.IndexAny(strings.TrimPrefix(tag, "rune"), "[(") == 0:
+			// 范围中有逗号，到]或者)为止
+			end = strings.IndexAny(tag, "])")
+			if end < 0 {
+				return nil, fmt.Errorf("kelp.validator: range in valid tag `%s` is not closed", tag)
+			}
+			end++
+			token = tag[:end]
+		default:
+			// 到单引号以外的逗号为止，单引号被去掉
+			quoted := false
+			buf := strings.Builder{}
+			for end = 0; end < len(tag) && (quoted || tag[end] != ','); end++ {
+				if tag[end] == '\'' {
+					quoted = !quoted
+					continue
+				}
+				buf.WriteByte(tag[end])
+			}
+			if quoted {
+				return nil, fmt.Errorf("kelp.validator: quote in valid tag `%s` is not closed", tag)
+			}
+			token = buf.String()
+		}
+		if token != "" {
+			ret = append(ret, token)
+		}
+		tag = tag[end:]
+	}
+	return ret, nil
+}
+
+type regRule struct {
+	reg    string
+	regexp *regexp.Regexp
+}
+
+func newRegRule(reg string) (*regRule, error) {
+	compiled, err := regexp.Compile(reg)
+	if err != nil {
+		return nil, err
+	}
+	return &regRule{reg, compiled}, nil
+}
+func (this *regRule) value() string {
+	return this.reg
+}
+
+func (this *regRule) name() string {
+	return "regexp"
+}
+
+func (this *regRule) params() []string {
+	return []string{this.reg}
+}
+
+func (this *regRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc.regexp", this.reg)
+}
+
+func (this *regRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	str := string(destSource)
+	val := len(str)
+	// 如果是字符串，去掉两端的引号
+	if val > 2 && str[0] == '"' && str[val-1] == '"' {
+		str = str[1 : val-1]
+	}
+	return this.regexp.MatchString(str)
+}
+
+type rangeRule struct {
+	min      string
+	max      string
+	equalMin bool
+	equalMax bool
+	// runes 字符串按照字符数比较长度，而不是字节数
+	runes bool
+}
+
+func newRangeRule(min, max string, equalMin, equalMax bool) *rangeRule {
+	return &rangeRule{min: min, max: max, equalMin: equalMin, equalMax: equalMax}
+}
+
+func (this *rangeRule) value() string {
+	emin := ""
+	emax := ""
+	if this.equalMin {
+		emin = "="
+	}
+	if this.equalMax {
+		emax = "="
+	}
+	return fmt.Sprintf("%s<%sx<%s%s", this.min, emin, emax, this.max)
+}
+
+func (this *rangeRule) name() string {
+	if this.runes {
+		return "rune_range"
+	}
+	return "range"
+}
+
+// params 返回区间的两端，包括开闭符号，例如：["[1", "2)"]
+func (this *rangeRule) params() []string {
+	left := "("
+	if this.equalMin {
+		left = "["
+	}
+	right := ")"
+	if this.equalMax {
+		right = "]"
+	}
+	return []string{left + this.min, this.max + right}
+}
+
+func (this *rangeRule) describe(t reflect.Type, tr Translator) string {
+	ret := ""
+	if this.min != "" {
+		ret += this.min + "<"
+		if this.equalMin {
+			ret += "="
+		}
+	}
+	ret += "x"
+	if this.max != "" {
+		ret += "<"
+		if this.equalMax {
+			ret += "="
+		}
+		ret += this.max
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if this.runes {
+			return tr("doc.rune_length", ret)
+		}
+		return tr("doc.length", ret)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return tr("doc.count", ret)
+	default:
+		return tr("doc.range", ret)
+	}
+}
+
+func (this *rangeRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	t := fieldType.Type
+	// 指针比较指向的值
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// 如果是int，就比较int值大小
+		val, err := strconv.ParseInt(string(destSource), 10, 64)
+		if err != nil {
+			return false
+		}
+		return this.inRange(func(bound string) int {
+			b, _ := strconv.ParseInt(bound, 10, 64)
+			return compareInt64(val, b)
+		})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// 如果是uint，也比较值大小，负数的边界总是小于值
+		val, err := strconv.ParseUint(string(destSource), 10, 64)
+		if err != nil {
+			return false
+		}
+		return this.inRange(func(bound string) int {
+			if strings.HasPrefix(bound, "-") {
+				return 1
+			}
+			b, _ := strconv.ParseUint(bound, 10, 64)
+			switch {
+			case val < b:
+				return -1
+			case val > b:
+				return 1
+			}
+			return 0
+		})
+	case reflect.Float32, reflect.Float64:
+		// 如果是float，就比较float值大小
+		val, err := strconv.ParseFloat(string(destSource), 64)
+		if err != nil {
+			return false
+		}
+		return this.inRange(func(bound string) int {
+			b, _ := strconv.ParseFloat(bound, 64)
+			switch {
+			case val < b:
+				return -1
+			case val > b:
+				return 1
+			}
+			return 0
+		})
+	case reflect.String:
+		// 如果是string，就比较长度
+		str, ok := sourceString(destSource)
+		// 目标类型不对
+		if !ok {
+			return false
+		}
+		if this.runes {
+			return this.validLength(utf8.RuneCountInString(str))
+		}
+		return this.validLength(len(str))
+	case reflect.Slice, reflect.Array:
+		// 如果是slice或array，就比较元素个数
+		elems := []json.RawMessage{}
+		if err := json.Unmarshal(destSource, &elems); err != nil {
+			return false
+		}
+		return this.validLength(len(elems))
+	case reflect.Map:
+		// 如果是map，就比较key的个数
+		elems := map[string]json.RawMessage{}
+		if err := json.Unmarshal(destSource, &elems); err != nil {
+			return false
+		}
+		return this.validLength(len(elems))
+	default:
+		// 如果是其他的，就都算不通过
+		return false
+	}
+}
+
+// validLength 比较长度
+func (this *rangeRule) validLength(val int) bool {
+	return this.inRange(func(bound string) int {
+		b, _ := strconv.ParseInt(bound, 10, 64)
+		return compareInt64(int64(val), b)
+	})
+}
+
+// inRange 判断值是否在区间内
+// cmp返回值与边界比较的结果，小于时为负数，等于时为0，大于时为正数
+func (this *rangeRule) inRange(cmp func(bound string) int) bool {
+	if this.min != "" {
+		if c := cmp(this.min); c < 0 || (c == 0 && !this.equalMin) {
+			return false
+		}
+	}
+	if this.max != "" {
+		if c := cmp(this.max); c > 0 || (c == 0 && !this.equalMax) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type funcRule struct {
+	funcName string
+}
+
+func newFuncRule(funcName string) *funcRule {
+	return &funcRule{funcName}
+}
+func (this *funcRule) value() string {
+	return this.funcName
+}
+
+func (this *funcRule) name() string {
+	return "func"
+}
+
+func (this *funcRule) params() []string {
+	return []string{this.funcName}
+}
+
+func (this *funcRule) describe(t reflect.Type, tr Translator) string {
+	return tr("doc.func", this.funcName)
+}
+
+func (this *funcRule) valid(
+	fieldType reflect.StructField,
+	destSource []byte,
+	parentSource map[string]json.RawMessage,
+	root reflect.Value,
+	rootSource map[string]json.RawMessage,
+) bool {
+	if f, exist := getValidFunc(this.funcName); !exist {
+		return false
+	} else {
+		return f(fieldType, destSource, root, rootSource)
+	}
+}
+
+// BindAndValidJson 将data绑定到目标类型实体上
+// body的内容必须是合法的json格式
+func BindAndValidJson(dest interface{}, data []byte) error {
+	return bindAndValidJson(dest, data, false)
+}
+
+// BindAndValidJsonAll 将data绑定到目标类型实体上，并校验所有字段
+// 如果有校验不通过的字段，返回的错误是ValidErrors
+func BindAndValidJsonAll(dest interface{}, data []byte) error {
+	return bindAndValidJson(dest, data, true)
+}
+
+func bindAndValidJson(dest interface{}, data []byte, all bool) error {
+	if err := json.Unmarshal(data, dest); err != nil {
+		err = bindError(dest, data, err)
+		if validErr, ok := err.(*ValidError); ok && all {
+			return ValidErrors{validErr}
+		}
+		return err
+	}
+	return validSource(dest, data, all)
+}
+
+// bindError 处理合法json类型非法的情况
+// 如果对应字段的valid tag中定义了message，就使用这个message
+func bindError(dest interface{}, data []byte, err error) error {
+	typeErr, ok := err.(*json.UnmarshalTypeError)
+	if !ok || typeErr.Field == "" {
+		return fmt.Errorf("invalid json %s with error %v", string(data), err)
+	}
+	keys := strings.Split(typeErr.Field, ".")
+	ret := &ValidError{
+		Path:    "",
+		Rule:    "type",
+		Params:  []string{typeErr.Type.String()},
+		Message: fmt.Sprintf("invalid json %s with error %v", string(data), err),
+		field:   keys[len(keys)-1],
+	}
+	for _, key := range keys {
+		ret.Path = jsonPointer(ret.Path, key)
+	}
+	if field, exist := findFieldByPath(reflect.TypeOf(dest), keys); exist {
+		if validTag, exist := field.Tag.Lookup("valid"); exist {
+			if ruleGroup, err := validParse(validTag); err == nil && ruleGroup.message != "" {
+				ret.Message = ruleGroup.message
+				ret.custom = true
+			}
+		}
+	}
+	return ret
+}
+
+// findFieldByPath 根据json字段名路径查找字段
+func findFieldByPath(dest reflect.Type, keys []string) (field reflect.StructField, exist bool) {
+	for _, key := range keys {
+		// 跳过指针和容器，找到struct
+		for dest.Kind() == reflect.Ptr ||
+			dest.Kind() == reflect.Slice ||
+			dest.Kind() == reflect.Array ||
+			dest.Kind() == reflect.Map {
+			dest = dest.Elem()
+		}
+		if dest.Kind() != reflect.Struct {
+			return reflect.StructField{}, false
+		}
+		if field, exist = findFieldByName(dest, key); !exist {
+			return field, false
+		}
+		field = withRegisteredRules(dest, field)
+		dest = field.Type
+	}
+	return field, exist
+}
+
+func findFieldByName(dest reflect.Type, fieldName string) (field reflect.StructField, exist bool) {
+	for i := 0; i < dest.NumField(); i++ {
+		field := dest.Field(i)
+		if getFieldName(field) == fieldName {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,548 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type Case struct {
+	assert  bool   // 预期结果
+	message string // 预期提示
+	json    string // 数据
+}
+
+func TestValid(t *testing.T) {
+	for _, c := range []Case{
+		Case{true, "", `{"name":"abc"}`},
+		Case{true, "", `{"name":""}`},
+		Case{false, "", `{}`},
+		Case{false, "", `{"other":"abc"}`},
+	} {
+		assertValid(t, c, Valid(&struct {
+			Name string `json:"name" valid:""` // name必填，可以为空字符串
+		}{}, []byte(c.json)))
+	}
+
+	// message
+	for _, c := range []Case{
+		Case{false, "invalid name", `{}`},
+	} {
+		assertValid(t, c, Valid(&struct {
+			Name string `json:"name" valid:"message=invalid name"`
+		}{}, []byte(c.json)))
+	}
+
+	// optional
+	for _, c := range []Case{
+		Case{true, "", `{}`},
+		Case{false, "", `{"name":""}`},
+	} {
+		assertValid(t, c, Valid(&struct {
+			Name string `json:"name" valid:"(0,),optional"`
+		}{}, []byte(c.json)))
+	}
+
+	// reg
+	for _, c := range []Case{
+		Case{true, "", `{"name":"123"}`},
+		Case{false, "", `{"name":"abc"}`},
+	} {
+		assertValid(t, c, Valid(&struct {
+			Name string `json:"name" valid:"/\\d+/"`
+		}{}, []byte(c.json)))
+	}
+}
+
+func assertValid(t *testing.T, c Case, err error) {
+	if err != nil {
+		if c.assert {
+			t.Error("valid should return nil but", err)
+		} else {
+			if c.message != "" && c.message != err.Error() {
+				t.Error(c, "valid message should be", c.message, "but", err)
+			}
+		}
+	} else {
+		if !c.assert {
+			t.Error(c, "valid should return", c.message, "but nil")
+		}
+	}
+}
+
+type validParseAssert struct {
+	isOptional bool
+	message    string
+	rulesValue []string
+	tagsStr    string
+}
+
+func TestValidParse(t *testing.T) {
+	for _, a := range []validParseAssert{
+		validParseAssert{false, "", []string{}, ""},
+		validParseAssert{false, "", []string{"func"}, "@func"},
+		validParseAssert{false, "", []string{"func1", "func2"}, "@func1,@func2"},
+		validParseAssert{false, "", []string{"1<=x<=2"}, "[1,2]"},
+		validParseAssert{false, "", []string{"-2<=x<=-1"}, "[-2,-1]"},
+		validParseAssert{false, "", []string{"1<x<=2"}, "(1,2]"},
+		validParseAssert{false, "", []string{"1<=x<2"}, "[1,2)"},
+		validParseAssert{false, "", []string{"1<x<2"}, "(1,2)"},
+		validParseAssert{false, "", []string{"1<x<"}, "(1,)"},
+		validParseAssert{false, "", []string{"<x<2"}, "(,2)"},
+		validParseAssert{false, "", []string{".*"}, "/.*/"},
+		validParseAssert{false, "", []string{`\d+`}, `/\d+/`},
+		validParseAssert{true, "", []string{}, "optional"},
+		validParseAssert{false, "aaa", []string{}, "message=aaa"},
+		validParseAssert{true, "", []string{"func"}, "@func,optional"},
+		validParseAssert{true, "", []string{"1<=x<=2"}, "[1,2],optional"},
+		validParseAssert{false, "", []string{"func", "1<=x<=2"}, "@func,[1,2]"},
+		validParseAssert{true, "", []string{"func", "1<=x<=2"}, "@func,[1,2],optional"},
+		validParseAssert{true, "hello 123", []string{"func", "1<=x<=2"}, "@func,[1,2],optional,message=hello 123"},
+	} {
+		if g, err := validParse(a.tagsStr); err != nil {
+			t.Error(err)
+		} else {
+			if a.isOptional != g.optional ||
+				a.message != g.message ||
+				len(a.rulesValue) != len(g.rules) {
+				t.Error(a, g, a.rulesValue, len(g.rules))
+			}
+			for _, r := range a.rulesValue {
+				if !hasRule(g.rules, r) {
+					for _, tr := range g.rules {
+						t.Error(r, "vs", tr.value())
+					}
+				}
+			}
+		}
+	}
+}
+
+func hasRule(rules []rule, value string) bool {
+	for _, rule := range rules {
+		if rule.value() == value {
+			return true
+		}
+	}
+	return false
+}
+
+type structForTestBind struct {
+	A int                   `json:"a" valid:"message=invalid a"`
+	B structSubForTestBind  `json:"b"`
+	C *structSubForTestBind `json:"c"`
+}
+
+type structSubForTestBind struct {
+	D int `json:"d" valid:"message=invalid d in sub"`
+}
+
+func TestBindAndValidJson(t *testing.T) {
+	tm := &structForTestBind{}
+	if err := BindAndValidJson(tm, []byte(`{"a":1.1}`)); err != nil {
+		if err.Error() != "invalid a" {
+			t.Error("failed in bind error when unmarshal type error", err)
+		}
+	}
+	if err := BindAndValidJson(tm, []byte(`{"a":1,"b":{"d":1.3}}`)); err != nil {
+		if err.Error() != "invalid d in sub" {
+			t.Error("failed in bind error when unmarshal type error", err)
+		}
+	}
+	if err := BindAndValidJson(tm, []byte(`{"a":1,"c":{"d":1.3}}`)); err != nil {
+		if err.Error() != "invalid d in sub" {
+			t.Error("failed in bind error when unmarshal type error", err)
+		}
+	}
+}
+
+type structForTestValidAll struct {
+	Name  string                   `json:"name" valid:"(0,10],message=invalid name"`
+	Age   int                      `json:"age" valid:"[0,150]"`
+	Code  string                   `json:"code" valid:"/^\\d+$/,optional"`
+	Sub   structSubForTestValidAll `json:"sub"`
+	Slash string                   `json:"a/b" valid:""`
+}
+
+type structSubForTestValidAll struct {
+	D int `json:"d" valid:"[1,),message=invalid d in sub"`
+}
+
+func TestValidAll(t *testing.T) {
+	err := ValidAll(&structForTestValidAll{}, []byte(`{"name":"","age":200,"code":"abc","sub":{"d":0}}`))
+	errs, ok := err.(ValidErrors)
+	if !ok {
+		t.Fatal("valid all should return ValidErrors but", err)
+	}
+	expect := `[` +
+		`{"path":"/name","rule":"range","params":["(0","10]"],"message":"invalid name"},` +
+		`{"path":"/age","rule":"range","params":["[0","150]"],"message":"age valid faild"},` +
+		`{"path":"/code","rule":"regexp","params":["^\\d+$"],"message":"code valid faild"},` +
+		`{"path":"/sub/d","rule":"range","params":["[1",")"],"message":"invalid d in sub"},` +
+		`{"path":"/a~1b","rule":"required","params":[],"message":"a/b valid faild"}]`
+	if actual, _ := json.Marshal(errs); string(actual) != expect {
+		t.Error("wrong valid errors", string(actual))
+	}
+
+	// 缺少嵌套的struct
+	err = ValidAll(&structForTestValidAll{}, []byte(`{"name":"a","age":1,"a/b":""}`))
+	if errs, ok := err.(ValidErrors); !ok || len(errs) != 1 || errs[0].Path != "/sub/d" || errs[0].Rule != "required" {
+		t.Error("missing sub should be required", err)
+	}
+
+	if err := ValidAll(&structForTestValidAll{}, []byte(`{"name":"a","age":1,"sub":{"d":1},"a/b":""}`)); err != nil {
+		t.Error("valid all should return nil but", err)
+	}
+
+	// 第一个错误模式
+	if err, ok := Valid(&structForTestValidAll{}, []byte(`{"name":"","age":200}`)).(*ValidError); !ok || err.Path != "/name" {
+		t.Error("valid should return the first error but", err)
+	}
+}
+
+func TestBindAndValidJsonAll(t *testing.T) {
+	err := BindAndValidJsonAll(&structForTestBind{}, []byte(`{"a":1,"b":{"d":1.3}}`))
+	if errs, ok := err.(ValidErrors); !ok || len(errs) != 1 ||
+		errs[0].Path != "/b/d" || errs[0].Rule != "type" || errs[0].Message != "invalid d in sub" {
+		t.Error("wrong type error", err)
+	}
+}
+
+type structForTestValidNested struct {
+	Tags  []string                    `json:"tags" valid:"[1,3]" valid_elem:"(0,5]"`
+	Items []structSubForTestValidAll  `json:"items" valid:"optional"`
+	Ptr   *structSubForTestValidAll   `json:"ptr"`
+	Attrs map[string]int              `json:"attrs" valid:"optional" valid_key:"/^[a-z]+$/" valid_elem:"[0,),message=invalid attr"`
+	Subs  map[string]*structForTestPt `json:"subs"`
+	Ids   []*int                      `json:"ids" valid_elem:"[1,),optional"`
+}
+
+type structForTestPt struct {
+	X string `json:"x" valid:"/^x/"`
+}
+
+func TestValidNested(t *testing.T) {
+	for _, c := range []struct {
+		json   string
+		expect []string
+	}{
+		{`{"tags":["a"]}`, []string{}},
+		{`{"tags":[]}`, []string{"/tags range"}},
+		{`{"tags":["a","","abcdef"]}`, []string{"/tags/1 range", "/tags/2 range"}},
+		{`{"tags":["a",null]}`, []string{"/tags/1 required"}},
+		{`{"tags":["a"],"items":[{"d":1},{"d":0},{}]}`, []string{"/items/1/d range", "/items/2/d required"}},
+		{`{"tags":["a"],"ptr":null}`, []string{}},
+		{`{"tags":["a"],"ptr":{}}`, []string{"/ptr/d required"}},
+		{`{"tags":["a"],"attrs":{"a":1,"B":1,"c":-1}}`, []string{"/attrs/B regexp", "/attrs/c range"}},
+		{`{"tags":["a"],"subs":{"a/b":{"x":"y"},"c":null}}`, []string{"/subs/a~1b/x regexp"}},
+		{`{"tags":["a"],"ids":[1,null,0]}`, []string{"/ids/2 range"}},
+	} {
+		err := ValidAll(&structForTestValidNested{}, []byte(c.json))
+		actual := []string{}
+		if errs, ok := err.(ValidErrors); ok {
+			for _, e := range errs {
+				actual = append(actual, e.Path+" "+e.Rule)
+			}
+		} else if err != nil {
+			t.Error(c.json, "should return ValidErrors but", err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Error(c.json, "valid errors should be", c.expect, "but", actual)
+		}
+	}
+
+	// 元素的message
+	err := Valid(&structForTestValidNested{}, []byte(`{"tags":["a"],"attrs":{"a":-1}}`))
+	if err == nil || err.Error() != "invalid attr" {
+		t.Error("wrong element message", err)
+	}
+}
+
+func TestValidFuncOnElem(t *testing.T) {
+	RegisterValidFunc("testElemType", func(
+		fieldType reflect.StructField,
+		destSource []byte,
+		root reflect.Value,
+		rootSource map[string]json.RawMessage,
+	) bool {
+		// 元素的类型以及root数据都要传给ValidFunc
+		_, hasRoot := rootSource["list"]
+		return fieldType.Type.Kind() == reflect.Int && hasRoot && string(destSource) != "0"
+	})
+	dest := &struct {
+		List []int `json:"list" valid_elem:"@testElemType"`
+	}{}
+	if err := ValidAll(dest, []byte(`{"list":[1,0]}`)); err == nil || err.(ValidErrors)[0].Path != "/list/1" {
+		t.Error("wrong valid func on element", err)
+	}
+}
+
+// validWithTag 使用动态生成的struct校验字段v
+func validWithTag(t reflect.Type, tag, json string) error {
+	dest := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "V", Type: t, Tag: reflect.StructTag(`json:"v" valid:"` + tag + `"`)},
+		{Name: "W", Type: t, Tag: reflect.StructTag(`json:"w"`)},
+		{Name: "Type", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`json:"type"`)},
+	}))
+	return Valid(dest.Interface(), []byte(json))
+}
+
+func TestValidBuiltinRules(t *testing.T) {
+	str := reflect.TypeOf("")
+	for _, c := range []struct {
+		t      reflect.Type
+		tag    string
+		json   string
+		assert bool
+	}{
+		{str, "in:a|b|c", `{"v":"b"}`, true},
+		{str, "in:a|b|c", `{"v":"d"}`, false},
+		{reflect.TypeOf(0), "in:1|2", `{"v":2}`, true},
+		{str, "email", `{"v":"kelp@example.com"}`, true},
+		{str, "email", `{"v":"Kelp <kelp@example.com>"}`, false},
+		{str, "email", `{"v":"kelp"}`, false},
+		{str, "url", `{"v":"https://example.com/a?b=c"}`, true},
+		{str, "url", `{"v":"example.com"}`, false},
+		{str, "ip", `{"v":"::1"}`, true},
+		{str, "ipv4", `{"v":"127.0.0.1"}`, true},
+		{str, "ipv4", `{"v":"::1"}`, false},
+		{str, "ipv6", `{"v":"fe80::1"}`, true},
+		{str, "ipv6", `{"v":"127.0.0.1"}`, false},
+		{str, "cidr", `{"v":"10.0.0.0/8"}`, true},
+		{str, "cidr", `{"v":"10.0.0.0"}`, false},
+		{str, "uuid", `{"v":"123e4567-e89b-12d3-a456-426614174000"}`, true},
+		{str, "uuid", `{"v":"123e4567"}`, false},
+		{str, "date", `{"v":"2019-01-31"}`, true},
+		{str, "date", `{"v":"2019-02-31"}`, false},
+		{str, "datetime", `{"v":"2019-01-31 12:00:00"}`, true},
+		{str, "date:15:04", `{"v":"12:30"}`, true},
+		{str, "date:15:04", `{"v":"2019-01-31"}`, false},
+		{reflect.TypeOf(0), "uint", `{"v":1}`, true},
+		{reflect.TypeOf(0), "uint", `{"v":-1}`, false},
+		{reflect.TypeOf(uint(0)), "[1,10]", `{"v":10}`, true},
+		{reflect.TypeOf(uint(0)), "[1,10]", `{"v":0}`, false},
+		{reflect.TypeOf(uint8(0)), "[-1,)", `{"v":0}`, true},
+		{reflect.TypeOf(uint64(0)), "[0,)", `{"v":-1}`, false},
+		{reflect.TypeOf(uint64(0)), "(,18446744073709551615)", `{"v":18446744073709551614}`, true},
+		{str, "[1,2]", `{"v":"中"}`, false},
+		{str, "rune[1,2]", `{"v":"中文"}`, true},
+		{str, "rune[1,2]", `{"v":"中文字"}`, false},
+		{str, "rune(,1]", `{"v":"中"}`, true},
+		{str, "eqfield:w", `{"v":"a","w":"a"}`, true},
+		{str, "eqfield:w", `{"v":"a","w":"b"}`, false},
+		{str, "eqfield:w", `{"v":"a"}`, false},
+		{str, "nefield:w", `{"v":"a","w":"b"}`, true},
+		{reflect.TypeOf(0), "gtfield:w", `{"v":2,"w":1}`, true},
+		{reflect.TypeOf(0), "gtfield:w", `{"v":1,"w":1}`, false},
+		{reflect.TypeOf(0), "gtefield:w", `{"v":1,"w":1}`, true},
+		{str, "ltfield:w", `{"v":"2019-01-01","w":"2019-02-01"}`, true},
+		{str, "ltefield:w", `{"v":"2019-03-01","w":"2019-02-01"}`, false},
+		{str, "required_if:type=email,email", `{"type":"phone"}`, true},
+		{str, "required_if:type=email,email", `{"type":"email"}`, false},
+		{str, "required_if:type=email,email", `{"type":"email","v":"kelp@example.com"}`, true},
+		{str, "date:'Jan 2, 2006',optional", `{"v":"Feb 3, 2019"}`, true},
+		{str, "date:'Jan 2, 2006',optional", `{"v":"2019-02-03"}`, false},
+		{str, "date:'15:04 (MST)'", `{"v":"12:30 (UTC)"}`, true},
+		{str, "in:'a,b'|c", `{"v":"a,b"}`, true},
+		{str, "in:'a,b'|c", `{"v":"a"}`, false},
+		{str, "/^\\\\d{1,3}$/,optional", `{"v":"123"}`, true},
+		{str, "/^\\\\d{1,3}$/,optional", `{"v":"1234"}`, false},
+	} {
+		err := validWithTag(c.t, c.tag, c.json)
+		if (err == nil) != c.assert {
+			t.Error(c.tag, c.json, "valid should be", c.assert, "but", err)
+		}
+	}
+
+	// 未知的规则被忽略，兼容旧的valid tag
+	if err := validWithTag(str, "unknown,[1,3]", `{"v":"ab"}`); err != nil {
+		t.Error("unknown rule should be ignored but", err)
+	}
+	if err := validWithTag(str, "unknown,[1,3]", `{"v":"abcd"}`); err == nil {
+		t.Error("rules after unknown rule should be checked")
+	}
+
+	err := ValidAll(&struct {
+		V string `json:"v" valid:"required_if:type=1"`
+		T int    `json:"type"`
+	}{}, []byte(`{"type":1}`))
+	if errs, ok := err.(ValidErrors); !ok || errs[0].Rule != "required_if" || !reflect.DeepEqual(errs[0].Params, []string{"type", "1"}) {
+		t.Error("wrong required_if error", err)
+	}
+}
+
+type structForTestConcurrent struct {
+	Name  string                      `json:"name" valid:"rune[1,10],/^[a-z]+$/"`
+	Code  string                      `json:"code" valid:"@testConcurrent"`
+	Items []structSubForTestValidAll  `json:"items" valid:"[1,)"`
+	Next  *structForTestConcurrent    `json:"next"`
+	Attrs map[string]*structForTestPt `json:"attrs" valid:"optional"`
+}
+
+func TestValidConcurrent(t *testing.T) {
+	RegisterValidFunc("testConcurrent", ValidRegexpWrapper(`^\d+$`))
+	valid := `{"name":"kelp","code":"1","items":[{"d":1}],"next":{"name":"a","code":"2","items":[{"d":2}]},"attrs":{"a":{"x":"x"}}}`
+	invalid := `{"name":"Kelp","code":"a","items":[{"d":0}],"next":{"name":"","items":[]},"attrs":{"a":{"x":"y"}}}`
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := BindAndValidJson(&structForTestConcurrent{}, []byte(valid)); err != nil {
+				t.Error("valid should return nil but", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if errs, ok := ValidAll(&structForTestConcurrent{}, []byte(invalid)).(ValidErrors); !ok || len(errs) != 7 {
+				t.Error("valid all should return 7 errors but", errs)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			// 运行时注册校验函数和解析新的tag
+			RegisterValidFunc("testConcurrent", ValidRegexpWrapper(`^\d+$`))
+			RegisterValidFunc(fmt.Sprintf("testConcurrent%d", i), ValidRegexpWrapper(`^\d+$`))
+			if _, err := validParse(fmt.Sprintf("[%d,),@testConcurrent%d", i, i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestValidPlanError(t *testing.T) {
+	if err := Valid(&struct {
+		A string `json:"a" valid:"/[a-/"`
+	}{}, []byte(`{"a":"a"}`)); err == nil || !strings.Contains(err.Error(), "invalid valid tag") {
+		t.Error("invalid regexp should return error but", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	param := reflect.TypeOf(struct {
+		A int               `valid:"(0,),optional"`
+		C []string          `valid:"[1,)" valid_elem:"in:a|b"`
+		D map[string]string `valid_key:"/^[a-z]+$/"`
+		E string            `valid:"required_if:type=1"`
+	}{})
+	tr := func(key string, args ...string) string {
+		return strings.Join(append([]string{key}, args...), " ")
+	}
+	for i, expect := range []string{
+		"doc.optional, doc.range 0<x",
+		"doc.required, doc.count 1<=x; doc.elemdoc.required, doc.in a|b",
+		"doc.keydoc.required, doc.regexp ^[a-z]+$",
+		"doc.required_if type 1",
+	} {
+		if doc := Describe(param.Field(i), tr); doc != expect {
+			t.Error("describe should be", expect, "but", doc)
+		}
+	}
+}
+
+type structForTestRegisterRules struct {
+	Name    string            `json:"name,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty" valid:"optional"`
+	Skipped string            `json:"-"`
+	secret  string
+}
+
+func TestRegisterRules(t *testing.T) {
+	err := RegisterRules(&structForTestRegisterRules{}, map[string]*FieldRule{
+		"name":   &FieldRule{Valid: "rune[1,10],message=invalid name"},
+		"tags":   &FieldRule{Valid: "optional", Elem: "in:a|b"},
+		"labels": &FieldRule{Valid: "optional", Key: "/^[a-z]+$/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidAll(&structForTestRegisterRules{}, []byte(`{"tags":["a","c"],"labels":{"A":"x"}}`))
+	expect := `[` +
+		`{"path":"/name","rule":"required","params":[],"message":"invalid name"},` +
+		`{"path":"/tags/1","rule":"in","params":["a","b"],"message":"tags[1] valid faild"},` +
+		`{"path":"/labels/A","rule":"regexp","params":["^[a-z]+$"],"message":"labels[A] valid faild"}]`
+	if actual, _ := json.Marshal(err); string(actual) != expect {
+		t.Error("wrong valid errors of registered rules", string(actual))
+	}
+	if err := BindAndValidJson(&structForTestRegisterRules{}, []byte(`{"name":1}`)); err == nil || err.Error() != "invalid name" {
+		t.Error("type error should use registered message but", err)
+	}
+	if err := Valid(&structForTestRegisterRules{}, []byte(`{"name":"kelp"}`)); err != nil {
+		t.Error("valid should return nil but", err)
+	}
+
+	// 重新注册会替换已经编译的校验计划
+	if err := RegisterRules(&structForTestRegisterRules{}, map[string]*FieldRule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Valid(&structForTestRegisterRules{}, []byte(`{}`)); err != nil {
+		t.Error("valid should return nil after rules removed but", err)
+	}
+
+	for _, rules := range []map[string]*FieldRule{
+		{"unknown": &FieldRule{Valid: "optional"}},
+		{"name": &FieldRule{Valid: "in:"}},
+	} {
+		if err := RegisterRules(&structForTestRegisterRules{}, rules); err == nil {
+			t.Error("invalid rules should return error", rules)
+		}
+	}
+}
+
+func BenchmarkValid(b *testing.B) {
+	RegisterValidFunc("testConcurrent", ValidRegexpWrapper(`^\d+$`))
+	data := []byte(`{"name":"kelp","code":"1","items":[{"d":1},{"d":2},{"d":3}],"next":{"name":"a","code":"2","items":[{"d":2}]},"attrs":{"a":{"x":"x"}}}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Valid(&structForTestConcurrent{}, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValidParallel(b *testing.B) {
+	RegisterValidFunc("testConcurrent", ValidRegexpWrapper(`^\d+$`))
+	data := []byte(`{"name":"kelp","code":"1","items":[{"d":1},{"d":2},{"d":3}],"next":{"name":"a","code":"2","items":[{"d":2}]},"attrs":{"a":{"x":"x"}}}`)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := Valid(&structForTestConcurrent{}, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkBindAndValidJson(b *testing.B) {
+	RegisterValidFunc("testConcurrent", ValidRegexpWrapper(`^\d+$`))
+	data := []byte(`{"name":"kelp","code":"1","items":[{"d":1},{"d":2},{"d":3}],"next":{"name":"a","code":"2","items":[{"d":2}]},"attrs":{"a":{"x":"x"}}}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := BindAndValidJson(&structForTestConcurrent{}, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSplitValidTag(t *testing.T) {
+	for tag, expect := range map[string][]string{
+		"optional,[1,10],message=a, b":    {"optional", "[1,10]", "message=a, b"},
+		"rune(,5],/^a,b$/,@func":          {"rune(,5]", "/^a,b$/", "@func"},
+		"date:'Jan 2, 2006',in:'(a)'|b":   {"date:Jan 2, 2006", "in:(a)|b"},
+		"eqfield:w, required_if:type=a,,": {"eqfield:w", "required_if:type=a"},
+	} {
+		if tokens, err := splitValidTag(tag); err != nil || !reflect.DeepEqual(tokens, expect) {
+			t.Error("wrong tokens of", tag, tokens, err)
+		}
+	}
+	for _, tag := range []string{"date:'Jan", "[1,", "/^a"} {
+		if _, err := splitValidTag(tag); err == nil {
+			t.Error("unclosed tag should fail", tag)
+		}
+	}
+}